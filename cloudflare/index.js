@@ -1,16 +1,27 @@
+// Модель по умолчанию, если клиент ее не передал
+const DEFAULT_MODEL = '@cf/black-forest-labs/flux-1-schnell';
+
 export default {
   async fetch(request, env) {
     // Разрешаем только POST запросы
     if (request.method !== 'POST') {
-      return new Response('Use POST with JSON { "prompt": "your text" }', {
+      return new Response('Use POST with JSON { "prompt": "your text", "model": "@cf/...", "steps": 4 }', {
         headers: { 'Content-Type': 'text/plain' },
         status: 405
       });
     }
 
+    // Если у Worker задан секрет AUTH_TOKEN, запросы без него отклоняются
+    if (env.AUTH_TOKEN && request.headers.get('Authorization') !== `Bearer ${env.AUTH_TOKEN}`) {
+      return new Response('Unauthorized', {
+        headers: { 'Content-Type': 'text/plain' },
+        status: 401
+      });
+    }
+
     try {
       // Получаем данные из запроса
-      const { prompt, steps } = await request.json();
+      const { prompt, steps, model = DEFAULT_MODEL } = await request.json();
 
       // Проверяем обязательное поле prompt
       if (!prompt || typeof prompt !== 'string' || prompt.length < 1 || prompt.length > 2048) {
@@ -20,31 +31,48 @@ export default {
         });
       }
 
-      // Проверяем steps (если есть)
-      if (steps && (typeof steps !== 'number' || steps < 1 || steps > 8)) {
-        return new Response('Invalid "steps": must be an integer between 1 and 8', {
+      // Проверяем модель: только модели Workers AI и, если задан ALLOWED_MODELS, только из списка
+      const allowedModels = (env.ALLOWED_MODELS || '').split(',').map((m) => m.trim()).filter(Boolean);
+      if (typeof model !== 'string' || !model.startsWith('@cf/') ||
+          (allowedModels.length > 0 && !allowedModels.includes(model))) {
+        return new Response(`Invalid "model": ${model} is not allowed`, {
+          headers: { 'Content-Type': 'text/plain' },
+          status: 400
+        });
+      }
+
+      // Проверяем steps (если есть); точные ограничения проверяет сама модель
+      if (steps && (!Number.isInteger(steps) || steps < 1 || steps > 50)) {
+        return new Response('Invalid "steps": must be an integer between 1 and 50', {
           headers: { 'Content-Type': 'text/plain' },
           status: 400
         });
       }
 
       // Генерируем изображение через модель
-      const response = await env.AI.run(
-        '@cf/black-forest-labs/flux-1-schnell',
-        {
-          prompt,
-          steps: steps || 4 // Используем значение по умолчанию
-        }
-      );
+      const inputs = { prompt };
+      if (steps) {
+        // Flux называет параметр steps, Stable Diffusion - num_steps
+        inputs[model.includes('flux') ? 'steps' : 'num_steps'] = steps;
+      }
+      const response = await env.AI.run(model, inputs);
 
-      // Конвертируем base64 в бинарные данные
-      const binaryString = atob(response.image);
-      const img = Uint8Array.from(binaryString, (m) => m.codePointAt(0));
+      // Flux возвращает изображение в base64, Stable Diffusion - поток байтов PNG
+      if (response && typeof response.image === 'string') {
+        const binaryString = atob(response.image);
+        const img = Uint8Array.from(binaryString, (m) => m.codePointAt(0));
+
+        return new Response(img, {
+          headers: {
+            'Content-Type': 'image/jpeg',
+            'Cache-Control': 'public, max-age=3600'
+          }
+        });
+      }
 
-      // Возвращаем изображение с правильными заголовками
-      return new Response(img, {
+      return new Response(response, {
         headers: {
-          'Content-Type': 'image/jpeg',
+          'Content-Type': 'image/png',
           'Cache-Control': 'public, max-age=3600'
         }
       });
@@ -5,17 +5,22 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/azalio/meme-bot/internal/config"
+	"github.com/azalio/meme-bot/internal/jobs"
 	"github.com/azalio/meme-bot/internal/otel/metrics"
 	"github.com/azalio/meme-bot/internal/service"
 	"github.com/azalio/meme-bot/pkg/logger"
@@ -27,6 +32,8 @@ const (
 	shutdownTimeout = 30 * time.Second
 	commandTimeout  = 5 * time.Minute
 	workerPoolSize  = 10
+	// Максимальная длина подписи к фото в Telegram (в символах)
+	maxCaptionLength = 1024
 )
 
 // App представляет основную структуру приложения
@@ -36,6 +43,17 @@ type App struct {
 	log     *logger.Logger
 	metrics *metrics.MetricProvider
 	wg      sync.WaitGroup
+	// jobs хранит незавершенные генерации, чтобы продолжить их после перезапуска
+	jobs      *jobs.Store
+	jobMaxAge time.Duration
+	// adminAPIToken защищает HTTP эндпоинт /providers
+	adminAPIToken string
+	// lastMemes хранит последний мем каждого чата для команды /reroll
+	lastMemesMu sync.Mutex
+	lastMemes   map[int64]*service.MemeResult
+	// captionModes хранит выбранное командой /caption размещение подписи в каждом чате
+	captionModesMu sync.Mutex
+	captionModes   map[int64]service.CaptionMode
 }
 
 // newApp создает новый экземпляр приложения
@@ -95,7 +113,12 @@ func newApp() (*App, error) {
 	authService := service.NewYandexAuthService(cfg, log)
 	log.Debug(context.Background(), "Auth service initialized successfully", nil)
 
-	gptService := service.NewYandexGPTService(cfg, log, authService)
+	// Языковая модель для промптов и подписей с резервными моделями из LLM_PROVIDERS
+	llmClient, err := service.NewLLMClient(cfg, log, authService)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM client: %w", err)
+	}
+	gptService := service.NewGPTService(log, llmClient)
 
 	botService, err := service.NewBotService(cfg, log, authService, gptService)
 	if err != nil {
@@ -103,13 +126,38 @@ func newApp() (*App, error) {
 	}
 	log.Debug(context.Background(), "Bot service initialized successfully", nil)
 
+	// Открываем хранилище задач генерации
+	jobStore, err := jobs.NewStore(cfg.JobStorePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %w", err)
+	}
+	log.Debug(context.Background(), "Job store opened successfully", map[string]interface{}{
+		"path":    cfg.JobStorePath,
+		"pending": len(jobStore.List()),
+	})
+
 	return &App{
-		bot:     botService,
-		log:     log,
-		metrics: mp,
+		bot:           botService,
+		log:           log,
+		metrics:       mp,
+		jobs:          jobStore,
+		jobMaxAge:     cfg.JobMaxAge,
+		adminAPIToken: cfg.AdminAPIToken,
+		lastMemes:     make(map[int64]*service.MemeResult),
+		captionModes:  make(map[int64]service.CaptionMode),
 	}, nil
 }
 
+// authorizedAdminRequest проверяет токен администратора в заголовке Authorization.
+// Без настроенного ADMIN_API_TOKEN административные HTTP эндпоинты закрыты для всех
+func (a *App) authorizedAdminRequest(r *http.Request) bool {
+	if a.adminAPIToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminAPIToken)) == 1
+}
+
 // startHealthServer запускает HTTP сервер для health checks
 // Health Check Pattern: Отдельный эндпоинт для проверки здоровья сервиса
 func (a *App) startHealthServer(ctx context.Context) {
@@ -126,9 +174,45 @@ func (a *App) startHealthServer(ctx context.Context) {
 	})
 
 	// Readiness probe
+	// Сервис готов, если хотя бы у одного провайдера изображений не открыт circuit breaker
 	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		// Здесь можно добавить проверки готовности сервисов
-		w.WriteHeader(http.StatusOK)
+		imageService := a.bot.ImageService()
+
+		providers := make(map[string]string)
+		for name, state := range imageService.ProviderStates() {
+			providers[name] = state.String()
+		}
+		ready := imageService.Ready()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{
+			"ready":     ready,
+			"providers": providers,
+		}); err != nil {
+			a.log.Error(r.Context(), "Failed to write readiness response", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	})
+
+	// Снимок оценок провайдеров изображений (для администраторов).
+	// Доступен только с токеном ADMIN_API_TOKEN: Authorization: Bearer <token>
+	mux.HandleFunc("/providers", func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorizedAdminRequest(r) {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(a.bot.ImageService().ProviderScores()); err != nil {
+			a.log.Error(r.Context(), "Failed to write providers response", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 	})
 
 	server := &http.Server{
@@ -172,6 +256,9 @@ func (a *App) run(ctx context.Context) error {
 	a.log.Debug(ctx, "Starting metrics server", nil)
 	metrics.StartMetricsServer()
 
+	// Продолжаем генерации, прерванные перезапуском
+	a.resumeJobs(ctx)
+
 	// Запускаем обработчик обновлений
 	a.log.Debug(ctx, "Starting update handler", nil)
 	a.wg.Add(1)
@@ -271,8 +358,8 @@ func (a *App) handleUpdates(ctx context.Context) {
 				"message": update.Message.Text,
 			})
 
-			// Если сообщение является командой, обрабатываем её
-			if update.Message.IsCommand() {
+			// Если сообщение является командой (в том числе в подписи к фото или картинке), обрабатываем её
+			if command, _ := messageCommand(update.Message); command != "" {
 				// Увеличиваем счетчик WaitGroup для отслеживания активных горутин
 				a.wg.Add(1)
 				go func(update tgbotapi.Update) {
@@ -288,8 +375,7 @@ func (a *App) handleUpdates(ctx context.Context) {
 					defer a.wg.Done()
 
 					// Извлекаем команду и аргументы из сообщения
-					command := update.Message.Command()
-					args := strings.TrimSpace(update.Message.CommandArguments())
+					command, args := messageCommand(update.Message)
 
 					// Создаем контекст с таймаутом для обработки команды
 					cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout)
@@ -316,13 +402,26 @@ func (a *App) handleCommand(ctx context.Context, update tgbotapi.Update, command
 		"chat_id": update.Message.Chat.ID,
 	})
 
+	ctx = a.withCaptionMode(ctx, update.Message.Chat.ID)
 	switch command {
 	case "meme":
+		// Ответ на фото или фото с командой в подписи - подписываем фото пользователя
+		if fileID := memePhotoFileID(update.Message); fileID != "" {
+			return a.handlePhotoMemeCommand(ctx, update, fileID, args)
+		}
 		return a.handleMemeCommand(ctx, update, args)
 	case "help":
 		return a.handleHelpCommand(ctx, update)
 	case "start":
 		return a.handleStartCommand(ctx, update)
+	case "gif":
+		return a.handleGIFCommand(ctx, update, args)
+	case "reroll":
+		return a.handleRerollCommand(ctx, update, args)
+	case "caption":
+		return a.handleCaptionCommand(ctx, update, args)
+	case "providers":
+		return a.handleProvidersCommand(ctx, update)
 	default:
 		return a.handleUnknownCommand(ctx, update)
 	}
@@ -347,6 +446,17 @@ func (a *App) handleMemeCommand(ctx context.Context, update tgbotapi.Update, arg
 		return fmt.Errorf("failed to send start message: %w", err)
 	}
 
+	// Сохраняем задачу, чтобы после перезапуска бота пользователь все равно получил мем
+	job := jobs.NewJob(update.Message.Chat.ID, update.Message.MessageID, update.Message.From.UserName, args)
+	job.ProcessingMessageID = processingMsg.MessageID
+	if err := a.jobs.Save(job); err != nil {
+		a.log.Error(ctx, "Failed to save job", map[string]interface{}{
+			"error":  err.Error(),
+			"job_id": job.ID,
+		})
+	}
+	ctx = service.WithGenerationTracker(ctx, a.jobs.Tracker(job.ID))
+
 	// Step 2: Засекаем время для метрик
 	startTime := time.Now()
 	defer func() {
@@ -355,8 +465,14 @@ func (a *App) handleMemeCommand(ctx context.Context, update tgbotapi.Update, arg
 	}()
 
 	// Step 3: Генерируем мем
-	imageData, err, caption := a.bot.HandleCommand(ctx, "meme", args)
+	meme, err := a.bot.HandleCommand(ctx, "meme", args)
 	if err != nil {
+		// Генерация прервана остановкой бота - задача будет продолжена после перезапуска
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("meme generation interrupted: %w", err)
+		}
+		defer a.completeJob(ctx, job.ID)
+
 		// Metrics Pattern: Увеличиваем счетчик ошибок
 		metrics.ErrorCounter.Inc("meme_generation")
 
@@ -375,6 +491,9 @@ func (a *App) handleMemeCommand(ctx context.Context, update tgbotapi.Update, arg
 		return fmt.Errorf("failed to generate image: %w", err)
 	}
 
+	// Дальше мем либо будет отправлен, либо пользователь получит сообщение об ошибке
+	defer a.completeJob(ctx, job.ID)
+
 	// Step 4: Удаляем сообщение о генерации
 	// Fail Gracefully Pattern: Продолжаем даже при ошибке удаления
 	if err := a.bot.DeleteMessage(ctx, update.Message.Chat.ID, processingMsg.MessageID); err != nil {
@@ -389,7 +508,7 @@ func (a *App) handleMemeCommand(ctx context.Context, update tgbotapi.Update, arg
 	}
 
 	// Step 5: Отправляем сгенерированный мем
-	if err := a.bot.SendPhoto(ctx, update.Message.Chat.ID, imageData, caption); err != nil {
+	if err := a.bot.SendPhoto(ctx, update.Message.Chat.ID, meme.Image, formatMemeCaption(meme)); err != nil {
 		// Metrics Pattern: Увеличиваем счетчик ошибок отправки
 		metrics.ErrorCounter.Inc("meme_sending")
 
@@ -405,22 +524,509 @@ func (a *App) handleMemeCommand(ctx context.Context, update tgbotapi.Update, arg
 		return fmt.Errorf("failed to send photo: %w", err)
 	}
 
+	a.rememberMeme(update.Message.Chat.ID, meme)
+
 	// Step 6: Логируем успешное выполнение
 	a.log.Info(ctx, "Meme generated and sent successfully", map[string]interface{}{
+		"user":                update.Message.From.UserName,
+		"chat_id":             update.Message.Chat.ID,
+		"duration":            time.Since(startTime).String(),
+		"provider":            meme.Provider,
+		"model":               meme.Model,
+		"seed":                meme.Seed,
+		"mime_type":           meme.MIMEType,
+		"prompt":              meme.Prompt,
+		"attempts":            meme.Attempts,
+		"cached":              meme.Cached,
+		"provider_latency":    meme.Latency.String(),
+		"enhance_duration":    meme.EnhanceDuration.String(),
+		"generation_duration": meme.GenerationDuration.String(),
+	})
+
+	return nil
+}
+
+// handlePhotoMemeCommand подписывает фотографию пользователя: GPT пишет подпись
+// по тексту команды, и она рисуется прямо на фото, без генерации изображения
+func (a *App) handlePhotoMemeCommand(ctx context.Context, update tgbotapi.Update, fileID, args string) error {
+	metrics.CommandCounter.Inc("meme_photo")
+	chatID := update.Message.Chat.ID
+
+	reply := func(text string) error {
+		if _, err := a.bot.SendMessage(ctx, chatID, text); err != nil {
+			metrics.ErrorCounter.Inc("meme_photo_message")
+			return fmt.Errorf("failed to send photo meme message: %w", err)
+		}
+		return nil
+	}
+
+	if prompt, _ := service.ParseMemeArgs(args); prompt == "" {
+		return reply("Напишите, о чем пошутить: ответьте на фото командой /meme [текст]")
+	}
+
+	processingMsg, err := a.bot.SendMessage(ctx, chatID, "Подписываю фото, пожалуйста подождите...")
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+
+	startTime := time.Now()
+	meme, err := a.captionPhoto(ctx, fileID, args)
+	if delErr := a.bot.DeleteMessage(ctx, chatID, processingMsg.MessageID); delErr != nil {
+		a.log.Error(ctx, "Failed to delete generation message", map[string]interface{}{
+			"error":   delErr.Error(),
+			"chat_id": chatID,
+			"msg_id":  processingMsg.MessageID,
+			"command": "meme",
+		})
+	}
+	if err != nil {
+		metrics.ErrorCounter.Inc("meme_photo")
+		if sendErr := reply(fmt.Sprintf("Не удалось подписать фото: %v", err)); sendErr != nil {
+			a.log.Error(ctx, "Failed to send error message", map[string]interface{}{
+				"error":    sendErr.Error(),
+				"orig_err": err.Error(),
+				"chat_id":  chatID,
+			})
+		}
+		return fmt.Errorf("failed to caption photo: %w", err)
+	}
+
+	if err := a.bot.SendPhoto(ctx, chatID, meme.Image, formatMemeCaption(meme)); err != nil {
+		metrics.ErrorCounter.Inc("meme_sending")
+		return fmt.Errorf("failed to send photo: %w", err)
+	}
+
+	a.log.Info(ctx, "Photo meme sent successfully", map[string]interface{}{
+		"user":             update.Message.From.UserName,
+		"chat_id":          chatID,
+		"duration":         time.Since(startTime).String(),
+		"caption":          meme.Caption,
+		"enhance_duration": meme.EnhanceDuration.String(),
+	})
+	return nil
+}
+
+// captionPhoto скачивает фото из Telegram и рисует на нем подпись
+func (a *App) captionPhoto(ctx context.Context, fileID, args string) (*service.MemeResult, error) {
+	photo, err := a.bot.DownloadFile(ctx, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download photo: %w", err)
+	}
+	return a.bot.CaptionPhoto(ctx, photo, args)
+}
+
+// messageCommand возвращает команду и аргументы сообщения. Команда может быть
+// и в подписи к фото или к картинке, отправленной файлом: Telegram размечает ее
+// в CaptionEntities, а не в Entities.
+func messageCommand(msg *tgbotapi.Message) (command, args string) {
+	if msg.IsCommand() {
+		return msg.Command(), strings.TrimSpace(msg.CommandArguments())
+	}
+	if !hasImage(msg) || len(msg.CaptionEntities) == 0 {
+		return "", ""
+	}
+	entity := msg.CaptionEntities[0]
+	if entity.Offset != 0 || !entity.IsCommand() {
+		return "", ""
+	}
+
+	// Смещения сущностей считаются в UTF-16, но команда состоит из ASCII
+	caption := msg.Caption
+	end := min(entity.Length, len(caption))
+	command = strings.TrimPrefix(caption[:end], "/")
+	if i := strings.Index(command, "@"); i != -1 {
+		command = command[:i]
+	}
+	return command, strings.TrimSpace(caption[end:])
+}
+
+// memePhotoFileID возвращает ID самой большой версии фото, которое нужно подписать:
+// приложенного к сообщению с командой или того, на которое ответили командой.
+// Картинка, отправленная файлом, тоже подходит. Если фото нет, возвращает пустую строку.
+func memePhotoFileID(msg *tgbotapi.Message) string {
+	for _, m := range []*tgbotapi.Message{msg, msg.ReplyToMessage} {
+		if m == nil {
+			continue
+		}
+		if len(m.Photo) > 0 {
+			// Telegram присылает размеры по возрастанию
+			return m.Photo[len(m.Photo)-1].FileID
+		}
+		if hasImage(m) {
+			return m.Document.FileID
+		}
+	}
+	return ""
+}
+
+// hasImage сообщает, есть ли в сообщении фото или картинка, отправленная файлом
+func hasImage(msg *tgbotapi.Message) bool {
+	return len(msg.Photo) > 0 || (msg.Document != nil && strings.HasPrefix(msg.Document.MimeType, "image/"))
+}
+
+// handleGIFCommand генерирует анимированный мем: панорама по одному или
+// нескольким (--frames N) изображениям и «печатающаяся» подпись
+func (a *App) handleGIFCommand(ctx context.Context, update tgbotapi.Update, args string) error {
+	metrics.CommandCounter.Inc("gif")
+	chatID := update.Message.Chat.ID
+
+	processingMsg, err := a.bot.SendMessage(ctx, chatID, "Генерирую анимированный мем, пожалуйста подождите...")
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+
+	startTime := time.Now()
+	meme, err := a.bot.GenerateAnimation(ctx, args)
+	if delErr := a.bot.DeleteMessage(ctx, chatID, processingMsg.MessageID); delErr != nil {
+		a.log.Error(ctx, "Failed to delete generation message", map[string]interface{}{
+			"error":   delErr.Error(),
+			"chat_id": chatID,
+			"msg_id":  processingMsg.MessageID,
+			"command": "gif",
+		})
+	}
+	if err != nil {
+		metrics.ErrorCounter.Inc("gif_generation")
+		if _, sendErr := a.bot.SendMessage(ctx, chatID, fmt.Sprintf("Ошибка генерации анимации: %v", err)); sendErr != nil {
+			a.log.Error(ctx, "Failed to send error message", map[string]interface{}{
+				"error":    sendErr.Error(),
+				"orig_err": err.Error(),
+				"chat_id":  chatID,
+			})
+		}
+		return fmt.Errorf("failed to generate animation: %w", err)
+	}
+
+	if err := a.bot.SendAnimation(ctx, chatID, meme.Image, formatMemeCaption(meme)); err != nil {
+		metrics.ErrorCounter.Inc("gif_sending")
+		return fmt.Errorf("failed to send animation: %w", err)
+	}
+
+	a.log.Info(ctx, "Animated meme sent successfully", map[string]interface{}{
+		"user":                update.Message.From.UserName,
+		"chat_id":             chatID,
+		"duration":            time.Since(startTime).String(),
+		"provider":            meme.Provider,
+		"model":               meme.Model,
+		"size":                len(meme.Image),
+		"generation_duration": meme.GenerationDuration.String(),
+	})
+	return nil
+}
+
+// handleRerollCommand перерисовывает последний мем чата с новым случайным сидом
+// или с сидом из аргументов, чтобы повторить понравившуюся картинку
+func (a *App) handleRerollCommand(ctx context.Context, update tgbotapi.Update, args string) error {
+	metrics.CommandCounter.Inc("reroll")
+	chatID := update.Message.Chat.ID
+
+	reply := func(text string) error {
+		if _, err := a.bot.SendMessage(ctx, chatID, text); err != nil {
+			metrics.ErrorCounter.Inc("reroll_message")
+			return fmt.Errorf("failed to send reroll message: %w", err)
+		}
+		return nil
+	}
+
+	if seed, err := strconv.ParseInt(args, 10, 64); args != "" && (err != nil || seed < 0) {
+		return reply("Сид должен быть неотрицательным целым числом, например: /reroll 1863")
+	}
+	previous := a.lastMeme(chatID)
+	if previous == nil {
+		return reply("Сначала сгенерируйте мем командой /meme")
+	}
+
+	processingMsg, err := a.bot.SendMessage(ctx, chatID, "Перерисовываю мем, пожалуйста подождите...")
+	if err != nil {
+		return fmt.Errorf("failed to send start message: %w", err)
+	}
+
+	startTime := time.Now()
+	meme, err := a.bot.RerollMeme(ctx, previous, args)
+	if delErr := a.bot.DeleteMessage(ctx, chatID, processingMsg.MessageID); delErr != nil {
+		a.log.Error(ctx, "Failed to delete generation message", map[string]interface{}{
+			"error":   delErr.Error(),
+			"chat_id": chatID,
+			"msg_id":  processingMsg.MessageID,
+			"command": "reroll",
+		})
+	}
+	if err != nil {
+		metrics.ErrorCounter.Inc("meme_generation")
+		if sendErr := reply(fmt.Sprintf("Ошибка генерации мема: %v", err)); sendErr != nil {
+			a.log.Error(ctx, "Failed to send error message", map[string]interface{}{
+				"error":    sendErr.Error(),
+				"orig_err": err.Error(),
+				"chat_id":  chatID,
+			})
+		}
+		return fmt.Errorf("failed to reroll meme: %w", err)
+	}
+
+	if err := a.bot.SendPhoto(ctx, chatID, meme.Image, formatMemeCaption(meme)); err != nil {
+		metrics.ErrorCounter.Inc("meme_sending")
+		return fmt.Errorf("failed to send photo: %w", err)
+	}
+	a.rememberMeme(chatID, meme)
+
+	a.log.Info(ctx, "Meme rerolled and sent successfully", map[string]interface{}{
 		"user":     update.Message.From.UserName,
-		"chat_id":  update.Message.Chat.ID,
+		"chat_id":  chatID,
 		"duration": time.Since(startTime).String(),
+		"provider": meme.Provider,
+		"model":    meme.Model,
+		"seed":     meme.Seed,
 	})
+	return nil
+}
 
+// rememberMeme запоминает мем как последний в чате.
+// Изображение не хранится: для /reroll нужны только промпт и параметры генерации.
+func (a *App) rememberMeme(chatID int64, meme *service.MemeResult) {
+	generation := *meme.GenerationResult
+	generation.Image = nil
+	last := *meme
+	last.GenerationResult = &generation
+
+	a.lastMemesMu.Lock()
+	defer a.lastMemesMu.Unlock()
+	a.lastMemes[chatID] = &last
+}
+
+// lastMeme возвращает последний мем чата или nil
+func (a *App) lastMeme(chatID int64) *service.MemeResult {
+	a.lastMemesMu.Lock()
+	defer a.lastMemesMu.Unlock()
+	return a.lastMemes[chatID]
+}
+
+// handleCaptionCommand показывает или меняет размещение подписи мемов в чате
+func (a *App) handleCaptionCommand(ctx context.Context, update tgbotapi.Update, args string) error {
+	metrics.CommandCounter.Inc("caption")
+	chatID := update.Message.Chat.ID
+
+	const usage = "/caption overlay - на картинке\n" +
+		"/caption telegram - текстом под картинкой\n" +
+		"/caption both - и там, и там"
+
+	var text string
+	switch mode, err := service.ParseCaptionMode(args); {
+	case args == "":
+		text = fmt.Sprintf("Подпись размещается %s. Изменить:\n%s", describeCaptionMode(a.captionMode(chatID)), usage)
+	case err != nil:
+		text = "Не знаю такого режима. Доступны:\n" + usage
+	default:
+		a.captionModesMu.Lock()
+		a.captionModes[chatID] = mode
+		a.captionModesMu.Unlock()
+		text = fmt.Sprintf("Готово, теперь подпись размещается %s", describeCaptionMode(mode))
+	}
+
+	if _, err := a.bot.SendMessage(ctx, chatID, text); err != nil {
+		metrics.ErrorCounter.Inc("caption_message")
+		return fmt.Errorf("failed to send caption message: %w", err)
+	}
 	return nil
 }
 
+// captionMode возвращает режим подписи, выбранный в чате, или режим по умолчанию
+func (a *App) captionMode(chatID int64) service.CaptionMode {
+	a.captionModesMu.Lock()
+	defer a.captionModesMu.Unlock()
+	if mode, ok := a.captionModes[chatID]; ok {
+		return mode
+	}
+	return a.bot.DefaultCaptionMode()
+}
+
+// withCaptionMode передает сервису режим подписи чата
+func (a *App) withCaptionMode(ctx context.Context, chatID int64) context.Context {
+	return service.WithCaptionMode(ctx, a.captionMode(chatID))
+}
+
+// describeCaptionMode описывает режим подписи для пользователя
+func describeCaptionMode(mode service.CaptionMode) string {
+	switch mode {
+	case service.CaptionModeTelegram:
+		return "текстом под картинкой"
+	case service.CaptionModeBoth:
+		return "на картинке и текстом под ней"
+	default:
+		return "на картинке"
+	}
+}
+
+// completeJob удаляет задачу из хранилища после того, как пользователь получил результат
+func (a *App) completeJob(ctx context.Context, jobID string) {
+	if err := a.jobs.Delete(jobID); err != nil {
+		a.log.Error(ctx, "Failed to delete completed job", map[string]interface{}{
+			"error":  err.Error(),
+			"job_id": jobID,
+		})
+	}
+}
+
+// resumeJobs продолжает генерации, прерванные перезапуском бота.
+// Для каждой задачи запускается отдельная горутина, которая дожидается
+// уже запущенных операций у провайдеров.
+func (a *App) resumeJobs(ctx context.Context) {
+	pending := a.jobs.List()
+	if len(pending) == 0 {
+		return
+	}
+	a.log.Info(ctx, "Resuming interrupted jobs", map[string]interface{}{
+		"count": len(pending),
+	})
+
+	for _, job := range pending {
+		a.wg.Add(1)
+		go func(job *jobs.Job) {
+			defer a.wg.Done()
+
+			jobCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+			defer cancel()
+
+			if err := a.resumeJob(jobCtx, job); err != nil {
+				a.log.Error(ctx, "Failed to resume job", map[string]interface{}{
+					"error":  err.Error(),
+					"job_id": job.ID,
+				})
+			}
+		}(job)
+	}
+}
+
+// resumeJob доводит одну прерванную задачу до конца: отправляет мем
+// или явное сообщение об ошибке
+func (a *App) resumeJob(ctx context.Context, job *jobs.Job) error {
+	a.log.Info(ctx, "Resuming job", map[string]interface{}{
+		"job_id":     job.ID,
+		"chat_id":    job.ChatID,
+		"stage":      string(job.Stage),
+		"operations": job.Operations,
+		"age":        time.Since(job.CreatedAt).String(),
+	})
+
+	if time.Since(job.CreatedAt) > a.jobMaxAge {
+		defer a.completeJob(ctx, job.ID)
+		metrics.ErrorCounter.Inc("meme_resume_expired")
+		a.deleteProcessingMessage(ctx, job)
+		msg := fmt.Sprintf("Не удалось сгенерировать мем по запросу «%s»: бот перезапускался слишком долго. Попробуйте еще раз.", job.Prompt)
+		if _, err := a.bot.SendMessage(ctx, job.ChatID, msg); err != nil {
+			return fmt.Errorf("failed to send expiration message: %w", err)
+		}
+		return nil
+	}
+
+	ctx = service.WithGenerationTracker(a.withCaptionMode(ctx, job.ChatID), a.jobs.Tracker(job.ID))
+	meme, err := a.bot.ResumeMeme(ctx, job.Prompt, job.EnhancedPrompt, job.Caption, job.Operations)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return fmt.Errorf("resumed job interrupted: %w", err)
+		}
+		defer a.completeJob(ctx, job.ID)
+		metrics.ErrorCounter.Inc("meme_generation")
+		a.deleteProcessingMessage(ctx, job)
+		if _, sendErr := a.bot.SendMessage(ctx, job.ChatID, fmt.Sprintf("Ошибка генерации мема: %v", err)); sendErr != nil {
+			a.log.Error(ctx, "Failed to send error message", map[string]interface{}{
+				"error":    sendErr.Error(),
+				"orig_err": err.Error(),
+				"chat_id":  job.ChatID,
+				"job_id":   job.ID,
+			})
+		}
+		return fmt.Errorf("failed to generate image: %w", err)
+	}
+
+	defer a.completeJob(ctx, job.ID)
+	a.deleteProcessingMessage(ctx, job)
+	if err := a.bot.SendPhoto(ctx, job.ChatID, meme.Image, formatMemeCaption(meme)); err != nil {
+		metrics.ErrorCounter.Inc("meme_sending")
+		return fmt.Errorf("failed to send photo: %w", err)
+	}
+	a.rememberMeme(job.ChatID, meme)
+
+	a.log.Info(ctx, "Resumed meme sent successfully", map[string]interface{}{
+		"job_id":   job.ID,
+		"chat_id":  job.ChatID,
+		"user":     job.UserName,
+		"provider": meme.Provider,
+		"model":    meme.Model,
+		"age":      time.Since(job.CreatedAt).String(),
+	})
+	return nil
+}
+
+// deleteProcessingMessage удаляет сообщение "Генерирую мем..." прерванной задачи
+func (a *App) deleteProcessingMessage(ctx context.Context, job *jobs.Job) {
+	if job.ProcessingMessageID == 0 {
+		return
+	}
+	if err := a.bot.DeleteMessage(ctx, job.ChatID, job.ProcessingMessageID); err != nil {
+		a.log.Error(ctx, "Failed to delete generation message", map[string]interface{}{
+			"error":   err.Error(),
+			"chat_id": job.ChatID,
+			"msg_id":  job.ProcessingMessageID,
+			"job_id":  job.ID,
+		})
+	}
+}
+
+// formatMemeCaption дополняет подпись мема информацией о том, кто и за сколько его нарисовал.
+// Подпись обрезается так, чтобы вместе с этой строкой уложиться в лимит Telegram.
+// У мемов по фотографии пользователя строки об авторе нет.
+func formatMemeCaption(meme *service.MemeResult) string {
+	// Подпись, нарисованная на изображении, не повторяется текстом, если чат не попросил об этом
+	var caption []rune
+	if meme.CaptionMode.TelegramCaption() {
+		caption = []rune(meme.Caption)
+	}
+	if meme.Provider == service.ProviderUserPhoto {
+		if len(caption) > maxCaptionLength {
+			caption = caption[:maxCaptionLength]
+		}
+		return string(caption)
+	}
+
+	author := meme.Model
+	if author == "" {
+		author = meme.Provider
+	}
+	credit := fmt.Sprintf("🎨 Нарисовал %s за %s", author, meme.Latency.Round(time.Second))
+	if meme.Cached {
+		// Время исходной генерации к этому ответу отношения не имеет
+		credit = fmt.Sprintf("🎨 Нарисовал %s, из кэша", author)
+	}
+	if meme.Seed != "" {
+		// Сид позволяет повторить мем через /reroll <сид>
+		credit += ", сид " + meme.Seed
+	}
+
+	maxCaption := maxCaptionLength - len([]rune(credit)) - 2
+	if len(caption) > maxCaption {
+		caption = caption[:maxCaption]
+	}
+	if len(caption) == 0 {
+		return credit
+	}
+	return string(caption) + "\n\n" + credit
+}
+
 // handleHelpCommand обрабатывает команду помощи
 func (a *App) handleHelpCommand(ctx context.Context, update tgbotapi.Update) error {
 	metrics.CommandCounter.Inc("help")
 
 	helpText := `Доступные команды:
 /meme [текст] - Генерирует мем с опциональным описанием
+/meme --no-cache [текст] - Генерирует новый мем, даже если такой уже был
+/meme --seed 1863 --ar 16:9 [текст] - Задает сид и соотношение сторон (1:1, 16:9, 9:16, 4:3)
+/meme кот::2 | космос::0.5 - Составляет промпт из частей с весами
+/meme --no-overlay [текст] - Присылает подпись текстом, а не на картинке
+/meme [текст] в ответ на фото или в подписи к фото - Подписывает ваше фото
+/gif [текст] - Генерирует анимированный мем
+/gif --frames 3 [текст] - Анимирует несколько сгенерированных кадров (до 4)
+/reroll [сид] - Перерисовывает последний мем с новым или заданным сидом
+/caption [overlay|telegram|both] - Выбирает, где в этом чате размещать подпись
 /start - Запускает бота
 /help - Показывает это сообщение
 Пост о том как создавался этот бот - https://t.me/azalio_tech/43`
@@ -461,6 +1067,34 @@ func (a *App) handleStartCommand(ctx context.Context, update tgbotapi.Update) er
 	return nil
 }
 
+// handleProvidersCommand показывает администраторам текущие оценки провайдеров изображений
+func (a *App) handleProvidersCommand(ctx context.Context, update tgbotapi.Update) error {
+	// Для остальных пользователей команда выглядит как неизвестная
+	if update.Message.From == nil || !a.bot.IsAdmin(update.Message.From.ID) {
+		return a.handleUnknownCommand(ctx, update)
+	}
+	metrics.CommandCounter.Inc("providers")
+
+	var sb strings.Builder
+	sb.WriteString("Провайдеры изображений (в порядке выбора):\n")
+	for _, score := range a.bot.ImageService().ProviderScores() {
+		fmt.Fprintf(&sb, "• %s: оценка %.2f, успешность %.0f%% (%d вызовов), p50 %.1fs, breaker %s\n",
+			score.Name, score.Score, score.SuccessRate*100, score.Calls, score.LatencyP50, score.BreakerState)
+	}
+
+	if _, err := a.bot.SendMessage(ctx, update.Message.Chat.ID, sb.String()); err != nil {
+		metrics.ErrorCounter.Inc("providers_message")
+		a.log.Error(ctx, "Failed to send providers message", map[string]interface{}{
+			"error":   err.Error(),
+			"chat_id": update.Message.Chat.ID,
+			"user":    update.Message.From.UserName,
+		})
+		return fmt.Errorf("failed to send providers message: %w", err)
+	}
+
+	return nil
+}
+
 // handleUnknownCommand обрабатывает неизвестные команды
 func (a *App) handleUnknownCommand(ctx context.Context, update tgbotapi.Update) error {
 	metrics.CommandCounter.Inc("unknown")
@@ -5,6 +5,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/azalio/meme-bot/pkg/logger"
 	"github.com/joho/godotenv"
@@ -20,8 +24,147 @@ type Config struct {
 	YandexIAMToken string
 	// ID папки в Yandex Cloud для ART
 	YandexArtFolderID string
+	// Языковые модели для промптов и подписей в порядке приоритета: yandex_gpt, openai, ollama.
+	// Следующая модель используется, если предыдущая вернула ошибку
+	LLMProviders []string
+	// Таймаут запроса к языковой модели
+	LLMTimeout time.Duration
+	// Модель Yandex GPT, например yandexgpt-lite или yandexgpt
+	YandexGPTModel string
+	// Базовый URL OpenAI-совместимого API chat completions (/v1/chat/completions)
+	OpenAIChatBaseURL string
+	// API ключ OpenAI-совместимого API chat completions
+	OpenAIChatAPIKey string
+	// Модель chat completions, например gpt-4o-mini
+	OpenAIChatModel string
+	// Адрес сервера Ollama
+	OllamaURL string
+	// Модель Ollama, например llama3.1
+	OllamaModel string
 	// MEME_DEBUG включение дебаг уровня
 	MemeDebug string
+	// Telegram ID пользователей, которым доступны административные команды
+	AdminUserIDs []int64
+	// Токен для HTTP эндпоинта /providers. Пустой токен отключает эндпоинт
+	AdminAPIToken string
+	// Список включенных провайдеров генерации изображений в порядке приоритета.
+	// Пустой список означает "все зарегистрированные провайдеры"
+	ImageProviders []string
+	// Стратегия запуска провайдеров: race, hedged или sequential
+	ImageStrategy string
+	// Задержка перед запуском следующего провайдера в режиме hedged,
+	// пока не накоплена статистика задержек провайдеров
+	ImageHedgeDelay time.Duration
+	// Порядок выбора провайдеров: static (из IMAGE_PROVIDERS) или adaptive
+	// (вместе с adaptive стратегия race заменяется на hedged)
+	ImageProviderSelection string
+	// Доля запросов, на которых adaptive-режим исследует случайный порядок провайдеров
+	ImageAdaptiveEpsilon float64
+	// Размер окна (в вызовах) circuit breaker провайдера
+	CircuitBreakerWindow int
+	// Минимальное число вызовов в окне, после которого breaker может открыться
+	CircuitBreakerMinRequests int
+	// Доля ошибок (0..1), при которой breaker открывается
+	CircuitBreakerFailureRate float64
+	// Время, на которое открывается breaker до пробного запроса
+	CircuitBreakerCooldown time.Duration
+	// Максимальная сторона изображения в пикселях; большие изображения уменьшаются перед отправкой
+	ImageMaxSide int
+	// Качество JPEG при перекодировании изображений (1..100)
+	ImageJPEGQuality int
+	// Перцептивные хэши (hex) известных заглушек, которые считаются ошибкой провайдера
+	ImagePlaceholderHashes []string
+	// Стандартное отклонение цветов, ниже которого изображение считается однотонным
+	ImageBlankStdDev float64
+	// Где размещать подпись мема по умолчанию: overlay (на изображении), telegram или both
+	CaptionMode string
+	// Путь к файлу незавершенных задач генерации. Пустое значение - задачи не переживают перезапуск
+	JobStorePath string
+	// Максимальный возраст задачи, которую имеет смысл продолжать после перезапуска
+	JobMaxAge time.Duration
+	// Максимальное число изображений в кэше в памяти (кэшируются только запросы с --seed);
+	// 0 отключает кэш в памяти
+	ImageCacheSize int
+	// Максимальный размер кэша изображений в памяти, МБ
+	ImageCacheMemoryMB int
+	// Время жизни изображения в кэше
+	ImageCacheTTL time.Duration
+	// Каталог дискового кэша изображений. Пустое значение - кэш только в памяти
+	ImageCacheDir string
+	// Максимальный размер дискового кэша изображений, МБ
+	ImageCacheDiskMB int
+	// Базовый URL OpenAI-совместимого API генерации изображений (/v1/images/generations).
+	// Провайдер openai регистрируется, если задан URL или ключ
+	OpenAIImageBaseURL string
+	// API ключ OpenAI-совместимого API
+	OpenAIImageAPIKey string
+	// Модель генерации изображений, например dall-e-3
+	OpenAIImageModel string
+	// Размер изображения, например 1024x1024
+	OpenAIImageSize string
+	// Формат ответа: b64_json (изображение в ответе) или url (ссылка на изображение)
+	OpenAIImageResponseFormat string
+	// Таймаут запроса к OpenAI-совместимому API
+	OpenAIImageTimeout time.Duration
+	// Ключи FusionBrain API. Провайдер fusion_brain регистрируется, если они заданы
+	FusionBrainAPIKey    string
+	FusionBrainSecretKey string
+	// Вариант API FusionBrain: text2image (прежнее API, по умолчанию) или pipeline (пайплайны)
+	FusionBrainAPI string
+	// Название модели FusionBrain, например Kandinsky; пусто - первая доступная
+	FusionBrainModel string
+	// Стиль генерации FusionBrain (DEFAULT, KANDINSKY, UHD, ANIME)
+	FusionBrainStyle string
+	// Негативный промпт FusionBrain
+	FusionBrainNegativePrompt string
+	// Размер изображения FusionBrain в пикселях
+	FusionBrainWidth  int
+	FusionBrainHeight int
+	// Через сколько генерация перечитывает список моделей FusionBrain
+	FusionBrainModelRefresh time.Duration
+	// Адрес Cloudflare Worker из cloudflare/index.js. Провайдер cloudflare_ai регистрируется,
+	// если задан адрес Worker или ID аккаунта вместе с API-токеном
+	CloudflareWorkerURL string
+	// Общий секрет Worker (переменная AUTH_TOKEN у Worker), передается в заголовке Authorization
+	CloudflareWorkerSecret string
+	// ID аккаунта и API токен Cloudflare для прямых запросов к REST API ai/run без Worker
+	CloudflareAccountID string
+	CloudflareAPIToken  string
+	// Модель Workers AI
+	CloudflareAIModel string
+	// Число шагов генерации
+	CloudflareAISteps int
+	// Таймаут запроса к Cloudflare
+	CloudflareAITimeout time.Duration
+	// Адрес собственного сервера Stable Diffusion. Провайдер stable_diffusion регистрируется, если он задан
+	StableDiffusionURL string
+	// API сервера Stable Diffusion: automatic1111 или comfyui
+	StableDiffusionBackend string
+	// Сэмплер в терминах бэкенда ("Euler a" у AUTOMATIC1111, "euler_ancestral" у ComfyUI)
+	StableDiffusionSampler string
+	// Число шагов генерации
+	StableDiffusionSteps int
+	// CFG scale - сила следования промпту
+	StableDiffusionCFGScale float64
+	// Негативный промпт
+	StableDiffusionNegativePrompt string
+	// Размер изображения в пикселях
+	StableDiffusionWidth  int
+	StableDiffusionHeight int
+	// Файл модели для встроенного workflow ComfyUI
+	StableDiffusionCheckpoint string
+	// Путь к собственному workflow ComfyUI в API-формате
+	StableDiffusionWorkflow string
+	// Время на одну генерацию, включая ожидание в очереди
+	StableDiffusionTimeout time.Duration
+	// Каталог с шаблонами мемов (templates.json и изображения) вместо встроенных
+	MemeTemplatesDir string
+	// Параметры анимированных мемов /gif: число кадров, длительность кадра,
+	// большая сторона в пикселях и максимальный размер файла
+	GIFFrames     int
+	GIFFrameDelay time.Duration
+	GIFMaxSide    int
+	GIFMaxBytes   int
 }
 
 // New создает новый экземпляр конфигурации
@@ -50,18 +193,244 @@ func New(envFile string, logger *logger.Logger) (*Config, error) {
 		YandexIAMToken:    os.Getenv("YANDEX_IAM_TOKEN"),
 		YandexArtFolderID: os.Getenv("YANDEX_ART_FOLDER_ID"),
 		MemeDebug:         os.Getenv("MEME_DEBUG"),
+		ImageProviders:    parseList(os.Getenv("IMAGE_PROVIDERS")),
+		ImageStrategy:     os.Getenv("IMAGE_STRATEGY"),
+
+		LLMProviders:      parseList(getEnv("LLM_PROVIDERS", "yandex_gpt")),
+		YandexGPTModel:    getEnv("YANDEX_GPT_MODEL", "yandexgpt-lite"),
+		OpenAIChatBaseURL: os.Getenv("OPENAI_CHAT_BASE_URL"),
+		OpenAIChatAPIKey:  os.Getenv("OPENAI_CHAT_API_KEY"),
+		OpenAIChatModel:   getEnv("OPENAI_CHAT_MODEL", "gpt-4o-mini"),
+		OllamaURL:         getEnv("OLLAMA_URL", "http://localhost:11434"),
+		OllamaModel:       getEnv("OLLAMA_MODEL", "llama3.1"),
+
+		ImagePlaceholderHashes: parseList(os.Getenv("IMAGE_PLACEHOLDER_HASHES")),
+		JobStorePath:           os.Getenv("JOB_STORE_PATH"),
+		CaptionMode:            os.Getenv("CAPTION_MODE"),
+		ImageCacheDir:          os.Getenv("IMAGE_CACHE_DIR"),
+
+		OpenAIImageBaseURL:        os.Getenv("OPENAI_IMAGE_BASE_URL"),
+		OpenAIImageAPIKey:         os.Getenv("OPENAI_IMAGE_API_KEY"),
+		OpenAIImageModel:          getEnv("OPENAI_IMAGE_MODEL", "dall-e-3"),
+		OpenAIImageSize:           getEnv("OPENAI_IMAGE_SIZE", "1024x1024"),
+		OpenAIImageResponseFormat: getEnv("OPENAI_IMAGE_RESPONSE_FORMAT", "b64_json"),
+
+		FusionBrainAPIKey:         os.Getenv("FUSION_BRAIN_API_KEY"),
+		FusionBrainSecretKey:      os.Getenv("FUSION_BRAIN_SECRET_KEY"),
+		FusionBrainAPI:            getEnv("FUSION_BRAIN_API", "text2image"),
+		FusionBrainModel:          os.Getenv("FUSION_BRAIN_MODEL"),
+		FusionBrainStyle:          os.Getenv("FUSION_BRAIN_STYLE"),
+		FusionBrainNegativePrompt: os.Getenv("FUSION_BRAIN_NEGATIVE_PROMPT"),
+
+		CloudflareWorkerURL:    os.Getenv("CLOUDFLARE_WORKER_URL"),
+		CloudflareWorkerSecret: os.Getenv("CLOUDFLARE_WORKER_SECRET"),
+		CloudflareAccountID:    os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
+		CloudflareAPIToken:     os.Getenv("CLOUDFLARE_API_TOKEN"),
+		CloudflareAIModel:      getEnv("CLOUDFLARE_AI_MODEL", "@cf/black-forest-labs/flux-1-schnell"),
+
+		StableDiffusionURL:            os.Getenv("STABLE_DIFFUSION_URL"),
+		StableDiffusionBackend:        getEnv("STABLE_DIFFUSION_BACKEND", "automatic1111"),
+		StableDiffusionSampler:        os.Getenv("STABLE_DIFFUSION_SAMPLER"),
+		StableDiffusionNegativePrompt: os.Getenv("STABLE_DIFFUSION_NEGATIVE_PROMPT"),
+		StableDiffusionCheckpoint:     os.Getenv("STABLE_DIFFUSION_CHECKPOINT"),
+		StableDiffusionWorkflow:       os.Getenv("STABLE_DIFFUSION_WORKFLOW"),
+		MemeTemplatesDir:              os.Getenv("MEME_TEMPLATES_DIR"),
+
+		ImageProviderSelection: os.Getenv("IMAGE_PROVIDER_SELECTION"),
+		AdminAPIToken:          os.Getenv("ADMIN_API_TOKEN"),
+	}
+
+	var err error
+	if config.ImageHedgeDelay, err = parseDuration("IMAGE_HEDGE_DELAY", 15*time.Second); err != nil {
+		return nil, err
+	}
+	if config.LLMTimeout, err = parseDuration("LLM_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.ImageAdaptiveEpsilon, err = parseFloat("IMAGE_ADAPTIVE_EPSILON", 0.1); err != nil {
+		return nil, err
+	}
+	if config.AdminUserIDs, err = parseInt64List("ADMIN_USER_IDS"); err != nil {
+		return nil, err
+	}
+	if config.CircuitBreakerWindow, err = parseInt("CIRCUIT_BREAKER_WINDOW", 20); err != nil {
+		return nil, err
+	}
+	if config.CircuitBreakerMinRequests, err = parseInt("CIRCUIT_BREAKER_MIN_REQUESTS", 5); err != nil {
+		return nil, err
+	}
+	if config.CircuitBreakerFailureRate, err = parseFloat("CIRCUIT_BREAKER_FAILURE_RATE", 0.5); err != nil {
+		return nil, err
+	}
+	if config.CircuitBreakerCooldown, err = parseDuration("CIRCUIT_BREAKER_COOLDOWN", time.Minute); err != nil {
+		return nil, err
+	}
+	if config.ImageMaxSide, err = parseInt("IMAGE_MAX_SIDE", 2560); err != nil {
+		return nil, err
+	}
+	if config.ImageJPEGQuality, err = parseInt("IMAGE_JPEG_QUALITY", 90); err != nil {
+		return nil, err
+	}
+	if config.ImageBlankStdDev, err = parseFloat("IMAGE_BLANK_STDDEV", 4); err != nil {
+		return nil, err
+	}
+	if config.JobMaxAge, err = parseDuration("JOB_MAX_AGE", 30*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.ImageCacheSize, err = parseInt("IMAGE_CACHE_SIZE", 100); err != nil {
+		return nil, err
+	}
+	if config.ImageCacheMemoryMB, err = parseInt("IMAGE_CACHE_MEMORY_MB", 64); err != nil {
+		return nil, err
+	}
+	if config.ImageCacheTTL, err = parseDuration("IMAGE_CACHE_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if config.ImageCacheDiskMB, err = parseInt("IMAGE_CACHE_DISK_MB", 512); err != nil {
+		return nil, err
+	}
+	if config.OpenAIImageTimeout, err = parseDuration("OPENAI_IMAGE_TIMEOUT", 2*time.Minute); err != nil {
+		return nil, err
+	}
+	if config.CloudflareAISteps, err = parseInt("CLOUDFLARE_AI_STEPS", 4); err != nil {
+		return nil, err
+	}
+	if config.CloudflareAITimeout, err = parseDuration("CLOUDFLARE_AI_TIMEOUT", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if config.FusionBrainWidth, err = parseInt("FUSION_BRAIN_WIDTH", 1024); err != nil {
+		return nil, err
+	}
+	if config.FusionBrainHeight, err = parseInt("FUSION_BRAIN_HEIGHT", 1024); err != nil {
+		return nil, err
+	}
+	if config.FusionBrainModelRefresh, err = parseDuration("FUSION_BRAIN_MODEL_REFRESH", time.Hour); err != nil {
+		return nil, err
+	}
+	if config.StableDiffusionSteps, err = parseInt("STABLE_DIFFUSION_STEPS", 25); err != nil {
+		return nil, err
+	}
+	if config.StableDiffusionCFGScale, err = parseFloat("STABLE_DIFFUSION_CFG_SCALE", 7); err != nil {
+		return nil, err
+	}
+	if config.StableDiffusionWidth, err = parseInt("STABLE_DIFFUSION_WIDTH", 1024); err != nil {
+		return nil, err
+	}
+	if config.StableDiffusionHeight, err = parseInt("STABLE_DIFFUSION_HEIGHT", 1024); err != nil {
+		return nil, err
+	}
+	if config.StableDiffusionTimeout, err = parseDuration("STABLE_DIFFUSION_TIMEOUT", 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	if config.GIFFrames, err = parseInt("GIF_FRAMES", 24); err != nil {
+		return nil, err
+	}
+	if config.GIFFrameDelay, err = parseDuration("GIF_FRAME_DELAY", 80*time.Millisecond); err != nil {
+		return nil, err
+	}
+	if config.GIFMaxSide, err = parseInt("GIF_MAX_SIDE", 480); err != nil {
+		return nil, err
+	}
+	if config.GIFMaxBytes, err = parseInt("GIF_MAX_BYTES", 8<<20); err != nil {
+		return nil, err
 	}
 
 	// Проверяем наличие обязательных переменных
 	if config.TelegramToken == "" {
 		return nil, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
 	}
-	if config.YandexOAuthToken == "" {
-		return nil, fmt.Errorf("YANDEX_OAUTH_TOKEN not set")
-	}
-	if config.YandexArtFolderID == "" {
-		return nil, fmt.Errorf("YANDEX_ART_FOLDER_ID not set")
+	if config.usesYandexCloud() {
+		if config.YandexOAuthToken == "" {
+			return nil, fmt.Errorf("YANDEX_OAUTH_TOKEN not set")
+		}
+		if config.YandexArtFolderID == "" {
+			return nil, fmt.Errorf("YANDEX_ART_FOLDER_ID not set")
+		}
 	}
 
 	return config, nil
 }
+
+// usesYandexCloud сообщает, нужны ли учетные данные Yandex Cloud: для Yandex GPT
+// или для Yandex Art, явно указанного в IMAGE_PROVIDERS. При пустом IMAGE_PROVIDERS
+// Yandex Art включается, только если учетные данные заданы
+func (c *Config) usesYandexCloud() bool {
+	return slices.Contains(c.ImageProviders, "yandex_art") ||
+		slices.Contains(c.LLMProviders, "yandex_gpt")
+}
+
+// getEnv возвращает значение переменной окружения или значение по умолчанию, если она не задана
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// parseList разбирает список значений, разделенных запятыми.
+// Пустые элементы и пробелы по краям отбрасываются.
+func parseList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseDuration читает длительность из переменной окружения key.
+// Если переменная не задана, возвращается значение по умолчанию.
+func parseDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return duration, nil
+}
+
+// parseInt читает целое число из переменной окружения key.
+// Если переменная не задана, возвращается значение по умолчанию.
+func parseInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return number, nil
+}
+
+// parseFloat читает дробное число из переменной окружения key.
+// Если переменная не задана, возвращается значение по умолчанию.
+func parseFloat(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return number, nil
+}
+
+// parseInt64List читает список целых чисел, разделенных запятыми, из переменной окружения key
+func parseInt64List(key string) ([]int64, error) {
+	var result []int64
+	for _, item := range parseList(os.Getenv(key)) {
+		number, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		result = append(result, number)
+	}
+	return result, nil
+}
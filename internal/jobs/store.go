@@ -0,0 +1,235 @@
+// Package jobs хранит незавершенные задачи генерации мемов, чтобы после
+// перезапуска бота можно было продолжить их, а не терять запросы пользователей
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stage описывает этап, на котором находится задача
+type Stage string
+
+const (
+	// StageEnhancing - промпт пользователя улучшается через GPT
+	StageEnhancing Stage = "enhancing"
+	// StageGenerating - изображение генерируется провайдерами
+	StageGenerating Stage = "generating"
+)
+
+// Job is a meme generation request that has not been delivered yet
+type Job struct {
+	ID string `json:"id"`
+	// ChatID и MessageID - чат и сообщение пользователя с командой
+	ChatID    int64 `json:"chat_id"`
+	MessageID int   `json:"message_id"`
+	// ProcessingMessageID - сообщение "Генерирую мем...", которое нужно удалить
+	ProcessingMessageID int    `json:"processing_message_id,omitempty"`
+	UserName            string `json:"user_name,omitempty"`
+	// Prompt - исходный запрос пользователя
+	Prompt string `json:"prompt"`
+	// EnhancedPrompt и Caption - результат улучшения промпта
+	EnhancedPrompt string `json:"enhanced_prompt,omitempty"`
+	Caption        string `json:"caption,omitempty"`
+	Stage          Stage  `json:"stage"`
+	// Operations - идентификаторы операций у провайдеров: имя провайдера -> ID операции
+	// (operation ID у Yandex Art, UUID у FusionBrain)
+	Operations map[string]string `json:"operations,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// NewJob creates a job for a /meme command
+func NewJob(chatID int64, messageID int, userName, prompt string) *Job {
+	now := time.Now()
+	return &Job{
+		ID:        fmt.Sprintf("%d-%d", chatID, messageID),
+		ChatID:    chatID,
+		MessageID: messageID,
+		UserName:  userName,
+		Prompt:    prompt,
+		Stage:     StageEnhancing,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Store keeps pending jobs in a JSON file. Every change is written to disk
+// atomically (temporary file + rename), so a crash never leaves a half-written file.
+// A Store with an empty path keeps jobs in memory only.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewStore opens the job file at path, creating the directory if needed
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		jobs: make(map[string]*Job),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating job store directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading job store: %w", err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("decoding job store %s: %w", path, err)
+	}
+	for _, job := range jobs {
+		s.jobs[job.ID] = job
+	}
+	return s, nil
+}
+
+// Save adds or replaces a job
+func (s *Store) Save(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := job.clone()
+	saved.UpdatedAt = time.Now()
+	s.jobs[job.ID] = saved
+	return s.flush()
+}
+
+// Update applies fn to the stored job and saves it.
+// Missing jobs are ignored: they have already been completed.
+func (s *Store) Update(id string, fn func(job *Job)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	fn(job)
+	job.UpdatedAt = time.Now()
+	return s.flush()
+}
+
+// Delete removes a completed job
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return nil
+	}
+	delete(s.jobs, id)
+	return s.flush()
+}
+
+// List returns copies of all pending jobs, oldest first
+func (s *Store) List() []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs
+}
+
+// flush writes all jobs to disk. Must be called with the mutex held.
+func (s *Store) flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding jobs: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary job file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing jobs: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing jobs: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary job file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("replacing job file: %w", err)
+	}
+	return nil
+}
+
+// clone returns a deep copy of the job
+func (j *Job) clone() *Job {
+	clone := *j
+	if j.Operations != nil {
+		clone.Operations = make(map[string]string, len(j.Operations))
+		for provider, operationID := range j.Operations {
+			clone.Operations[provider] = operationID
+		}
+	}
+	return &clone
+}
+
+// Tracker records the progress of a single job in the store.
+// It satisfies the generation tracker interface of the service layer.
+type Tracker struct {
+	store *Store
+	id    string
+}
+
+// Tracker returns a tracker for the job with the given ID
+func (s *Store) Tracker(id string) *Tracker {
+	return &Tracker{store: s, id: id}
+}
+
+// PromptEnhanced stores the enhanced prompt and moves the job to the generation stage
+func (t *Tracker) PromptEnhanced(prompt, caption string) error {
+	return t.store.Update(t.id, func(job *Job) {
+		job.EnhancedPrompt = prompt
+		job.Caption = caption
+		job.Stage = StageGenerating
+	})
+}
+
+// OperationStarted stores the ID of an operation started by a provider
+func (t *Tracker) OperationStarted(provider, operationID string) error {
+	return t.store.Update(t.id, func(job *Job) {
+		if job.Operations == nil {
+			job.Operations = make(map[string]string)
+		}
+		job.Operations[provider] = operationID
+		job.Stage = StageGenerating
+	})
+}
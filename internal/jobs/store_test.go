@@ -0,0 +1,75 @@
+package jobs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/azalio/meme-bot/internal/jobs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "jobs.json")
+
+	store, err := jobs.NewStore(path)
+	assert.NoError(t, err)
+
+	job := jobs.NewJob(42, 7, "user", "кот в сапогах")
+	job.ProcessingMessageID = 8
+	assert.NoError(t, store.Save(job))
+
+	tracker := store.Tracker(job.ID)
+	assert.NoError(t, tracker.PromptEnhanced("cat in boots", "Мяу"))
+	assert.NoError(t, tracker.OperationStarted("yandex_art", "op-1"))
+	assert.NoError(t, tracker.OperationStarted("fusion_brain", "uuid-2"))
+
+	// Хранилище после "перезапуска" видит задачу со всеми этапами
+	reopened, err := jobs.NewStore(path)
+	assert.NoError(t, err)
+
+	pending := reopened.List()
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "42-7", pending[0].ID)
+	assert.Equal(t, int64(42), pending[0].ChatID)
+	assert.Equal(t, 8, pending[0].ProcessingMessageID)
+	assert.Equal(t, "cat in boots", pending[0].EnhancedPrompt)
+	assert.Equal(t, "Мяу", pending[0].Caption)
+	assert.Equal(t, jobs.StageGenerating, pending[0].Stage)
+	assert.Equal(t, map[string]string{"yandex_art": "op-1", "fusion_brain": "uuid-2"}, pending[0].Operations)
+
+	assert.NoError(t, reopened.Delete(job.ID))
+	reopened, err = jobs.NewStore(path)
+	assert.NoError(t, err)
+	assert.Empty(t, reopened.List())
+
+	// Временные файлы не остаются рядом с хранилищем
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestStore_UpdateOfCompletedJobIsIgnored(t *testing.T) {
+	store, err := jobs.NewStore("")
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Tracker("missing").OperationStarted("yandex_art", "op"))
+	assert.Empty(t, store.List())
+}
+
+func TestStore_ListReturnsCopies(t *testing.T) {
+	store, err := jobs.NewStore("")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save(jobs.NewJob(1, 1, "user", "prompt")))
+
+	store.List()[0].Prompt = "changed"
+	assert.Equal(t, "prompt", store.List()[0].Prompt)
+}
+
+func TestNewStore_CorruptedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{not json"), 0o600))
+
+	_, err := jobs.NewStore(path)
+	assert.Error(t, err)
+}
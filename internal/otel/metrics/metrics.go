@@ -59,6 +59,49 @@ var (
 	// Cloudflare AI metrics
 	CloudflareAISuccessCounter *Counter
 	CloudflareAIFailureCounter *Counter
+
+	// OpenAISuccessCounter и OpenAIFailureCounter подсчитывают генерации через
+	// OpenAI-совместимый API (/v1/images/generations).
+	OpenAISuccessCounter *Counter
+	OpenAIFailureCounter *Counter
+
+	// StableDiffusionSuccessCounter и StableDiffusionFailureCounter подсчитывают
+	// генерации на собственном сервере Stable Diffusion (AUTOMATIC1111 или ComfyUI).
+	StableDiffusionSuccessCounter *Counter
+	StableDiffusionFailureCounter *Counter
+
+	// MemeTemplateSuccessCounter и MemeTemplateFailureCounter подсчитывают
+	// мемы, нарисованные по встроенным шаблонам.
+	MemeTemplateSuccessCounter *Counter
+	MemeTemplateFailureCounter *Counter
+
+	// LLMFailures подсчитывает ошибки языковых моделей по бэкендам: yandex_gpt, openai, ollama.
+	LLMFailures *Counter
+	// LLMFallbacks подсчитывает ответы резервных языковых моделей, полученные после ошибки основной.
+	LLMFallbacks *Counter
+	// GPTParseFailures подсчитывает ответы GPT, которые не удалось разобрать, по причинам:
+	// no_json, invalid_json, missing_field, too_long.
+	GPTParseFailures *Counter
+
+	// CircuitBreakerState экспортирует состояние circuit breaker каждого провайдера:
+	// 0 - closed, 1 - open, 2 - half-open.
+	CircuitBreakerState *LabeledGauge
+	// CircuitBreakerRejections подсчитывает запросы, не отправленные провайдеру из-за открытого breaker.
+	CircuitBreakerRejections *Counter
+
+	// ImageRejections подсчитывает изображения, отклоненные после генерации, по причинам:
+	// censored, blank, placeholder, invalid_image.
+	ImageRejections *Counter
+
+	// RequestsCollapsed подсчитывает запросы, присоединившиеся к уже выполняющемуся
+	// одинаковому запросу, по этапам: enhance_prompt, generate_image.
+	RequestsCollapsed *Counter
+
+	// ImageCacheHits подсчитывает изображения, взятые из кэша, по уровням: memory, disk.
+	ImageCacheHits *Counter
+	// ImageCacheMisses подсчитывает запросы, не найденные в кэше: miss, bypass (кэш пропущен по просьбе пользователя).
+	ImageCacheMisses *Counter
+
 	ActiveGoroutines     *Gauge
 	MemoryUsage          *Gauge
 	OpenHTTPConnections  *Gauge
@@ -100,6 +143,9 @@ type Histogram struct {
 	histogram metric.Float64Histogram
 }
 
+// Gauge - датчик с одним значением. Как и у Counter, Histogram и LabeledGauge,
+// его методы допускают nil: глобальные метрики создает только InitMetrics,
+// а HandleCommand вызывает ActiveGoroutines.Inc/Dec и в тестах сервиса без метрик.
 type Gauge struct {
 	gauge metric.Float64ObservableGauge
 	value float64
@@ -128,23 +174,106 @@ func (mp *MetricProvider) NewGauge(name, description string) (*Gauge, error) {
 }
 
 func (g *Gauge) Set(value float64) {
+	if g == nil {
+		return
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.value = value
 }
 
 func (g *Gauge) Inc() {
+	if g == nil {
+		return
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.value++
 }
 
 func (g *Gauge) Dec() {
+	if g == nil {
+		return
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.value--
 }
 
+// LabeledGauge представляет собой набор датчиков, различающихся значением одного лейбла.
+// Используется, например, для экспорта состояния каждого провайдера.
+type LabeledGauge struct {
+	gauge    metric.Float64ObservableGauge
+	labelKey string
+	values   map[string]float64
+	funcs    map[string]func() float64
+	mu       sync.Mutex
+}
+
+// NewLabeledGauge создает датчик с лейблом labelKey
+func (mp *MetricProvider) NewLabeledGauge(name, description, labelKey string) (*LabeledGauge, error) {
+	gauge := &LabeledGauge{
+		labelKey: labelKey,
+		values:   make(map[string]float64),
+		funcs:    make(map[string]func() float64),
+	}
+
+	var err error
+	gauge.gauge, err = mp.meter.Float64ObservableGauge(
+		name,
+		metric.WithDescription(description),
+		metric.WithFloat64Callback(func(ctx context.Context, o metric.Float64Observer) error {
+			gauge.mu.Lock()
+			values := make(map[string]float64, len(gauge.values)+len(gauge.funcs))
+			for label, value := range gauge.values {
+				values[label] = value
+			}
+			funcs := make(map[string]func() float64, len(gauge.funcs))
+			for label, value := range gauge.funcs {
+				funcs[label] = value
+			}
+			gauge.mu.Unlock()
+
+			// Функции вызываются без блокировки: они могут брать собственные мьютексы
+			for label, value := range funcs {
+				values[label] = value()
+			}
+			for label, value := range values {
+				o.Observe(value, metric.WithAttributes(attribute.String(gauge.labelKey, label)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return gauge, nil
+}
+
+// Set устанавливает значение датчика для лейбла
+func (g *LabeledGauge) Set(label string, value float64) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[label] = value
+	delete(g.funcs, label)
+}
+
+// SetFunc задает функцию, которая вычисляет значение датчика для лейбла в момент
+// сбора метрик. Подходит для значений, которые меняются без явного события.
+func (g *LabeledGauge) SetFunc(label string, value func() float64) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.funcs[label] = value
+	delete(g.values, label)
+}
+
 // InitMetrics инициализирует систему метрик и настраивает экспорт в Prometheus.
 // Эта функция должна быть вызвана при старте приложения, до использования любых метрик.
 // Prometheus - это система мониторинга, которая будет собирать и хранить наши метрики.
@@ -318,6 +447,133 @@ func InitMetrics() (*MetricProvider, error) {
 		if err != nil {
 			log.Printf("Failed to create Cloudflare AI failure counter: %v", err)
 		}
+
+		// Инициализация счетчиков для OpenAI-совместимого API
+		OpenAISuccessCounter, err = mp.NewCounter(
+			"meme_bot_openai_success_total",
+			"Total number of successful image generations via OpenAI-compatible API",
+		)
+		if err != nil {
+			log.Printf("Failed to create OpenAI success counter: %v", err)
+		}
+
+		OpenAIFailureCounter, err = mp.NewCounter(
+			"meme_bot_openai_failure_total",
+			"Total number of failed image generations via OpenAI-compatible API",
+		)
+		if err != nil {
+			log.Printf("Failed to create OpenAI failure counter: %v", err)
+		}
+
+		// Инициализация счетчиков для Stable Diffusion
+		StableDiffusionSuccessCounter, err = mp.NewCounter(
+			"meme_bot_stable_diffusion_success_total",
+			"Total number of successful image generations via Stable Diffusion",
+		)
+		if err != nil {
+			log.Printf("Failed to create Stable Diffusion success counter: %v", err)
+		}
+
+		StableDiffusionFailureCounter, err = mp.NewCounter(
+			"meme_bot_stable_diffusion_failure_total",
+			"Total number of failed image generations via Stable Diffusion",
+		)
+		if err != nil {
+			log.Printf("Failed to create Stable Diffusion failure counter: %v", err)
+		}
+
+		// Инициализация счетчиков для шаблонных мемов
+		MemeTemplateSuccessCounter, err = mp.NewCounter(
+			"meme_bot_meme_template_success_total",
+			"Total number of memes rendered from templates",
+		)
+		if err != nil {
+			log.Printf("Failed to create meme template success counter: %v", err)
+		}
+
+		MemeTemplateFailureCounter, err = mp.NewCounter(
+			"meme_bot_meme_template_failure_total",
+			"Total number of failed meme template renders",
+		)
+		if err != nil {
+			log.Printf("Failed to create meme template failure counter: %v", err)
+		}
+
+		// Инициализация счетчиков языковых моделей
+		LLMFailures, err = mp.NewCounter(
+			"meme_bot_llm_failures_total",
+			"Total number of failed language model requests per backend",
+		)
+		if err != nil {
+			log.Printf("Failed to create LLM failures counter: %v", err)
+		}
+
+		LLMFallbacks, err = mp.NewCounter(
+			"meme_bot_llm_fallbacks_total",
+			"Total number of language model requests served by a fallback backend",
+		)
+		if err != nil {
+			log.Printf("Failed to create LLM fallbacks counter: %v", err)
+		}
+
+		GPTParseFailures, err = mp.NewCounter(
+			"meme_bot_gpt_parse_failures_total",
+			"Total number of GPT responses that could not be parsed, by reason",
+		)
+		if err != nil {
+			log.Printf("Failed to create GPT parse failures counter: %v", err)
+		}
+
+		// Инициализация метрик circuit breaker провайдеров
+		CircuitBreakerState, err = mp.NewLabeledGauge(
+			"meme_bot_circuit_breaker_state",
+			"Circuit breaker state per image provider (0 - closed, 1 - open, 2 - half-open)",
+			"provider",
+		)
+		if err != nil {
+			log.Printf("Failed to create circuit breaker state gauge: %v", err)
+		}
+
+		CircuitBreakerRejections, err = mp.NewCounter(
+			"meme_bot_circuit_breaker_rejections_total",
+			"Total number of provider calls skipped because the circuit breaker was open",
+		)
+		if err != nil {
+			log.Printf("Failed to create circuit breaker rejections counter: %v", err)
+		}
+
+		// Инициализация счетчика отклоненных изображений
+		ImageRejections, err = mp.NewCounter(
+			"meme_bot_image_rejections_total",
+			"Total number of generated images rejected as censored, blank, placeholder or invalid",
+		)
+		if err != nil {
+			log.Printf("Failed to create image rejections counter: %v", err)
+		}
+
+		RequestsCollapsed, err = mp.NewCounter(
+			"meme_bot_requests_collapsed_total",
+			"Total number of requests served by an identical in-flight request",
+		)
+		if err != nil {
+			log.Printf("Failed to create collapsed requests counter: %v", err)
+		}
+
+		ImageCacheHits, err = mp.NewCounter(
+			"meme_bot_image_cache_hits_total",
+			"Total number of images served from the image cache",
+		)
+		if err != nil {
+			log.Printf("Failed to create image cache hits counter: %v", err)
+		}
+
+		ImageCacheMisses, err = mp.NewCounter(
+			"meme_bot_image_cache_misses_total",
+			"Total number of image requests not served from the image cache",
+		)
+		if err != nil {
+			log.Printf("Failed to create image cache misses counter: %v", err)
+		}
 	})
 
 	return mp, nil
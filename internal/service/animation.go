@@ -0,0 +1,290 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// defaultAnimationFrames - число кадров GIF
+	defaultAnimationFrames = 24
+	// defaultAnimationFrameDelay - длительность одного кадра
+	defaultAnimationFrameDelay = 80 * time.Millisecond
+	// defaultAnimationMaxSide - большая сторона GIF в пикселях
+	defaultAnimationMaxSide = 480
+	// defaultAnimationMaxBytes - размер, в который должен уложиться GIF
+	defaultAnimationMaxBytes = 8 << 20
+	// maxAnimationKeyframes - сколько изображений можно сгенерировать для одной анимации
+	maxAnimationKeyframes = 4
+	// minAnimationSide - меньше этого GIF не уменьшается при подгонке размера файла
+	minAnimationSide = 160
+
+	// animationZoom - приближение в конце панорамы каждого кадра
+	animationZoom = 1.2
+	// animationTypingShare - доля анимации, за которую «печатается» подпись
+	animationTypingShare = 0.6
+)
+
+// AnimationConfig holds the parameters of animated memes
+type AnimationConfig struct {
+	// Frames - число кадров GIF
+	Frames int
+	// FrameDelay - длительность одного кадра
+	FrameDelay time.Duration
+	// MaxSide - большая сторона GIF в пикселях
+	MaxSide int
+	// MaxBytes - максимальный размер GIF; больший GIF уменьшается
+	MaxBytes int
+}
+
+// DefaultAnimationConfig returns the default animation parameters
+func DefaultAnimationConfig() AnimationConfig {
+	return AnimationConfig{
+		Frames:     defaultAnimationFrames,
+		FrameDelay: defaultAnimationFrameDelay,
+		MaxSide:    defaultAnimationMaxSide,
+		MaxBytes:   defaultAnimationMaxBytes,
+	}
+}
+
+// Animator turns still images into an animated GIF meme: a slow pan and zoom
+// over each image and a caption that is typed letter by letter
+type Animator struct {
+	cfg AnimationConfig
+}
+
+// NewAnimator creates an animator; zero or invalid parameters are replaced with defaults
+func NewAnimator(cfg AnimationConfig) *Animator {
+	defaults := DefaultAnimationConfig()
+	if cfg.Frames <= 0 {
+		cfg.Frames = defaults.Frames
+	}
+	if cfg.FrameDelay <= 0 {
+		cfg.FrameDelay = defaults.FrameDelay
+	}
+	if cfg.MaxSide <= 0 {
+		cfg.MaxSide = defaults.MaxSide
+	}
+	if cfg.MaxBytes <= 0 || cfg.MaxBytes > telegramMaxUploadBytes {
+		cfg.MaxBytes = defaults.MaxBytes
+	}
+	return &Animator{cfg: cfg}
+}
+
+// Render animates the keyframes and encodes the result as GIF. When the GIF
+// does not fit into MaxBytes it is rendered again at a smaller size.
+func (a *Animator) Render(keyframes []image.Image, caption string) ([]byte, error) {
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("no keyframes")
+	}
+
+	bounds := keyframes[0].Bounds()
+	width, height := fitDimensions(bounds.Dx(), bounds.Dy(), a.cfg.MaxSide)
+	for {
+		animation, err := a.render(keyframes, caption, width, height)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, animation); err != nil {
+			return nil, fmt.Errorf("encoding gif: %w", err)
+		}
+		if buf.Len() <= a.cfg.MaxBytes {
+			return buf.Bytes(), nil
+		}
+		if max(width, height) <= minAnimationSide {
+			return nil, fmt.Errorf("gif is too large: %d bytes at %dx%d", buf.Len(), width, height)
+		}
+		width, height = max(1, width*3/4), max(1, height*3/4)
+	}
+}
+
+// render draws all frames of the animation at the given size
+func (a *Animator) render(keyframes []image.Image, caption string, width, height int) (*gif.GIF, error) {
+	top, bottom := SplitCaption(caption)
+	topLength := utf8.RuneCountInString(strings.Join(strings.Fields(top), " "))
+	captionLength := topLength + utf8.RuneCountInString(strings.Join(strings.Fields(bottom), " "))
+	typingFrames := max(1, int(float64(a.cfg.Frames)*animationTypingShare))
+
+	// Каждому изображению достается равная часть кадров
+	perKeyframe := max(1, int(math.Ceil(float64(a.cfg.Frames)/float64(len(keyframes)))))
+	delay := max(1, int(a.cfg.FrameDelay/(10*time.Millisecond)))
+	animation := &gif.GIF{LoopCount: 0}
+
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < a.cfg.Frames; i++ {
+		keyframe := keyframes[min(i/perKeyframe, len(keyframes)-1)]
+		progress := float64(i%perKeyframe) / float64(max(1, perKeyframe-1))
+		draw.ApproxBiLinear.Scale(frame, frame.Bounds(), keyframe, panZoomRect(keyframe.Bounds(), width, height, progress), draw.Src, nil)
+
+		// Подпись «печатается» за первые typingFrames кадров и дальше видна целиком
+		visible := int(math.Ceil(float64(captionLength) * float64(i+1) / float64(typingFrames)))
+		if err := drawCaptionLines(frame, top, bottom, min(visible, topLength), max(0, visible-topLength)); err != nil {
+			return nil, err
+		}
+
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), frame, image.Point{})
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+	}
+	// Последний кадр задерживается, чтобы подпись успели дочитать
+	animation.Delay[len(animation.Delay)-1] = delay * 10
+	return animation, nil
+}
+
+// panZoomRect returns the part of src shown at the given progress (0..1):
+// the view zooms in from the whole image and drifts from left to right,
+// keeping the output aspect ratio
+func panZoomRect(src image.Rectangle, width, height int, progress float64) image.Rectangle {
+	// Самая большая область исходника с пропорциями кадра
+	viewWidth, viewHeight := float64(src.Dx()), float64(src.Dx())*float64(height)/float64(width)
+	if viewHeight > float64(src.Dy()) {
+		viewWidth, viewHeight = float64(src.Dy())*float64(width)/float64(height), float64(src.Dy())
+	}
+	zoom := 1 + (animationZoom-1)*progress
+	viewWidth, viewHeight = viewWidth/zoom, viewHeight/zoom
+
+	x := float64(src.Min.X) + (float64(src.Dx())-viewWidth)*progress
+	y := float64(src.Min.Y) + (float64(src.Dy())-viewHeight)/2
+	return image.Rect(int(x), int(y), int(x+viewWidth), int(y+viewHeight))
+}
+
+// drawCaptionLines draws the first topVisible characters of the top line and
+// the first bottomVisible characters of the bottom line in the meme style
+func drawCaptionLines(dst draw.Image, top, bottom string, topVisible, bottomVisible int) error {
+	width, height := dst.Bounds().Dx(), dst.Bounds().Dy()
+	margin := int(float64(width) * overlayMargin)
+	band := int(float64(height) * overlayBandHeight)
+	style := TextStyle{
+		Color:       color.White,
+		Outline:     color.Black,
+		MaxFontSize: float64(height) * overlayMaxFontSize,
+		Uppercase:   true,
+	}
+
+	if topVisible > 0 {
+		style.Align, style.Visible = TextAlignTop, topVisible
+		if err := DrawText(dst, image.Rect(margin, margin, width-margin, band), top, style); err != nil {
+			return err
+		}
+	}
+	if bottomVisible > 0 {
+		style.Align, style.Visible = TextAlignBottom, bottomVisible
+		if err := DrawText(dst, image.Rect(margin, height-band, width-margin, height-margin), bottom, style); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateAnimation handles the /gif command: the prompt is enhanced as for
+// /meme, one or several (--frames N) images are generated and animated with
+// the caption typed over them
+func (s *BotServiceImpl) GenerateAnimation(ctx context.Context, args string) (*MemeResult, error) {
+	metrics.CommandFrequency.Inc("gif")
+
+	args, opts := ParseMemeArgs(args)
+	if args == "" {
+		args = defaultMemePrompt
+	}
+
+	enhancedPrompt, caption, enhanceDuration := s.enhanceMemePrompt(ctx, args)
+
+	generationStart := time.Now()
+	first, keyframes, err := s.generateKeyframes(ctx, enhancedPrompt, opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.animator.Render(keyframes, caption)
+	if err != nil {
+		return nil, fmt.Errorf("rendering animation: %w", err)
+	}
+
+	generation := *first
+	generation.Image = data
+	generation.MIMEType = "image/gif"
+	return &MemeResult{
+		GenerationResult:   &generation,
+		Caption:            caption,
+		UserPrompt:         args,
+		EnhancedPrompt:     enhancedPrompt,
+		Options:            opts,
+		CaptionMode:        CaptionModeOverlay,
+		EnhanceDuration:    enhanceDuration,
+		GenerationDuration: time.Since(generationStart),
+	}, nil
+}
+
+// generateKeyframes generates opts.Frames images (one by default) with
+// consecutive seeds. The first keyframe picks the provider and describes the
+// whole animation; the others are generated in parallel by the same provider
+// and model, so that the frames look alike. Failed later keyframes are skipped.
+func (s *BotServiceImpl) generateKeyframes(ctx context.Context, prompt string, opts ImageOptions) (*GenerationResult, []image.Image, error) {
+	count := min(max(opts.Frames, 1), maxAnimationKeyframes)
+	seed := requestSeed(WithImageOptions(ctx, opts))
+	frameOptions := func(i int) ImageOptions {
+		frameOpts := opts
+		if count > 1 {
+			// Разные сиды дают разные кадры одной сцены
+			frameOpts.Seed = strconv.FormatInt(seed+int64(i), 10)
+		}
+		return frameOpts
+	}
+
+	first, err := s.artService.GenerateImage(WithImageOptions(ctx, frameOptions(0)), prompt)
+	if err != nil {
+		return nil, nil, err
+	}
+	firstFrame, _, err := image.Decode(bytes.NewReader(first.Image))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	results := make([]*GenerationResult, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 1; i < count; i++ {
+		frameOpts := frameOptions(i)
+		// Остальные кадры рисует тот же провайдер, иначе кадры не будут похожи друг на друга
+		frameOpts.Provider, frameOpts.Model = first.Provider, first.Model
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = s.artService.GenerateImage(WithImageOptions(ctx, frameOpts), prompt)
+		}()
+	}
+	wg.Wait()
+
+	keyframes := []image.Image{firstFrame}
+	for i := 1; i < count; i++ {
+		err := errs[i]
+		if err == nil {
+			img, _, decodeErr := image.Decode(bytes.NewReader(results[i].Image))
+			if decodeErr == nil {
+				keyframes = append(keyframes, img)
+				continue
+			}
+			err = fmt.Errorf("%w: %v", ErrInvalidImage, decodeErr)
+		}
+		s.logger.Warn(ctx, "Failed to generate animation keyframe", map[string]interface{}{
+			"error": err.Error(),
+			"frame": i,
+		})
+	}
+	return first, keyframes, nil
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// seedArtService рисует серое изображение и запоминает сиды и параметры запросов
+type seedArtService struct {
+	mu      sync.Mutex
+	seeds   []string
+	options []ImageOptions
+	// failSeed - сид, на котором генерация падает
+	failSeed string
+	photo    []byte
+}
+
+func (s *seedArtService) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	seed := imageOptions(ctx).Seed
+	s.mu.Lock()
+	s.seeds = append(s.seeds, seed)
+	s.options = append(s.options, imageOptions(ctx))
+	s.mu.Unlock()
+	if seed != "" && seed == s.failSeed {
+		return nil, errors.New("provider failed")
+	}
+	return &GenerationResult{Image: s.photo, MIMEType: "image/png", Provider: ProviderYandexArt, Model: "art", Seed: seed}, nil
+}
+
+// animationBotAPI не принимает анимации и запоминает отправленные сообщения
+type animationBotAPI struct {
+	fileBotAPI
+	rejectAnimation bool
+	sent            []tgbotapi.Chattable
+}
+
+func (b *animationBotAPI) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	b.sent = append(b.sent, c)
+	if _, ok := c.(tgbotapi.AnimationConfig); ok && b.rejectAnimation {
+		return tgbotapi.Message{}, errors.New("Bad Request: wrong file type")
+	}
+	return tgbotapi.Message{}, nil
+}
+
+func TestAnimator_Render(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testPhoto(t, 640, 480)))
+	assert.NoError(t, err)
+	animator := NewAnimator(AnimationConfig{Frames: 6, FrameDelay: 50 * time.Millisecond, MaxSide: 200})
+
+	data, err := animator.Render([]image.Image{img, img}, "Когда дедлайн завтра, а ты только открыл ноутбук")
+
+	assert.NoError(t, err)
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Len(t, decoded.Image, 6)
+	assert.Equal(t, 0, decoded.LoopCount, "the animation loops forever")
+	assert.Equal(t, []int{5, 5, 5, 5, 5, 50}, decoded.Delay, "the last frame is held")
+	assert.Equal(t, image.Rect(0, 0, 200, 150), decoded.Image[0].Bounds())
+	assert.Less(t, changedPixels(decoded.Image[0], decoded.Image[5], image.Rect(0, 0, 200, 150)), 200*150,
+		"the caption is typed, not redrawn")
+
+	_, err = animator.Render(nil, "кот")
+	assert.Error(t, err)
+}
+
+func TestAnimator_RenderShrinksToMaxBytes(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testPhoto(t, 640, 480)))
+	assert.NoError(t, err)
+
+	large, err := NewAnimator(AnimationConfig{Frames: 4, MaxSide: 480}).Render([]image.Image{img}, "кот")
+	assert.NoError(t, err)
+
+	limit := len(large) - 1
+	data, err := NewAnimator(AnimationConfig{Frames: 4, MaxSide: 480, MaxBytes: limit}).Render([]image.Image{img}, "кот")
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(data), limit)
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Less(t, decoded.Image[0].Bounds().Dx(), 480)
+
+	_, err = NewAnimator(AnimationConfig{Frames: 4, MaxSide: 480, MaxBytes: 100}).Render([]image.Image{img}, "кот")
+	assert.ErrorContains(t, err, "gif is too large")
+}
+
+func TestPanZoomRect(t *testing.T) {
+	src := image.Rect(0, 0, 800, 600)
+
+	assert.Equal(t, image.Rect(0, 0, 800, 600), panZoomRect(src, 400, 300, 0))
+	end := panZoomRect(src, 400, 300, 1)
+	assert.Equal(t, 800, end.Max.X, "the view drifts to the right edge")
+	assert.InDelta(t, 800/animationZoom, end.Dx(), 1)
+
+	// Квадратный кадр вырезается из середины широкого изображения
+	square := panZoomRect(src, 300, 300, 0)
+	assert.Equal(t, 600, square.Dx())
+	assert.Equal(t, 600, square.Dy())
+}
+
+func TestDrawText_Visible(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testPhoto(t, 400, 200)))
+	assert.NoError(t, err)
+	draw := func(visible int) *image.RGBA {
+		canvas := image.NewRGBA(img.Bounds())
+		copy(canvas.Pix, img.(*image.RGBA).Pix)
+		style := TextStyle{Color: image.White.C, Outline: image.Black.C, MaxFontSize: 40, Visible: visible}
+		assert.NoError(t, DrawText(canvas, image.Rect(10, 10, 390, 190), "КОТ В КОСМОСЕ", style))
+		return canvas
+	}
+
+	full := draw(0)
+	partial := draw(3)
+	assert.Greater(t, changedPixels(img, full, img.Bounds()), changedPixels(img, partial, img.Bounds()))
+	assert.Zero(t, changedPixels(partial, full, image.Rect(0, 0, 100, 200)), "visible letters stay in place")
+	assert.Equal(t, changedPixels(img, full, img.Bounds()), changedPixels(img, draw(100), img.Bounds()))
+}
+
+func TestBotService_GenerateAnimation(t *testing.T) {
+	art := &seedArtService{photo: testPhoto(t, 320, 240), failSeed: "101"}
+	svc := &BotServiceImpl{
+		logger:         newQuietLogger(),
+		artService:     art,
+		promptEnhancer: NewPromptEnhancer(newQuietLogger(), &templateGPT{}),
+		animator:       NewAnimator(AnimationConfig{Frames: 4, MaxSide: 160}),
+	}
+
+	meme, err := svc.GenerateAnimation(context.Background(), "--frames 3 --seed 100 кот")
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"100", "101", "102"}, art.seeds)
+	// Первый кадр выбирает провайдера, остальные рисует он же
+	assert.Equal(t, "100", art.seeds[0])
+	assert.Empty(t, art.options[0].Provider)
+	for _, opts := range art.options[1:] {
+		assert.Equal(t, ProviderYandexArt, opts.Provider)
+		assert.Equal(t, "art", opts.Model)
+	}
+	assert.Equal(t, "image/gif", meme.MIMEType)
+	assert.Equal(t, "100", meme.Seed, "the first successful keyframe describes the animation")
+	assert.Equal(t, CaptionModeOverlay, meme.CaptionMode)
+	_, err = gif.DecodeAll(bytes.NewReader(meme.Image))
+	assert.NoError(t, err)
+
+	art.failSeed, art.seeds = "", nil
+	_, err = svc.GenerateAnimation(context.Background(), "кот")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, art.seeds, "a single keyframe keeps the provider seed")
+
+	// Без первого кадра не из чего выбрать провайдера
+	art.failSeed, art.seeds = "100", nil
+	_, err = svc.GenerateAnimation(context.Background(), "--frames 3 --seed 100 кот")
+	assert.ErrorContains(t, err, "provider failed")
+	assert.Equal(t, []string{"100"}, art.seeds)
+}
+
+func TestBotService_SendAnimation(t *testing.T) {
+	animation := []byte("GIF89a")
+
+	t.Run("animation", func(t *testing.T) {
+		bot := &animationBotAPI{}
+		svc := &BotServiceImpl{logger: newQuietLogger(), Bot: bot}
+
+		assert.NoError(t, svc.SendAnimation(context.Background(), 1, animation, "кот"))
+		assert.Len(t, bot.sent, 1)
+		assert.IsType(t, tgbotapi.AnimationConfig{}, bot.sent[0])
+	})
+
+	t.Run("falls back to document", func(t *testing.T) {
+		bot := &animationBotAPI{rejectAnimation: true}
+		svc := &BotServiceImpl{logger: newQuietLogger(), Bot: bot}
+
+		assert.NoError(t, svc.SendAnimation(context.Background(), 1, animation, "кот"))
+		assert.Len(t, bot.sent, 2)
+		document, ok := bot.sent[1].(tgbotapi.DocumentConfig)
+		assert.True(t, ok)
+		assert.Equal(t, "кот", document.Caption)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		bot := &animationBotAPI{}
+		svc := &BotServiceImpl{logger: newQuietLogger(), Bot: bot}
+
+		err := svc.SendAnimation(context.Background(), 1, make([]byte, telegramMaxUploadBytes+1), "")
+		assert.ErrorContains(t, err, "animation is too large")
+		assert.Empty(t, bot.sent)
+	})
+}
@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/azalio/meme-bot/internal/config"
@@ -12,6 +14,13 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+const (
+	// defaultMemePrompt is used when a command comes without a prompt
+	defaultMemePrompt = "Придумай и опиши какой-нибудь мем. Используй любые свои фантазии. Используй современные злободневные тренды. Будь креативным!."
+	// telegramMaxUploadBytes is the Bot API limit for files sent by bots
+	telegramMaxUploadBytes = 50 << 20
+)
+
 // BotAPI interface defines the methods we need from telegram bot
 // This abstraction allows us to mock the Telegram API for testing and decouples
 // our service layer from the specific implementation of the Telegram API.
@@ -29,7 +38,12 @@ type BotServiceImpl struct {
 	logger         *logger.Logger          // Logger for structured logging
 	Bot            BotAPI                  // Abstraction of the Telegram API
 	artService     ImageGenerator          // Service for generating images
+	imageService   *ImageGenerationService // Provider orchestration behind artService
 	promptEnhancer *PromptEnhancer         // Service for enhancing prompts using GPT
+	captionMode    CaptionMode             // Default placement of the caption
+	httpClient     *http.Client            // Client for downloading files sent to the bot
+	fileEndpoint   string                  // Bot API file download URL format
+	animator       *Animator               // Renderer of animated memes
 	stopChan       chan struct{}           // Channel for graceful shutdown
 	updateChan     tgbotapi.UpdatesChannel // Channel for receiving Telegram updates
 }
@@ -41,7 +55,7 @@ func NewBotService(
 	cfg *config.Config,
 	log *logger.Logger,
 	auth YandexAuthService,
-	gpt YandexGPTService,
+	gpt GPTService,
 ) (*BotServiceImpl, error) {
 	// Initialize the Telegram bot API
 	bot, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
@@ -55,12 +69,31 @@ func NewBotService(
 	// Create PromptEnhancer service for improving user prompts
 	promptEnhancer := NewPromptEnhancer(log, gpt)
 
+	captionMode, err := ParseCaptionMode(cfg.CaptionMode)
+	if err != nil {
+		log.Warn(context.Background(), "Invalid caption mode, falling back to overlay", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	animator := NewAnimator(AnimationConfig{
+		Frames:     cfg.GIFFrames,
+		FrameDelay: cfg.GIFFrameDelay,
+		MaxSide:    cfg.GIFMaxSide,
+		MaxBytes:   cfg.GIFMaxBytes,
+	})
+
 	return &BotServiceImpl{
 		config:         cfg,
 		logger:         log,
 		Bot:            bot,
 		artService:     imageService,
+		imageService:   imageService,
 		promptEnhancer: promptEnhancer,
+		captionMode:    captionMode,
+		httpClient:     &http.Client{Timeout: fileDownloadTimeout},
+		fileEndpoint:   tgbotapi.FileEndpoint,
+		animator:       animator,
 		stopChan:       make(chan struct{}), // Initialize stop channel for graceful shutdown
 	}, nil
 }
@@ -77,6 +110,28 @@ func (s *BotServiceImpl) Stop() {
 	}
 }
 
+// ImageService returns the image generation service used by the bot.
+// It exposes provider health for readiness checks.
+func (s *BotServiceImpl) ImageService() *ImageGenerationService {
+	return s.imageService
+}
+
+// DefaultCaptionMode returns the configured caption placement used in chats
+// that have not chosen their own
+func (s *BotServiceImpl) DefaultCaptionMode() CaptionMode {
+	return s.captionMode
+}
+
+// IsAdmin reports whether the Telegram user may use administrative commands
+func (s *BotServiceImpl) IsAdmin(userID int64) bool {
+	for _, id := range s.config.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetUpdatesChan returns a channel for receiving updates from Telegram.
 // This method follows the Observer pattern, allowing the bot to react to incoming messages.
 func (s *BotServiceImpl) GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
@@ -86,7 +141,8 @@ func (s *BotServiceImpl) GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.U
 
 // HandleCommand processes bot commands using the Command pattern.
 // It currently supports the "meme" command, which generates an image based on the provided prompt.
-func (s *BotServiceImpl) HandleCommand(ctx context.Context, command string, args string) ([]byte, error, string) {
+// The result carries the image together with the provider, model, seed and stage timings.
+func (s *BotServiceImpl) HandleCommand(ctx context.Context, command string, args string) (*MemeResult, error) {
 	// Начинаем отсчет времени выполнения команды
 	startTime := time.Now()
 	defer func() {
@@ -101,34 +157,120 @@ func (s *BotServiceImpl) HandleCommand(ctx context.Context, command string, args
 	metrics.CommandFrequency.Inc(command)
 	switch command {
 	case "meme":
+		// Flags at the beginning of the arguments configure the generation
+		args, opts := ParseMemeArgs(args)
+		ctx = WithImageOptions(ctx, opts)
+
 		// Use a default prompt if none is provided
 		if args == "" {
-			args = "Придумай и опиши какой-нибудь мем. Используй любые свои фантазии. Используй современные злободневные тренды. Будь креативным!."
+			args = defaultMemePrompt
 		}
 
-		// Enhance the prompt using GPT
-		enhancedPrompt, caption, err := s.promptEnhancer.EnhancePrompt(ctx, args)
-		if err != nil {
-			s.logger.Error(ctx, "Failed to enhance prompt", map[string]interface{}{
-				"error": err.Error(),
-				"args":  args,
-			})
-			// Fallback to the original prompt in case of error
-			enhancedPrompt = args
-			caption = enhancedPrompt
-			
-			// Ensure caption length is within Telegram limits
-			if len(caption) > 1024 {
-				caption = caption[:1024]
+		enhancedPrompt, caption, enhanceDuration := s.enhanceMemePrompt(ctx, args)
+
+		// Persist the enhanced prompt, so a restart does not have to call GPT again
+		if tracker := generationTracker(ctx); tracker != nil {
+			if err := tracker.PromptEnhanced(enhancedPrompt, caption); err != nil {
+				s.logger.Warn(ctx, "Failed to track enhanced prompt", map[string]interface{}{
+					"error": err.Error(),
+				})
 			}
 		}
 
 		// Generate an image using the enhanced prompt
+		generationStart := time.Now()
 		image, err := s.artService.GenerateImage(ctx, enhancedPrompt)
-		return image, err, caption
+		if err != nil {
+			return nil, err
+		}
+
+		meme := &MemeResult{
+			GenerationResult:   image,
+			Caption:            caption,
+			UserPrompt:         args,
+			EnhancedPrompt:     enhancedPrompt,
+			Options:            opts,
+			EnhanceDuration:    enhanceDuration,
+			GenerationDuration: time.Since(generationStart),
+		}
+		s.applyCaptionMode(ctx, meme, s.resolveCaptionMode(ctx, opts))
+		return meme, nil
 	default:
-		return nil, fmt.Errorf("unknown command: %s", command), ""
+		return nil, fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+// ResumeMeme finishes a /meme command interrupted by a restart.
+// It waits for provider operations that had already been started; when there are
+// none it generates the image again from the enhanced prompt, and when the prompt
+// had not been enhanced yet it runs the whole command from scratch.
+func (s *BotServiceImpl) ResumeMeme(
+	ctx context.Context,
+	userPrompt, enhancedPrompt, caption string,
+	operations map[string]string,
+) (*MemeResult, error) {
+	if enhancedPrompt == "" {
+		return s.HandleCommand(ctx, "meme", userPrompt)
+	}
+	// В задаче хранятся аргументы команды вместе с флагами
+	prompt, opts := ParseMemeArgs(userPrompt)
+	if prompt == "" {
+		prompt = defaultMemePrompt
+	}
+	ctx = WithImageOptions(ctx, opts)
+
+	generationStart := time.Now()
+	image, err := s.imageService.ResumeImage(ctx, enhancedPrompt, operations)
+	if errors.Is(err, ErrNothingToResume) {
+		s.logger.Info(ctx, "No provider operations to resume, generating again", map[string]interface{}{
+			"operations": operations,
+		})
+		image, err = s.artService.GenerateImage(ctx, enhancedPrompt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	meme := &MemeResult{
+		GenerationResult:   image,
+		Caption:            caption,
+		UserPrompt:         prompt,
+		EnhancedPrompt:     enhancedPrompt,
+		Options:            opts,
+		GenerationDuration: time.Since(generationStart),
+	}
+	s.applyCaptionMode(ctx, meme, s.resolveCaptionMode(ctx, opts))
+	return meme, nil
+}
+
+// RerollMeme draws a previous meme again: the same enhanced prompt, caption,
+// provider and generation options, but a new random seed or the given one.
+// The cache is bypassed so that the same seed really regenerates the image.
+func (s *BotServiceImpl) RerollMeme(ctx context.Context, previous *MemeResult, seed string) (*MemeResult, error) {
+	metrics.CommandFrequency.Inc("reroll")
+
+	opts := previous.Options
+	opts.Provider = previous.Provider
+	opts.Seed = seed
+	opts.NoCache = true
+	ctx = WithImageOptions(ctx, opts)
+
+	generationStart := time.Now()
+	image, err := s.artService.GenerateImage(ctx, previous.EnhancedPrompt)
+	if err != nil {
+		return nil, err
 	}
+
+	meme := &MemeResult{
+		GenerationResult:   image,
+		Caption:            previous.Caption,
+		UserPrompt:         previous.UserPrompt,
+		EnhancedPrompt:     previous.EnhancedPrompt,
+		Options:            opts,
+		GenerationDuration: time.Since(generationStart),
+	}
+	s.applyCaptionMode(ctx, meme, s.resolveCaptionMode(ctx, opts))
+	return meme, nil
 }
 
 // SendMessage sends a text message to the specified chat.
@@ -138,6 +280,20 @@ func (s *BotServiceImpl) SendMessage(ctx context.Context, chatID int64, message
 	return s.Bot.Send(msg)
 }
 
+// photoFileName returns a file name whose extension matches the actual image format
+func photoFileName(photo []byte) string {
+	switch detectMIMEType(photo) {
+	case "image/png":
+		return "meme.png"
+	case "image/gif":
+		return "meme.gif"
+	case "image/webp":
+		return "meme.webp"
+	default:
+		return "meme.jpg"
+	}
+}
+
 // SendPhoto sends an image to the specified chat.
 // It includes validation for the photo data to prevent errors.
 func (s *BotServiceImpl) SendPhoto(ctx context.Context, chatID int64, photo []byte, caption string) error {
@@ -149,7 +305,7 @@ func (s *BotServiceImpl) SendPhoto(ctx context.Context, chatID int64, photo []by
 	}
 
 	photoMsg := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{
-		Name:  "meme.png",
+		Name:  photoFileName(photo),
 		Bytes: photo,
 	})
 
@@ -166,6 +322,43 @@ func (s *BotServiceImpl) SendPhoto(ctx context.Context, chatID int64, photo []by
 	return nil
 }
 
+// SendAnimation sends a GIF to the specified chat via sendAnimation, so that
+// Telegram plays it inline. When Telegram rejects the animation it is sent
+// as a document, which keeps the original file.
+func (s *BotServiceImpl) SendAnimation(ctx context.Context, chatID int64, animation []byte, caption string) error {
+	if len(animation) == 0 {
+		return fmt.Errorf("empty animation data")
+	}
+	if len(animation) > telegramMaxUploadBytes {
+		return fmt.Errorf("animation is too large: %d bytes, Telegram accepts up to %d", len(animation), telegramMaxUploadBytes)
+	}
+
+	// Ensure caption length is within Telegram limits
+	if len(caption) > 1024 {
+		caption = caption[:1024]
+	}
+	file := tgbotapi.FileBytes{Name: "meme.gif", Bytes: animation}
+
+	animationMsg := tgbotapi.NewAnimation(chatID, file)
+	animationMsg.Caption = caption
+	_, err := s.Bot.Send(animationMsg)
+	if err == nil {
+		return nil
+	}
+	s.logger.Warn(ctx, "Failed to send animation, sending it as a document", map[string]interface{}{
+		"error":   err.Error(),
+		"chat_id": chatID,
+		"size":    len(animation),
+	})
+
+	documentMsg := tgbotapi.NewDocument(chatID, file)
+	documentMsg.Caption = caption
+	if _, err := s.Bot.Send(documentMsg); err != nil {
+		return fmt.Errorf("failed to send animation: %w", err)
+	}
+	return nil
+}
+
 // DeleteMessage deletes a message by its ID.
 // This method provides a clean interface for message deletion.
 func (s *BotServiceImpl) DeleteMessage(ctx context.Context, chatID int64, messageID int) error {
@@ -176,3 +369,31 @@ func (s *BotServiceImpl) DeleteMessage(ctx context.Context, chatID int64, messag
 	}
 	return nil
 }
+
+// enhanceMemePrompt turns the user prompt into the image prompt and the caption
+// using GPT. A weighted prompt is the user's own composition, so GPT only writes
+// the caption for it. If GPT fails, the user prompt is used for both.
+func (s *BotServiceImpl) enhanceMemePrompt(ctx context.Context, args string) (enhancedPrompt, caption string, duration time.Duration) {
+	_, weighted := ParseWeightedPrompt(args)
+	start := time.Now()
+	enhancedPrompt, caption, err := s.promptEnhancer.EnhancePrompt(ctx, PlainPrompt(args))
+	duration = time.Since(start)
+	if weighted {
+		enhancedPrompt = args
+	}
+	if err != nil {
+		s.logger.Error(ctx, "Failed to enhance prompt", map[string]interface{}{
+			"error": err.Error(),
+			"args":  args,
+		})
+		// Fallback to the original prompt in case of error
+		enhancedPrompt = args
+		caption = PlainPrompt(args)
+
+		// Ensure caption length is within Telegram limits
+		if len(caption) > 1024 {
+			caption = caption[:1024]
+		}
+	}
+	return enhancedPrompt, caption, duration
+}
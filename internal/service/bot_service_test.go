@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBotService_RerollKeepsOptions(t *testing.T) {
+	art := &seedArtService{photo: testPhoto(t, 320, 180)}
+	svc := &BotServiceImpl{
+		logger:         newQuietLogger(),
+		artService:     art,
+		promptEnhancer: NewPromptEnhancer(newQuietLogger(), &templateGPT{}),
+		captionMode:    CaptionModeTelegram,
+	}
+
+	meme, err := svc.HandleCommand(context.Background(), "meme", "--ar 16:9 --overlay --seed 7 кот в космосе")
+	assert.NoError(t, err)
+	assert.Equal(t, "кот в космосе", meme.UserPrompt)
+	assert.Equal(t, CaptionModeOverlay, meme.CaptionMode)
+
+	rerolled, err := svc.RerollMeme(context.Background(), meme, "42")
+
+	assert.NoError(t, err)
+	if assert.Len(t, art.options, 2) {
+		options := art.options[1]
+		assert.Equal(t, "16:9", options.AspectRatio)
+		assert.Equal(t, CaptionModeOverlay, options.CaptionMode)
+		assert.Equal(t, ProviderYandexArt, options.Provider, "the reroll goes to the same provider")
+		assert.Equal(t, "42", options.Seed)
+		assert.True(t, options.NoCache)
+	}
+	assert.Equal(t, CaptionModeOverlay, rerolled.CaptionMode)
+
+	// Повторный /reroll по перерисованному мему сохраняет те же параметры
+	_, err = svc.RerollMeme(context.Background(), rerolled, "")
+	assert.NoError(t, err)
+	if assert.Len(t, art.options, 3) {
+		assert.Equal(t, "16:9", art.options[2].AspectRatio)
+		assert.Empty(t, art.options[2].Seed, "a new random seed")
+	}
+}
+
+func TestBotService_ResumeMemeParsesFlags(t *testing.T) {
+	art := &seedArtService{photo: testPhoto(t, 320, 180)}
+	svc := &BotServiceImpl{logger: newQuietLogger(), artService: art, captionMode: CaptionModeTelegram}
+	svc.imageService = NewImageGenerationServiceWithRegistry(newQuietLogger(), NewProviderRegistry())
+
+	meme, err := svc.ResumeMeme(context.Background(), "--ar 16:9 кот", "A cat", "Кот", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "кот", meme.UserPrompt, "the flags are not part of the prompt")
+	assert.Equal(t, "16:9", meme.Options.AspectRatio)
+	if assert.Len(t, art.options, 1) {
+		assert.Equal(t, "16:9", art.options[0].AspectRatio)
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CaptionMode defines where the meme caption goes
+type CaptionMode string
+
+const (
+	// CaptionModeTelegram - подпись только в подписи к фото Telegram
+	CaptionModeTelegram CaptionMode = "telegram"
+	// CaptionModeOverlay - подпись нарисована на изображении
+	CaptionModeOverlay CaptionMode = "overlay"
+	// CaptionModeBoth - подпись и на изображении, и в подписи к фото
+	CaptionModeBoth CaptionMode = "both"
+)
+
+// CaptionModes are the accepted caption modes
+var CaptionModes = []CaptionMode{CaptionModeOverlay, CaptionModeTelegram, CaptionModeBoth}
+
+const (
+	// overlayMinSplitWords - подписи короче этого числа слов целиком идут вниз
+	overlayMinSplitWords = 4
+	// overlayBandHeight - доля высоты изображения под верхнюю и нижнюю подписи
+	overlayBandHeight = 0.25
+	// overlayMargin - отступ текста от краев в долях ширины
+	overlayMargin = 0.03
+	// overlayMaxFontSize - максимальный размер шрифта в долях высоты изображения
+	overlayMaxFontSize = 0.1
+)
+
+// ParseCaptionMode converts a configuration value into a CaptionMode.
+// An empty value selects CaptionModeOverlay.
+func ParseCaptionMode(value string) (CaptionMode, error) {
+	switch mode := CaptionMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return CaptionModeOverlay, nil
+	case CaptionModeTelegram, CaptionModeOverlay, CaptionModeBoth:
+		return mode, nil
+	default:
+		return CaptionModeOverlay, fmt.Errorf("unknown caption mode: %q", value)
+	}
+}
+
+// Overlay reports whether the caption is drawn on the image
+func (m CaptionMode) Overlay() bool {
+	return m == CaptionModeOverlay || m == CaptionModeBoth
+}
+
+// TelegramCaption reports whether the caption is sent as the photo caption
+func (m CaptionMode) TelegramCaption() bool {
+	return !m.Overlay() || m == CaptionModeBoth
+}
+
+// captionModeKey is the context key of the chat caption mode
+type captionModeKey struct{}
+
+// WithCaptionMode returns a context carrying the caption mode of the chat.
+// The --caption flag of a request takes precedence over it.
+func WithCaptionMode(ctx context.Context, mode CaptionMode) context.Context {
+	return context.WithValue(ctx, captionModeKey{}, mode)
+}
+
+// resolveCaptionMode returns the caption mode of the request: the flag in
+// opts, the chat mode from ctx, or the configured default
+func (s *BotServiceImpl) resolveCaptionMode(ctx context.Context, opts ImageOptions) CaptionMode {
+	if opts.CaptionMode != "" {
+		return opts.CaptionMode
+	}
+	if mode, ok := ctx.Value(captionModeKey{}).(CaptionMode); ok && mode != "" {
+		return mode
+	}
+	return s.captionMode
+}
+
+// applyCaptionMode draws the caption onto the meme when the mode asks for it.
+// Template memes already carry their own text and are left as is. When the
+// overlay fails the caption falls back to Telegram, so the joke is not lost.
+func (s *BotServiceImpl) applyCaptionMode(ctx context.Context, meme *MemeResult, mode CaptionMode) {
+	meme.CaptionMode = mode
+	if !mode.Overlay() || strings.TrimSpace(meme.Caption) == "" {
+		return
+	}
+	if meme.Provider == ProviderMemeTemplate {
+		meme.CaptionMode = CaptionModeTelegram
+		return
+	}
+
+	data, err := OverlayCaption(meme.Image, meme.Caption)
+	if err != nil {
+		s.logger.Warn(ctx, "Failed to draw caption on image, sending it as text", map[string]interface{}{
+			"error":    err.Error(),
+			"provider": meme.Provider,
+		})
+		meme.CaptionMode = CaptionModeTelegram
+		return
+	}
+
+	// GenerationResult может лежать в кэше, поэтому меняем копию
+	generation := *meme.GenerationResult
+	generation.Image = data
+	generation.MIMEType = "image/jpeg"
+	meme.GenerationResult = &generation
+}
+
+// OverlayCaption draws the caption onto the image in the classic meme style
+// and returns the result as JPEG
+func OverlayCaption(data []byte, caption string) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	meme, err := DrawCaption(img, caption)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, meme, &jpeg.Options{Quality: defaultJPEGQuality}); err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DrawCaption draws the caption over a copy of img: white uppercase letters
+// with a black outline, split between the top and the bottom of the picture
+func DrawCaption(img image.Image, caption string) (image.Image, error) {
+	bounds := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := canvas.Bounds().Dx(), canvas.Bounds().Dy()
+	margin := int(float64(width) * overlayMargin)
+	band := int(float64(height) * overlayBandHeight)
+	style := TextStyle{
+		Color:       color.White,
+		Outline:     color.Black,
+		MaxFontSize: float64(height) * overlayMaxFontSize,
+		Uppercase:   true,
+	}
+
+	top, bottom := SplitCaption(caption)
+	style.Align = TextAlignTop
+	if err := DrawText(canvas, image.Rect(margin, margin, width-margin, band), top, style); err != nil {
+		return nil, err
+	}
+	style.Align = TextAlignBottom
+	if err := DrawText(canvas, image.Rect(margin, height-band, width-margin, height-margin), bottom, style); err != nil {
+		return nil, err
+	}
+	return canvas, nil
+}
+
+// SplitCaption splits a caption into the top and bottom lines of a meme.
+// An explicit line break wins; otherwise a long caption is split at the
+// punctuation mark closest to its middle, or at the middle word. Short
+// captions go to the bottom only.
+func SplitCaption(caption string) (top, bottom string) {
+	caption = strings.TrimSpace(caption)
+	if before, after, ok := strings.Cut(caption, "\n"); ok {
+		return strings.TrimSpace(before), strings.TrimSpace(after)
+	}
+
+	words := strings.Fields(caption)
+	if len(words) < overlayMinSplitWords {
+		return "", strings.Join(words, " ")
+	}
+
+	// Ищем границу между словами, ближайшую к середине; после знака препинания - лучше
+	total := utf8.RuneCountInString(strings.Join(words, " "))
+	best, bestScore := len(words)/2, total
+	position := 0
+	for i := 0; i < len(words)-1; i++ {
+		position += utf8.RuneCountInString(words[i]) + 1
+		score := abs(total/2 - position)
+		last, _ := utf8.DecodeLastRuneInString(words[i])
+		if unicode.IsPunct(last) {
+			// Знак препинания перевешивает отклонение от середины до четверти подписи
+			score -= total / 4
+		}
+		if score < bestScore {
+			best, bestScore = i+1, score
+		}
+	}
+	return strings.Join(words[:best], " "), strings.Join(words[best:], " ")
+}
+
+// abs returns the absolute value of x
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPhoto возвращает PNG заданного размера, залитый серым
+func testPhoto(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestSplitCaption(t *testing.T) {
+	tests := []struct {
+		caption    string
+		wantTop    string
+		wantBottom string
+	}{
+		{caption: "Понедельник", wantBottom: "Понедельник"},
+		{caption: "  когда пятница  ", wantBottom: "когда пятница"},
+		{caption: "Когда написал код\nи он сразу заработал", wantTop: "Когда написал код", wantBottom: "и он сразу заработал"},
+		{caption: "Когда дедлайн завтра, а ты только открыл ноутбук", wantTop: "Когда дедлайн завтра,", wantBottom: "а ты только открыл ноутбук"},
+		{caption: "один два три четыре пять шесть", wantTop: "один два три", wantBottom: "четыре пять шесть"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.caption, func(t *testing.T) {
+			top, bottom := SplitCaption(tt.caption)
+			assert.Equal(t, tt.wantTop, top)
+			assert.Equal(t, tt.wantBottom, bottom)
+		})
+	}
+}
+
+func TestParseCaptionMode(t *testing.T) {
+	mode, err := ParseCaptionMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, CaptionModeOverlay, mode)
+
+	mode, err = ParseCaptionMode(" Both ")
+	assert.NoError(t, err)
+	assert.Equal(t, CaptionModeBoth, mode)
+	assert.True(t, mode.Overlay())
+	assert.True(t, mode.TelegramCaption())
+
+	assert.False(t, CaptionModeOverlay.TelegramCaption())
+	assert.False(t, CaptionModeTelegram.Overlay())
+
+	_, err = ParseCaptionMode("sideways")
+	assert.Error(t, err)
+}
+
+func TestDrawCaption(t *testing.T) {
+	img, err := png.Decode(bytes.NewReader(testPhoto(t, 400, 400)))
+	assert.NoError(t, err)
+
+	meme, err := DrawCaption(img, "Когда дедлайн завтра, а ты только открыл ноутбук")
+
+	assert.NoError(t, err)
+	assert.Greater(t, changedPixels(img, meme, image.Rect(0, 0, 400, 100)), 100, "top line is drawn")
+	assert.Greater(t, changedPixels(img, meme, image.Rect(0, 300, 400, 400)), 100, "bottom line is drawn")
+	assert.Zero(t, changedPixels(img, meme, image.Rect(0, 100, 400, 300)), "the middle stays clean")
+}
+
+func TestBotService_ApplyCaptionMode(t *testing.T) {
+	photo := testPhoto(t, 320, 240)
+	svc := &BotServiceImpl{logger: newQuietLogger(), captionMode: CaptionModeOverlay}
+
+	newMeme := func(provider string, image []byte) *MemeResult {
+		return &MemeResult{
+			GenerationResult: &GenerationResult{Image: image, MIMEType: "image/png", Provider: provider},
+			Caption:          "Кот захватил клавиатуру",
+		}
+	}
+
+	t.Run("overlay", func(t *testing.T) {
+		meme := newMeme(ProviderYandexArt, photo)
+		original := meme.GenerationResult
+		mode := svc.resolveCaptionMode(context.Background(), ImageOptions{})
+
+		svc.applyCaptionMode(context.Background(), meme, mode)
+
+		assert.Equal(t, CaptionModeOverlay, meme.CaptionMode)
+		assert.Equal(t, "image/jpeg", meme.MIMEType)
+		_, err := jpeg.Decode(bytes.NewReader(meme.Image))
+		assert.NoError(t, err)
+		assert.Equal(t, photo, original.Image, "cached result is not modified")
+	})
+
+	t.Run("chat and request modes", func(t *testing.T) {
+		ctx := WithCaptionMode(context.Background(), CaptionModeTelegram)
+		assert.Equal(t, CaptionModeTelegram, svc.resolveCaptionMode(ctx, ImageOptions{}))
+		assert.Equal(t, CaptionModeBoth, svc.resolveCaptionMode(ctx, ImageOptions{CaptionMode: CaptionModeBoth}))
+
+		meme := newMeme(ProviderYandexArt, photo)
+		svc.applyCaptionMode(ctx, meme, CaptionModeTelegram)
+		assert.Equal(t, photo, meme.Image)
+	})
+
+	t.Run("template meme keeps its text", func(t *testing.T) {
+		meme := newMeme(ProviderMemeTemplate, photo)
+		svc.applyCaptionMode(context.Background(), meme, CaptionModeOverlay)
+		assert.Equal(t, CaptionModeTelegram, meme.CaptionMode)
+		assert.Equal(t, photo, meme.Image)
+	})
+
+	t.Run("broken image falls back to text", func(t *testing.T) {
+		meme := newMeme(ProviderYandexArt, []byte("not an image"))
+		svc.applyCaptionMode(context.Background(), meme, CaptionModeBoth)
+		assert.Equal(t, CaptionModeTelegram, meme.CaptionMode)
+		assert.Equal(t, []byte("not an image"), meme.Image)
+	})
+}
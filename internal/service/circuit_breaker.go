@@ -0,0 +1,203 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed - провайдер работает штатно, все запросы пропускаются
+	BreakerClosed BreakerState = iota
+	// BreakerOpen - провайдер считается сломанным, запросы не отправляются до конца cool-down
+	BreakerOpen
+	// BreakerHalfOpen - cool-down закончился, пропускается один пробный запрос
+	BreakerHalfOpen
+)
+
+// String returns a human readable breaker state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig holds circuit breaker thresholds
+type CircuitBreakerConfig struct {
+	// Window - количество последних вызовов, по которым считается доля ошибок
+	Window int
+	// MinRequests - минимальное количество вызовов в окне, после которого breaker может открыться
+	MinRequests int
+	// FailureRate - доля ошибок (0..1), при достижении которой breaker открывается
+	FailureRate float64
+	// Cooldown - время, в течение которого открытый breaker не пропускает запросы
+	Cooldown time.Duration
+}
+
+// DefaultCircuitBreakerConfig returns thresholds used when nothing is configured
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:      20,
+		MinRequests: 5,
+		FailureRate: 0.5,
+		Cooldown:    time.Minute,
+	}
+}
+
+// CircuitBreaker tracks the failure rate of a provider over a sliding window of
+// recent calls. When the rate exceeds the threshold the breaker opens and the
+// provider is skipped until the cool-down passes; after that a single probe call
+// is let through (half-open) and its outcome decides whether to close or re-open.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	cfg      CircuitBreakerConfig
+	state    BreakerState
+	outcomes []bool // true - успешный вызов
+	openedAt time.Time
+	probing  bool // в состоянии half-open уже выполняется пробный запрос
+
+	now           func() time.Time
+	onStateChange func(from, to BreakerState)
+}
+
+// NewCircuitBreaker creates a closed circuit breaker. onStateChange may be nil.
+func NewCircuitBreaker(cfg CircuitBreakerConfig, onStateChange func(from, to BreakerState)) *CircuitBreaker {
+	defaults := DefaultCircuitBreakerConfig()
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaults.MinRequests
+	}
+	if cfg.MinRequests > cfg.Window {
+		cfg.MinRequests = cfg.Window
+	}
+	if cfg.FailureRate <= 0 || cfg.FailureRate > 1 {
+		cfg.FailureRate = defaults.FailureRate
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaults.Cooldown
+	}
+
+	return &CircuitBreaker{
+		cfg:           cfg,
+		now:           time.Now,
+		onStateChange: onStateChange,
+	}
+}
+
+// Allow reports whether a call may be made. In the half-open state only one
+// probe is allowed at a time; the caller must report its outcome via Record
+// or give it back via Release.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.setState(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of an allowed call
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerHalfOpen:
+		b.probing = false
+		if success {
+			b.outcomes = nil
+			b.setState(BreakerClosed)
+			return
+		}
+		b.open()
+	case BreakerClosed:
+		b.outcomes = append(b.outcomes, success)
+		if len(b.outcomes) > b.cfg.Window {
+			b.outcomes = b.outcomes[len(b.outcomes)-b.cfg.Window:]
+		}
+		if len(b.outcomes) >= b.cfg.MinRequests && b.failureRate() >= b.cfg.FailureRate {
+			b.open()
+		}
+	}
+}
+
+// Release gives back an allowed call without an outcome, e.g. when the call
+// was cancelled because another provider won
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// State returns the current breaker state. An open breaker whose cool-down
+// has passed is reported as half-open, because the next call will be a probe.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.cfg.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// open switches the breaker to the open state. Caller must hold b.mu.
+func (b *CircuitBreaker) open() {
+	b.openedAt = b.now()
+	b.outcomes = nil
+	b.setState(BreakerOpen)
+}
+
+// failureRate returns the share of failed calls in the window. Caller must hold b.mu.
+func (b *CircuitBreaker) failureRate() float64 {
+	if len(b.outcomes) == 0 {
+		return 0
+	}
+	failures := 0
+	for _, success := range b.outcomes {
+		if !success {
+			failures++
+		}
+	}
+	return float64(failures) / float64(len(b.outcomes))
+}
+
+// setState changes the state and notifies the listener. Caller must hold b.mu.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.onStateChange != nil {
+		b.onStateChange(from, state)
+	}
+}
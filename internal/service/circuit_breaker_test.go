@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBreaker создает breaker с управляемыми часами
+func newTestBreaker(cfg CircuitBreakerConfig) (*CircuitBreaker, *time.Time) {
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(cfg, nil)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreaker_OpensOnFailureRate(t *testing.T) {
+	breaker, _ := newTestBreaker(CircuitBreakerConfig{
+		Window:      4,
+		MinRequests: 4,
+		FailureRate: 0.5,
+		Cooldown:    time.Minute,
+	})
+
+	breaker.Record(true)
+	breaker.Record(false)
+	breaker.Record(true)
+	assert.Equal(t, BreakerClosed, breaker.State(), "not enough requests yet")
+
+	breaker.Record(false)
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_HalfOpenProbe(t *testing.T) {
+	breaker, now := newTestBreaker(CircuitBreakerConfig{
+		Window:      2,
+		MinRequests: 2,
+		FailureRate: 1,
+		Cooldown:    time.Minute,
+	})
+	breaker.Record(false)
+	breaker.Record(false)
+	assert.False(t, breaker.Allow())
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+	assert.True(t, breaker.Allow(), "first probe is allowed")
+	assert.False(t, breaker.Allow(), "only one probe at a time")
+
+	// Отмененный пробный запрос не меняет состояние, но освобождает слот
+	breaker.Release()
+	assert.True(t, breaker.Allow())
+
+	// Неудачный пробный запрос снова открывает breaker
+	breaker.Record(false)
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+
+	// Удачный пробный запрос закрывает breaker
+	*now = now.Add(time.Minute)
+	assert.True(t, breaker.Allow())
+	breaker.Record(true)
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.True(t, breaker.Allow())
+}
+
+func TestCircuitBreaker_StateChangeCallback(t *testing.T) {
+	var transitions []string
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{Window: 1, MinRequests: 1, FailureRate: 1}, func(from, to BreakerState) {
+		transitions = append(transitions, from.String()+"->"+to.String())
+	})
+
+	breaker.Record(false)
+	assert.Equal(t, []string{"closed->open"}, transitions)
+}
@@ -1,98 +1,217 @@
 package service
 
 import (
-    "bytes"
-    "context"
-    "encoding/json"
-    "fmt"
-    "io"
-    "net/http"
-    "time"
-
-    "github.com/azalio/meme-bot/internal/otel/metrics"
-    "github.com/azalio/meme-bot/pkg/logger"
-    "go.opentelemetry.io/otel/attribute"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// cloudflareAIDefaultModel - модель Workers AI по умолчанию
+	cloudflareAIDefaultModel = "@cf/black-forest-labs/flux-1-schnell"
+	// cloudflareAIDefaultSteps - число шагов по умолчанию (flux-1-schnell допускает до 8)
+	cloudflareAIDefaultSteps = 4
+	// cloudflareAIDefaultTimeout - таймаут запроса к Worker или REST API
+	cloudflareAIDefaultTimeout = 30 * time.Second
+	// cloudflareAPIBaseURL - REST API Cloudflare
+	cloudflareAPIBaseURL = "https://api.cloudflare.com/client/v4"
+	// cloudflareAIMaxResponseBytes - ограничение размера ответа
+	cloudflareAIMaxResponseBytes = 32 << 20
 )
 
+// CloudflareAIConfig configures Cloudflare Workers AI. Either WorkerURL or
+// AccountID with APIToken must be set; the REST API is used when both are present.
+type CloudflareAIConfig struct {
+	// WorkerURL - адрес Worker из cloudflare/index.js
+	WorkerURL string
+	// WorkerSecret - общий секрет, передается Worker в заголовке Authorization: Bearer
+	WorkerSecret string
+	// AccountID и APIToken - доступ к REST API ai/run без Worker
+	AccountID string
+	APIToken  string
+	// Model - модель Workers AI, например @cf/black-forest-labs/flux-1-schnell
+	Model string
+	// Steps - число шагов генерации
+	Steps int
+	// Timeout - таймаут запроса
+	Timeout time.Duration
+}
+
+// CloudflareAIServiceImpl implements image generation with Cloudflare Workers AI,
+// either through our Worker or directly through the REST API
 type CloudflareAIServiceImpl struct {
-    logger    *logger.Logger
-    workerURL string
+	logger     *logger.Logger
+	cfg        CloudflareAIConfig
+	apiBaseURL string
+	client     *http.Client
+}
+
+// NewCloudflareAIService creates a Workers AI client; empty settings are
+// replaced with defaults. It fails when neither the Worker nor the REST API is configured.
+func NewCloudflareAIService(cfg CloudflareAIConfig, log *logger.Logger) (*CloudflareAIServiceImpl, error) {
+	if cfg.WorkerURL == "" && (cfg.AccountID == "" || cfg.APIToken == "") {
+		return nil, fmt.Errorf("neither Cloudflare worker URL nor account ID with API token is set")
+	}
+	if cfg.Model == "" {
+		cfg.Model = cloudflareAIDefaultModel
+	}
+	if cfg.Steps <= 0 {
+		cfg.Steps = cloudflareAIDefaultSteps
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cloudflareAIDefaultTimeout
+	}
+
+	return &CloudflareAIServiceImpl{
+		logger:     log,
+		cfg:        cfg,
+		apiBaseURL: cloudflareAPIBaseURL,
+		client:     &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// direct reports whether requests go to the REST API instead of the Worker
+func (s *CloudflareAIServiceImpl) direct() bool {
+	return s.cfg.AccountID != "" && s.cfg.APIToken != ""
+}
+
+// CloudflareAIResponse is the JSON envelope of the REST API ai/run.
+// Models that return binary images (e.g. Stable Diffusion XL) answer without it.
+type CloudflareAIResponse struct {
+	Result struct {
+		Image string `json:"image"`
+	} `json:"result"`
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
 }
 
-func NewCloudflareAIService(log *logger.Logger) *CloudflareAIServiceImpl {
-    return &CloudflareAIServiceImpl{
-        logger:    log,
-        workerURL: "https://snowy-sun-10f9.azalio.workers.dev/",
-    }
+func (s *CloudflareAIServiceImpl) GenerateImage(ctx context.Context, prompt string) (*GenerationResult, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", "cloudflare_ai"))
+	}()
+
+	body := map[string]interface{}{
+		"prompt": prompt,
+		"steps":  s.cfg.Steps,
+	}
+	url := s.cfg.WorkerURL
+	if s.direct() {
+		url = fmt.Sprintf("%s/accounts/%s/ai/run/%s", s.apiBaseURL, s.cfg.AccountID, s.cfg.Model)
+		// Flux называет параметр steps, модели Stable Diffusion - num_steps
+		if !strings.Contains(s.cfg.Model, "flux") {
+			delete(body, "steps")
+			body["num_steps"] = s.cfg.Steps
+		}
+	} else {
+		// Worker сам вызывает env.AI.run, ему нужно знать модель
+		body["model"] = s.cfg.Model
+	}
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		s.logger.Error(ctx, "Failed to marshal request", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("marshalling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		s.logger.Error(ctx, "Failed to create request", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case s.direct():
+		req.Header.Set("Authorization", "Bearer "+s.cfg.APIToken)
+	case s.cfg.WorkerSecret != "":
+		req.Header.Set("Authorization", "Bearer "+s.cfg.WorkerSecret)
+	}
+
+	s.logger.Debug(ctx, "Sending Cloudflare AI request", map[string]interface{}{
+		"model":  s.cfg.Model,
+		"steps":  s.cfg.Steps,
+		"direct": s.direct(),
+	})
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Error(ctx, "Request failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, cloudflareAIMaxResponseBytes))
+	if err != nil {
+		s.logger.Error(ctx, "Failed to read image data", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, fmt.Errorf("reading image data: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		s.logger.Error(ctx, "Unexpected status code", map[string]interface{}{
+			"status_code": resp.StatusCode,
+			"body":        truncateText(string(data), 200),
+		})
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateText(string(data), 200))
+	}
+
+	// Flux возвращает JSON с изображением в base64, остальные модели - бинарное изображение
+	imageData := data
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if imageData, err = s.decodeJSONImage(data); err != nil {
+			s.logger.Error(ctx, "Failed to decode image", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return nil, err
+		}
+	}
+
+	return &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Model:    s.cfg.Model,
+		Prompt:   prompt,
+		Attempts: 1,
+	}, nil
 }
 
-func (s *CloudflareAIServiceImpl) GenerateImage(ctx context.Context, prompt string) ([]byte, error) {
-    startTime := time.Now()
-    defer func() {
-        metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(), 
-            attribute.String("service", "cloudflare_ai"))
-    }()
-
-    requestBody, err := json.Marshal(map[string]interface{}{
-        "prompt": prompt,
-        "steps":  4,
-    })
-    if err != nil {
-        s.logger.Error(ctx, "Failed to marshal request", map[string]interface{}{
-            "error": err.Error(),
-        })
-        metrics.CloudflareAIFailureCounter.Inc("marshal_error")
-        return nil, fmt.Errorf("marshalling request: %w", err)
-    }
-
-    req, err := http.NewRequestWithContext(ctx, "POST", s.workerURL, bytes.NewBuffer(requestBody))
-    if err != nil {
-        s.logger.Error(ctx, "Failed to create request", map[string]interface{}{
-            "error": err.Error(),
-        })
-        metrics.CloudflareAIFailureCounter.Inc("request_error")
-        return nil, fmt.Errorf("creating request: %w", err)
-    }
-    req.Header.Set("Content-Type", "application/json")
-
-    client := &http.Client{Timeout: 30 * time.Second}
-    resp, err := client.Do(req)
-    if err != nil {
-        s.logger.Error(ctx, "Request failed", map[string]interface{}{
-            "error": err.Error(),
-        })
-        metrics.CloudflareAIFailureCounter.Inc("http_error")
-        return nil, fmt.Errorf("making request: %w", err)
-    }
-    defer resp.Body.Close()
-
-    if resp.StatusCode != http.StatusOK {
-        s.logger.Error(ctx, "Unexpected status code", map[string]interface{}{
-            "status_code": resp.StatusCode,
-        })
-        metrics.CloudflareAIFailureCounter.Inc("status_error")
-        return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-    }
-
-    // Read the binary image data directly
-    imageData, err := io.ReadAll(resp.Body)
-    if err != nil {
-        s.logger.Error(ctx, "Failed to read image data", map[string]interface{}{
-            "error": err.Error(),
-        })
-        metrics.CloudflareAIFailureCounter.Inc("read_error")
-        return nil, fmt.Errorf("reading image data: %w", err)
-    }
-
-    // Verify it's a valid JPEG image
-    if !bytes.HasPrefix(imageData, []byte{0xFF, 0xD8}) {
-        s.logger.Error(ctx, "Invalid JPEG image received", map[string]interface{}{
-            "data_length": len(imageData),
-        })
-        metrics.CloudflareAIFailureCounter.Inc("invalid_image")
-        return nil, fmt.Errorf("invalid JPEG image received")
-    }
-
-    metrics.CloudflareAISuccessCounter.Inc("success")
-    return imageData, nil
+// decodeJSONImage extracts a base64 image from a JSON response
+func (s *CloudflareAIServiceImpl) decodeJSONImage(data []byte) ([]byte, error) {
+	var response CloudflareAIResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		return nil, fmt.Errorf("workers AI error %d: %s", response.Errors[0].Code, response.Errors[0].Message)
+	}
+	if response.Result.Image == "" {
+		return nil, fmt.Errorf("response contains no image")
+	}
+
+	imageData, err := base64.StdEncoding.DecodeString(response.Result.Image)
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 image: %w", err)
+	}
+	return imageData, nil
 }
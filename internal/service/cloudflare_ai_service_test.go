@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudflareAIService_Worker(t *testing.T) {
+	image := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	server := newStubServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer worker-secret", r.Header.Get("Authorization"))
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "prompt", body["prompt"])
+		assert.Equal(t, "@cf/stabilityai/stable-diffusion-xl-base-1.0", body["model"])
+		assert.Equal(t, float64(8), body["steps"])
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(image)
+	}))
+
+	svc, err := NewCloudflareAIService(CloudflareAIConfig{
+		WorkerURL:    server.URL,
+		WorkerSecret: "worker-secret",
+		Model:        "@cf/stabilityai/stable-diffusion-xl-base-1.0",
+		Steps:        8,
+	}, newQuietLogger())
+	assert.NoError(t, err)
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, "@cf/stabilityai/stable-diffusion-xl-base-1.0", result.Model)
+}
+
+func TestCloudflareAIService_RESTAPI(t *testing.T) {
+	image := []byte("flux image")
+	server := newStubServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/accounts/account-id/ai/run/@cf/black-forest-labs/flux-1-schnell", r.URL.Path)
+		assert.Equal(t, "Bearer api-token", r.Header.Get("Authorization"))
+
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, float64(4), body["steps"])
+		assert.NotContains(t, body, "model")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"result": {"image": "` + base64.StdEncoding.EncodeToString(image) + `"}, "success": true, "errors": []}`))
+	}))
+
+	svc, err := NewCloudflareAIService(CloudflareAIConfig{
+		WorkerURL: "http://worker.invalid",
+		AccountID: "account-id",
+		APIToken:  "api-token",
+	}, newQuietLogger())
+	assert.NoError(t, err)
+	svc.apiBaseURL = server.URL
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, cloudflareAIDefaultModel, result.Model)
+}
+
+func TestCloudflareAIService_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		contains    string
+	}{
+		{"unauthorized", http.StatusUnauthorized, "text/plain", "Unauthorized", "unexpected status code 401"},
+		{"api error", http.StatusOK, "application/json", `{"success": false, "errors": [{"code": 5007, "message": "No such model"}]}`, "No such model"},
+		{"no image", http.StatusOK, "application/json", `{"result": {}, "success": true}`, "no image"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStubServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			svc, err := NewCloudflareAIService(CloudflareAIConfig{WorkerURL: server.URL}, newQuietLogger())
+			assert.NoError(t, err)
+
+			result, err := svc.GenerateImage(context.Background(), "prompt")
+
+			assert.Nil(t, result)
+			assert.ErrorContains(t, err, tt.contains)
+		})
+	}
+}
+
+func TestNewCloudflareAIService_RequiresEndpoint(t *testing.T) {
+	_, err := NewCloudflareAIService(CloudflareAIConfig{AccountID: "account-id"}, newQuietLogger())
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// FusionBrainAPIPipeline - API пайплайнов: key/api/v1/pipelines, pipeline/run, pipeline/status
+	FusionBrainAPIPipeline = "pipeline"
+	// FusionBrainAPIText2Image - прежнее API (по умолчанию): key/api/v1/models, text2image/run, text2image/status
+	FusionBrainAPIText2Image = "text2image"
+)
+
+// fusionBrainEndpoints describes one flavour of the FusionBrain API. Both
+// flavours share authentication, the run parameters and the status lifecycle
+// (INITIAL, PROCESSING, DONE, FAIL); they differ in paths and response shapes.
+type fusionBrainEndpoints struct {
+	// models - список моделей или пайплайнов
+	models string
+	// run - запуск генерации, ID модели передается в поле idField формы
+	run     string
+	idField string
+	// availability и status - функции, так как ID входит в путь или в query
+	availability func(id string) string
+	status       func(uuid string) string
+	// decodeModels и decodeStatus приводят ответы к общему виду
+	decodeModels func(body io.Reader) ([]FusionBrainModel, error)
+	decodeStatus func(body io.Reader) (StatusResponse, error)
+}
+
+// fusionBrainAPIs maps the FUSION_BRAIN_API setting to its endpoints
+var fusionBrainAPIs = map[string]fusionBrainEndpoints{
+	FusionBrainAPIPipeline: {
+		models:  "key/api/v1/pipelines",
+		run:     "key/api/v1/pipeline/run",
+		idField: "pipeline_id",
+		availability: func(id string) string {
+			return "key/api/v1/pipeline/" + url.PathEscape(id) + "/availability"
+		},
+		status: func(uuid string) string {
+			return "key/api/v1/pipeline/status/" + url.PathEscape(uuid)
+		},
+		decodeModels: decodePipelines,
+		decodeStatus: decodePipelineStatus,
+	},
+	FusionBrainAPIText2Image: {
+		models:  "key/api/v1/models",
+		run:     "key/api/v1/text2image/run",
+		idField: "model_id",
+		availability: func(id string) string {
+			return "key/api/v1/text2image/availability?model_id=" + url.QueryEscape(id)
+		},
+		status: func(uuid string) string {
+			return "key/api/v1/text2image/status/" + url.PathEscape(uuid)
+		},
+		decodeModels: decodeText2ImageModels,
+		decodeStatus: decodeText2ImageStatus,
+	},
+}
+
+// FusionBrainModel is a text2image model or a pipeline, whichever the API lists.
+// The text2image API numbers models, the pipeline API uses string IDs.
+type FusionBrainModel struct {
+	ID      string
+	Name    string
+	Version float64
+}
+
+// String returns the model name with its version, e.g. "Kandinsky 3.1"
+func (m FusionBrainModel) String() string {
+	return fmt.Sprintf("%s %v", m.Name, m.Version)
+}
+
+// FusionBrainPipeline is an entry of GET key/api/v1/pipelines
+type FusionBrainPipeline struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	NameEn      string  `json:"nameEn"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	Status      string  `json:"status"`
+	Version     float64 `json:"version"`
+}
+
+// PipelineStatusResponse is the answer of GET key/api/v1/pipeline/status/{uuid}
+type PipelineStatusResponse struct {
+	UUID   string `json:"uuid"`
+	Status string `json:"status"`
+	Result struct {
+		Files    []string `json:"files"`
+		Censored bool     `json:"censored"`
+	} `json:"result"`
+	Error string `json:"errorDescription,omitempty"`
+}
+
+// decodeText2ImageModels decodes the legacy model list
+func decodeText2ImageModels(body io.Reader) ([]FusionBrainModel, error) {
+	// Элемент GET key/api/v1/models
+	var models []struct {
+		ID      int     `json:"id"`
+		Name    string  `json:"name"`
+		Version float64 `json:"version"`
+	}
+	if err := json.NewDecoder(body).Decode(&models); err != nil {
+		return nil, err
+	}
+	result := make([]FusionBrainModel, len(models))
+	for i, model := range models {
+		result[i] = FusionBrainModel{ID: strconv.Itoa(model.ID), Name: model.Name, Version: model.Version}
+	}
+	return result, nil
+}
+
+// decodePipelines decodes the pipeline list, keeping active text-to-image pipelines
+func decodePipelines(body io.Reader) ([]FusionBrainModel, error) {
+	var pipelines []FusionBrainPipeline
+	if err := json.NewDecoder(body).Decode(&pipelines); err != nil {
+		return nil, err
+	}
+	var result []FusionBrainModel
+	for _, pipeline := range pipelines {
+		if pipeline.Type != "" && pipeline.Type != "TEXT2IMAGE" {
+			continue
+		}
+		if pipeline.Status != "" && pipeline.Status != "ACTIVE" {
+			continue
+		}
+		name := pipeline.NameEn
+		if name == "" {
+			name = pipeline.Name
+		}
+		result = append(result, FusionBrainModel{ID: pipeline.ID, Name: name, Version: pipeline.Version})
+	}
+	return result, nil
+}
+
+// decodeText2ImageStatus decodes the legacy generation status
+func decodeText2ImageStatus(body io.Reader) (StatusResponse, error) {
+	var response StatusResponse
+	err := json.NewDecoder(body).Decode(&response)
+	return response, err
+}
+
+// decodePipelineStatus decodes the pipeline generation status
+func decodePipelineStatus(body io.Reader) (StatusResponse, error) {
+	var response PipelineStatusResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return StatusResponse{}, err
+	}
+	return StatusResponse{
+		UUID:       response.UUID,
+		Status:     response.Status,
+		Images:     response.Result.Files,
+		Error:      response.Error,
+		IsCensored: response.Result.Censored,
+	}, nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFusionBrain имитирует FusionBrain в одном из вариантов API: text2image или пайплайны.
+// Пути и ответы другого варианта сервер не знает и отвечает на них 404.
+type fakeFusionBrain struct {
+	t   *testing.T
+	api string
+	// image - изображение, которое вернет генерация
+	image []byte
+	// pendingPolls - сколько опросов статуса генерация остается в PROCESSING
+	pendingPolls int
+	// unavailable - модель отключена из-за очереди
+	unavailable bool
+	// failure - описание ошибки генерации (пусто - генерация успешна)
+	failure string
+
+	mu      sync.Mutex
+	polls   map[string]int
+	queries []string
+}
+
+func newFakeFusionBrain(t *testing.T, api string) *fakeFusionBrain {
+	return &fakeFusionBrain{t: t, api: api, image: []byte("kandinsky"), polls: make(map[string]int)}
+}
+
+func (f *fakeFusionBrain) handler() http.Handler {
+	mux := http.NewServeMux()
+	switch f.api {
+	case FusionBrainAPIText2Image:
+		mux.HandleFunc("GET /key/api/v1/models", func(w http.ResponseWriter, r *http.Request) {
+			f.writeJSON(w, http.StatusOK, []map[string]interface{}{
+				{"id": 4, "name": "Kandinsky", "version": 3.1, "type": "TEXT2IMAGE"},
+			})
+		})
+		mux.HandleFunc("GET /key/api/v1/text2image/availability", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(f.t, "4", r.URL.Query().Get("model_id"))
+			f.writeJSON(w, http.StatusOK, map[string]string{"model_status": f.status()})
+		})
+		mux.HandleFunc("POST /key/api/v1/text2image/run", func(w http.ResponseWriter, r *http.Request) {
+			f.run(w, r, "model_id", "4")
+		})
+		mux.HandleFunc("GET /key/api/v1/text2image/status/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			f.checkStatus(w, r, func(images []string) interface{} {
+				return map[string]interface{}{"status": "DONE", "images": images, "censored": false}
+			})
+		})
+	case FusionBrainAPIPipeline:
+		mux.HandleFunc("GET /key/api/v1/pipelines", func(w http.ResponseWriter, r *http.Request) {
+			f.writeJSON(w, http.StatusOK, []map[string]interface{}{
+				{"id": "upscale-id", "name": "Апскейл", "nameEn": "Upscale", "type": "IMAGE2IMAGE", "status": "ACTIVE", "version": 1},
+				{"id": "kandinsky-id", "name": "Кандинский", "nameEn": "Kandinsky", "type": "TEXT2IMAGE", "status": "ACTIVE", "version": 3.1},
+			})
+		})
+		mux.HandleFunc("GET /key/api/v1/pipeline/kandinsky-id/availability", func(w http.ResponseWriter, r *http.Request) {
+			if f.unavailable {
+				f.writeJSON(w, http.StatusOK, map[string]string{"pipeline_status": "DISABLED_BY_QUEUE"})
+				return
+			}
+			f.writeJSON(w, http.StatusOK, map[string]string{})
+		})
+		mux.HandleFunc("POST /key/api/v1/pipeline/run", func(w http.ResponseWriter, r *http.Request) {
+			f.run(w, r, "pipeline_id", "kandinsky-id")
+		})
+		mux.HandleFunc("GET /key/api/v1/pipeline/status/{uuid}", func(w http.ResponseWriter, r *http.Request) {
+			f.checkStatus(w, r, func(images []string) interface{} {
+				return map[string]interface{}{
+					"status":         "DONE",
+					"result":         map[string]interface{}{"files": images, "censored": false},
+					"generationTime": 12,
+				}
+			})
+		})
+	}
+
+	// Все запросы к API должны быть подписаны ключами
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Key") != "Key key" || r.Header.Get("X-Secret") != "Secret secret" {
+			f.writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeFusionBrain) status() string {
+	if f.unavailable {
+		return "DISABLED_BY_QUEUE"
+	}
+	return "ACTIVE"
+}
+
+// run проверяет форму запуска генерации и ставит задачу в очередь
+func (f *fakeFusionBrain) run(w http.ResponseWriter, r *http.Request, idField, id string) {
+	if !assert.NoError(f.t, r.ParseMultipartForm(1<<20)) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	assert.Equal(f.t, id, r.FormValue(idField))
+
+	var params GenerateRequest
+	assert.NoError(f.t, json.Unmarshal([]byte(r.FormValue("params")), &params))
+	assert.Equal(f.t, "GENERATE", params.Type)
+	assert.Equal(f.t, 1, params.NumImages)
+
+	f.mu.Lock()
+	uuid := fmt.Sprintf("uuid-%d", len(f.queries)+1)
+	f.queries = append(f.queries, params.GenerateParams.Query)
+	f.polls[uuid] = 0
+	f.mu.Unlock()
+
+	f.writeJSON(w, http.StatusCreated, map[string]string{"uuid": uuid, "status": "INITIAL"})
+}
+
+// checkStatus отвечает PROCESSING первые pendingPolls раз, затем результатом в формате API
+func (f *fakeFusionBrain) checkStatus(w http.ResponseWriter, r *http.Request, done func(images []string) interface{}) {
+	uuid := r.PathValue("uuid")
+	f.mu.Lock()
+	polls, ok := f.polls[uuid]
+	f.polls[uuid] = polls + 1
+	f.mu.Unlock()
+
+	switch {
+	case !ok:
+		f.writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	case polls < f.pendingPolls:
+		f.writeJSON(w, http.StatusOK, map[string]string{"uuid": uuid, "status": "PROCESSING"})
+	case f.failure != "":
+		f.writeJSON(w, http.StatusOK, map[string]string{"uuid": uuid, "status": "FAIL", "errorDescription": f.failure})
+	default:
+		f.writeJSON(w, http.StatusOK, done([]string{base64.StdEncoding.EncodeToString(f.image)}))
+	}
+}
+
+func (f *fakeFusionBrain) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	assert.NoError(f.t, json.NewEncoder(w).Encode(body))
+}
+
+func newContractFusionBrainService(t *testing.T, fake *fakeFusionBrain) *FusionBrainServiceImpl {
+	t.Helper()
+	server := httptest.NewServer(fake.handler())
+	t.Cleanup(server.Close)
+
+	svc, err := NewFusionBrainService(FusionBrainConfig{
+		API:       fake.api,
+		APIKey:    "key",
+		SecretKey: "secret",
+		Model:     "Kandinsky",
+	}, newQuietLogger())
+	assert.NoError(t, err)
+	svc.baseURL = server.URL + "/"
+	svc.client = server.Client()
+	svc.poller = NewPoller(testPollConfig)
+	svc.modelPoller = NewPoller(testPollConfig)
+	return svc
+}
+
+func TestFusionBrainContract(t *testing.T) {
+	for _, api := range []string{FusionBrainAPIPipeline, FusionBrainAPIText2Image} {
+		t.Run(api, func(t *testing.T) {
+			t.Run("generate and resume", func(t *testing.T) {
+				fake := newFakeFusionBrain(t, api)
+				fake.pendingPolls = 2
+				svc := newContractFusionBrainService(t, fake)
+
+				tracker := &recordingTracker{}
+				ctx := withProviderName(WithGenerationTracker(context.Background(), tracker), ProviderFusionBrain)
+				result, err := svc.GenerateImage(ctx, "кот в космосе")
+
+				assert.NoError(t, err)
+				assert.Equal(t, fake.image, result.Image)
+				assert.Equal(t, "Kandinsky 3.1", result.Model)
+				assert.Equal(t, "кот в космосе", result.Prompt)
+				assert.False(t, result.Censored)
+				assert.Equal(t, 4, result.Attempts, "one start request and three status checks")
+				assert.Equal(t, []string{"кот в космосе"}, fake.queries)
+				assert.Equal(t, map[string]string{ProviderFusionBrain: "uuid-1"}, tracker.operations)
+
+				resumed, err := svc.ResumeImage(context.Background(), "uuid-1")
+				assert.NoError(t, err)
+				assert.Equal(t, fake.image, resumed.Image)
+
+				_, err = svc.ResumeImage(context.Background(), "missing")
+				assert.ErrorContains(t, err, "unexpected status code: 404")
+			})
+
+			t.Run("unavailable", func(t *testing.T) {
+				fake := newFakeFusionBrain(t, api)
+				fake.unavailable = true
+				svc := newContractFusionBrainService(t, fake)
+
+				_, err := svc.GenerateImage(context.Background(), "prompt")
+
+				assert.ErrorContains(t, err, "service unavailable")
+				assert.Empty(t, fake.queries)
+			})
+
+			t.Run("generation failed", func(t *testing.T) {
+				fake := newFakeFusionBrain(t, api)
+				fake.failure = "queue overflow"
+				svc := newContractFusionBrainService(t, fake)
+
+				_, err := svc.GenerateImage(context.Background(), "prompt")
+
+				assert.ErrorContains(t, err, "queue overflow")
+			})
+
+			t.Run("wrong keys", func(t *testing.T) {
+				fake := newFakeFusionBrain(t, api)
+				svc := newContractFusionBrainService(t, fake)
+				svc.cfg.SecretKey = "wrong"
+
+				_, err := svc.GenerateImage(context.Background(), "prompt")
+
+				assert.ErrorContains(t, err, "unexpected status code: 401")
+			})
+		})
+	}
+}
@@ -10,7 +10,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
-	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/azalio/meme-bot/internal/otel/metrics"
@@ -20,53 +21,108 @@ import (
 
 const (
 	fusionBrainBaseURL = "https://api-key.fusionbrain.ai/"
+	// fusionBrainDefaultSize - ширина и высота изображения по умолчанию
+	fusionBrainDefaultSize = 1024
+	// fusionBrainDefaultModelRefresh - как часто перечитывать список моделей
+	fusionBrainDefaultModelRefresh = time.Hour
 )
 
+// fusionBrainPollConfig configures status polling: Kandinsky usually needs
+// 30-60 seconds, so the first check happens after 10 seconds
+var fusionBrainPollConfig = PollConfig{
+	InitialDelay: 10 * time.Second,
+	Interval:     3 * time.Second,
+	MaxInterval:  15 * time.Second,
+	Multiplier:   1.5,
+	Jitter:       0.2,
+	Timeout:      10 * time.Minute,
+}
+
+// fusionBrainModelPollConfig retries the model list request: a network blip
+// must not disable the provider
+var fusionBrainModelPollConfig = PollConfig{
+	Interval:    time.Second,
+	MaxInterval: 5 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+	Timeout:     20 * time.Second,
+}
+
+// FusionBrainConfig configures the FusionBrain provider
+type FusionBrainConfig struct {
+	// API - FusionBrainAPIText2Image (по умолчанию) или FusionBrainAPIPipeline
+	API string
+	// APIKey и SecretKey - ключи доступа к API
+	APIKey    string
+	SecretKey string
+	// Model - название модели или пайплайна, например "Kandinsky" или "Kandinsky 3.1" (пусто - первая доступная)
+	Model string
+	// Style - стиль генерации, например ANIME или UHD (пусто - стиль по умолчанию)
+	Style string
+	// NegativePrompt - то, чего не должно быть на изображении
+	NegativePrompt string
+	// Width и Height - размер изображения
+	Width  int
+	Height int
+	// ModelRefresh - как часто перечитывать список моделей
+	ModelRefresh time.Duration
+}
+
 // FusionBrainServiceImpl implements image generation using FusionBrain API
 type FusionBrainServiceImpl struct {
-	logger    *logger.Logger
-	apiKey    string
-	secretKey string
-	modelID   int
+	logger      *logger.Logger
+	cfg         FusionBrainConfig
+	api         fusionBrainEndpoints
+	baseURL     string
+	client      *http.Client
+	poller      *Poller
+	modelPoller *Poller
+	now         func() time.Time
+
+	// mu защищает модель, найденную при первой генерации. Список моделей
+	// перечитывается, когда генерации нужна модель старше ModelRefresh
+	mu             sync.Mutex
+	model          *FusionBrainModel
+	modelFetchedAt time.Time
+	// modelFetches объединяет одновременные запросы списка моделей
+	modelFetches *flightGroup[FusionBrainModel]
 }
 
-// NewFusionBrainService creates a new instance of FusionBrainService
-func NewFusionBrainService(log *logger.Logger) *FusionBrainServiceImpl {
-	apiKey := os.Getenv("FUSION_BRAIN_API_KEY")
-	secretKey := os.Getenv("FUSION_BRAIN_SECRET_KEY")
-
-	if apiKey == "" || secretKey == "" {
-		log.Error(context.Background(), "Environment variables not set", map[string]interface{}{
-			"missing_vars": []string{"FUSION_BRAIN_API_KEY", "FUSION_BRAIN_SECRET_KEY"},
-			"service":      "fusion_brain",
-		})
-		return nil
+// NewFusionBrainService creates a new instance of FusionBrainService.
+// The model is resolved lazily on the first generation, so an API outage at
+// startup does not disable the provider.
+func NewFusionBrainService(cfg FusionBrainConfig, log *logger.Logger) (*FusionBrainServiceImpl, error) {
+	if cfg.APIKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("FusionBrain API key and secret key are required")
 	}
-
-	service := &FusionBrainServiceImpl{
-		logger:    log,
-		apiKey:    apiKey,
-		secretKey: secretKey,
+	if cfg.API == "" {
+		cfg.API = FusionBrainAPIText2Image
 	}
-
-	// Get model ID during initialization
-	modelID, err := service.getModel()
-	if err != nil {
-		log.Error(context.Background(), "Failed to get model ID", map[string]interface{}{
-			"error": err.Error(),
-		})
-		return nil
+	api, ok := fusionBrainAPIs[cfg.API]
+	if !ok {
+		return nil, fmt.Errorf("unknown FusionBrain API %q, expected %s or %s", cfg.API, FusionBrainAPIPipeline, FusionBrainAPIText2Image)
+	}
+	if cfg.Width <= 0 {
+		cfg.Width = fusionBrainDefaultSize
+	}
+	if cfg.Height <= 0 {
+		cfg.Height = fusionBrainDefaultSize
+	}
+	if cfg.ModelRefresh <= 0 {
+		cfg.ModelRefresh = fusionBrainDefaultModelRefresh
 	}
 
-	service.modelID = modelID
-	return service
-}
-
-type FusionBrainModel struct {
-	ID      int     `json:"id"`
-	Name    string  `json:"name"`
-	Version float64 `json:"version"`
-	Type    string  `json:"type"`
+	return &FusionBrainServiceImpl{
+		logger:       log,
+		cfg:          cfg,
+		api:          api,
+		baseURL:      fusionBrainBaseURL,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		poller:       NewPoller(fusionBrainPollConfig),
+		modelPoller:  NewPoller(fusionBrainModelPollConfig),
+		now:          time.Now,
+		modelFetches: newFlightGroup[FusionBrainModel](),
+	}, nil
 }
 
 type GenerateParams struct {
@@ -74,11 +130,13 @@ type GenerateParams struct {
 }
 
 type GenerateRequest struct {
-	Type           string         `json:"type"`
-	NumImages      int            `json:"numImages"`
-	Width          int            `json:"width"`
-	Height         int            `json:"height"`
-	GenerateParams GenerateParams `json:"generateParams"`
+	Type                  string         `json:"type"`
+	Style                 string         `json:"style,omitempty"`
+	NumImages             int            `json:"numImages"`
+	Width                 int            `json:"width"`
+	Height                int            `json:"height"`
+	NegativePromptDecoder string         `json:"negativePromptDecoder,omitempty"`
+	GenerateParams        GenerateParams `json:"generateParams"`
 }
 
 type GenerateResponse struct {
@@ -94,46 +152,129 @@ type StatusResponse struct {
 	IsCensored bool     `json:"censored"`
 }
 
-// getModel retrieves the available model ID
-func (s *FusionBrainServiceImpl) getModel() (int, error) {
-	req, err := http.NewRequest("GET", fusionBrainBaseURL+"key/api/v1/models", nil)
+// currentModel returns the model to generate with. The model list is
+// requested on first use and again by the first generation that finds the
+// model older than ModelRefresh; there is no background refresh. The list is
+// fetched without holding s.mu, concurrent callers share one request, and a
+// caller giving up does not cancel it for the others. Failed requests are
+// retried, and if a refresh still fails the previously found model is kept.
+func (s *FusionBrainServiceImpl) currentModel(ctx context.Context) (FusionBrainModel, error) {
+	s.mu.Lock()
+	if s.model != nil && s.now().Sub(s.modelFetchedAt) < s.cfg.ModelRefresh {
+		model := *s.model
+		s.mu.Unlock()
+		return model, nil
+	}
+	s.mu.Unlock()
+
+	model, _, err := s.modelFetches.Do(ctx, "models", func(ctx context.Context) (FusionBrainModel, error) {
+		model, attempts, err := Poll(ctx, s.modelPoller, func(ctx context.Context, attempt int) (FusionBrainModel, PollOutcome, error) {
+			return s.getModel(ctx)
+		})
+		if err != nil {
+			return FusionBrainModel{}, fmt.Errorf("getting model after %d attempts: %w", attempts, err)
+		}
+		return model, nil
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if s.model != nil {
+			s.logger.Warn(ctx, "Failed to refresh FusionBrain models, keeping the current one", map[string]interface{}{
+				"error": err.Error(),
+				"model": s.model.String(),
+			})
+			return *s.model, nil
+		}
+		return FusionBrainModel{}, err
+	}
+
+	if s.model == nil || s.model.ID != model.ID {
+		s.logger.Info(ctx, "Using FusionBrain model", map[string]interface{}{
+			"model_id": model.ID,
+			"model":    model.String(),
+		})
+	}
+	s.model = &model
+	s.modelFetchedAt = s.now()
+	return model, nil
+}
+
+// cachedModelName returns the name of the last known model, if any
+func (s *FusionBrainServiceImpl) cachedModelName() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.model == nil {
+		return ""
+	}
+	return s.model.String()
+}
+
+// getModel requests the model (pipeline) list once and picks the configured model
+func (s *FusionBrainServiceImpl) getModel(ctx context.Context) (FusionBrainModel, PollOutcome, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+s.api.models, nil)
 	if err != nil {
-		return 0, fmt.Errorf("creating request: %w", err)
+		return FusionBrainModel{}, PollTerminal, fmt.Errorf("creating request: %w", err)
 	}
 
 	s.addAuthHeaders(req)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("making request: %w", err)
+		return FusionBrainModel{}, PollRetryable, fmt.Errorf("making request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return FusionBrainModel{}, PollRetryable, err
+		}
+		return FusionBrainModel{}, PollTerminal, err
+	}
+
+	models, err := s.api.decodeModels(resp.Body)
+	if err != nil {
+		return FusionBrainModel{}, PollRetryable, fmt.Errorf("decoding response: %w", err)
 	}
 
-	var models []FusionBrainModel
-	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
-		return 0, fmt.Errorf("decoding response: %w", err)
+	model, err := selectFusionBrainModel(models, s.cfg.Model)
+	if err != nil {
+		return FusionBrainModel{}, PollTerminal, err
 	}
+	return model, PollDone, nil
+}
 
+// selectFusionBrainModel picks the model with the given name (with or without
+// version, case-insensitive) or the first one when name is empty
+func selectFusionBrainModel(models []FusionBrainModel, name string) (FusionBrainModel, error) {
 	if len(models) == 0 {
-		return 0, fmt.Errorf("no models available")
+		return FusionBrainModel{}, fmt.Errorf("no models available")
+	}
+	if name == "" {
+		return models[0], nil
 	}
 
-	return models[0].ID, nil
+	available := make([]string, len(models))
+	for i, model := range models {
+		if strings.EqualFold(model.Name, name) || strings.EqualFold(model.String(), name) {
+			return model, nil
+		}
+		available[i] = model.String()
+	}
+	return FusionBrainModel{}, fmt.Errorf("model %q not found, available: %s", name, strings.Join(available, ", "))
 }
 
 // addAuthHeaders adds the required authentication headers to the request
 func (s *FusionBrainServiceImpl) addAuthHeaders(req *http.Request) {
-	req.Header.Set("X-Key", "Key "+s.apiKey)
-	req.Header.Set("X-Secret", "Secret "+s.secretKey)
+	req.Header.Set("X-Key", "Key "+s.cfg.APIKey)
+	req.Header.Set("X-Secret", "Secret "+s.cfg.SecretKey)
 }
 
 // GenerateImage generates an image using FusionBrain API
-func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText string) ([]byte, error) {
+func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
 	if s == nil {
 		return nil, fmt.Errorf("FusionBrain service not initialized")
 	}
@@ -141,8 +282,16 @@ func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText s
 	s.logger.Info(ctx, "Starting FusionBrain image generation", map[string]interface{}{
 		"prompt_text": promptText,
 	})
+	model, err := s.currentModel(ctx)
+	if err != nil {
+		s.logger.Error(ctx, "Failed to resolve FusionBrain model", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil, err
+	}
+
 	// Check service availability
-	if available, err := s.checkAvailability(ctx); err != nil || !available {
+	if available, err := s.checkAvailability(ctx, model.ID); err != nil || !available {
 		s.logger.Error(ctx, "Service availability check failed", map[string]interface{}{
 			"error": err,
 		})
@@ -150,7 +299,7 @@ func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText s
 	}
 
 	// Start image generation
-	uuid, err := s.startImageGeneration(ctx, promptText)
+	uuid, err := s.startImageGeneration(ctx, model.ID, promptText)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to start image generation", map[string]interface{}{
 			"error":       err.Error(),
@@ -159,8 +308,16 @@ func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText s
 		return nil, fmt.Errorf("starting image generation: %w", err)
 	}
 
+	// Remember the UUID so the generation can be resumed after a restart
+	if err := trackOperation(ctx, uuid); err != nil {
+		s.logger.Warn(ctx, "Failed to track operation", map[string]interface{}{
+			"error": err.Error(),
+			"uuid":  uuid,
+		})
+	}
+
 	// Wait for the image and get result
-	imageData, err := s.waitForImageAndGet(ctx, uuid)
+	result, err := s.waitForImageAndGet(ctx, uuid)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to get generated image", map[string]interface{}{
 			"error": err.Error(),
@@ -173,16 +330,38 @@ func (s *FusionBrainServiceImpl) GenerateImage(ctx context.Context, promptText s
 		"uuid": uuid,
 	})
 
-	return imageData, nil
+	result.MIMEType = detectMIMEType(result.Image)
+	result.Model = model.String()
+	result.Prompt = promptText
+	result.Attempts++ // запрос на запуск генерации
+	return result, nil
+}
+
+// ResumeImage waits for a generation started earlier with the given UUID
+func (s *FusionBrainServiceImpl) ResumeImage(ctx context.Context, uuid string) (*GenerationResult, error) {
+	if s == nil {
+		return nil, fmt.Errorf("FusionBrain service not initialized")
+	}
+
+	s.logger.Info(ctx, "Resuming FusionBrain generation", map[string]interface{}{
+		"uuid": uuid,
+	})
+	result, err := s.waitForImageAndGet(ctx, uuid)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for image: %w", err)
+	}
+
+	result.MIMEType = detectMIMEType(result.Image)
+	result.Model = s.cachedModelName()
+	return result, nil
 }
 
-func (s *FusionBrainServiceImpl) checkAvailability(ctx context.Context) (bool, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET",
-		fmt.Sprintf(fusionBrainBaseURL+"key/api/v1/text2image/availability?model_id=%d", s.modelID), nil)
+func (s *FusionBrainServiceImpl) checkAvailability(ctx context.Context, modelID string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+s.api.availability(modelID), nil)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to create availability check request", map[string]interface{}{
 			"error":    err.Error(),
-			"modelID":  s.modelID,
+			"modelID":  modelID,
 			"service":  "fusion_brain",
 			"function": "checkAvailability",
 		})
@@ -191,12 +370,10 @@ func (s *FusionBrainServiceImpl) checkAvailability(ctx context.Context) (bool, e
 
 	s.addAuthHeaders(req)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-
 	s.logger.Debug(ctx, "Checking FusionBrain service availability", map[string]interface{}{
-		"modelID": s.modelID,
+		"modelID": modelID,
 	})
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to make availability request", map[string]interface{}{
 			"error": err.Error(),
@@ -216,36 +393,41 @@ func (s *FusionBrainServiceImpl) checkAvailability(ctx context.Context) (bool, e
 		return false, nil
 	}
 
+	// text2image отвечает model_status, API пайплайнов - pipeline_status
 	var status struct {
-		ModelStatus string `json:"model_status"`
+		ModelStatus    string `json:"model_status"`
+		PipelineStatus string `json:"pipeline_status"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
 		s.logger.Error(ctx, "Failed to decode availability response", map[string]interface{}{
 			"error":    err.Error(),
 			"service":  "fusion_brain",
 			"function": "checkAvailability",
-			"modelID":  s.modelID,
+			"modelID":  modelID,
 		})
 		return false, fmt.Errorf("decoding response: %w", err)
 	}
 
 	s.logger.Debug(ctx, "Retrieved model status", map[string]interface{}{
-		"model_status": status.ModelStatus,
+		"model_status":    status.ModelStatus,
+		"pipeline_status": status.PipelineStatus,
 	})
 
-	return status.ModelStatus != "DISABLED_BY_QUEUE", nil
+	return status.ModelStatus != "DISABLED_BY_QUEUE" && status.PipelineStatus != "DISABLED_BY_QUEUE", nil
 }
 
-func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, prompt string) (string, error) {
+func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, modelID string, prompt string) (string, error) {
 	startTime := time.Now()
 	defer func() {
 		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(), attribute.String("service", "fusion_brain"))
 	}()
 	params := GenerateRequest{
-		Type:      "GENERATE",
-		NumImages: 1,
-		Width:     1024,
-		Height:    1024,
+		Type:                  "GENERATE",
+		Style:                 s.cfg.Style,
+		NumImages:             1,
+		Width:                 s.cfg.Width,
+		Height:                s.cfg.Height,
+		NegativePromptDecoder: s.cfg.NegativePrompt,
 		GenerateParams: GenerateParams{
 			Query: prompt,
 		},
@@ -262,13 +444,14 @@ func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, promp
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	// Add model_id field
-	if err := writer.WriteField("model_id", fmt.Sprintf("%d", s.modelID)); err != nil {
-		s.logger.Error(ctx, "Failed to write model_id field", map[string]interface{}{
+	// Add model_id (pipeline_id) field
+	if err := writer.WriteField(s.api.idField, modelID); err != nil {
+		s.logger.Error(ctx, "Failed to write model ID field", map[string]interface{}{
 			"error":    err.Error(),
-			"model_id": s.modelID,
+			"field":    s.api.idField,
+			"model_id": modelID,
 		})
-		return "", fmt.Errorf("writing model_id: %w", err)
+		return "", fmt.Errorf("writing %s: %w", s.api.idField, err)
 	}
 
 	// Add params field with JSON content type
@@ -292,7 +475,7 @@ func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, promp
 	writer.Close()
 
 	req, err := http.NewRequestWithContext(ctx, "POST",
-		fusionBrainBaseURL+"key/api/v1/text2image/run", body)
+		s.baseURL+s.api.run, body)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to create generation request", map[string]interface{}{
 			"error": err.Error(),
@@ -303,8 +486,7 @@ func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, promp
 	s.addAuthHeaders(req)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to make generation request", map[string]interface{}{
 			"error": err.Error(),
@@ -342,108 +524,95 @@ func (s *FusionBrainServiceImpl) startImageGeneration(ctx context.Context, promp
 	return response.UUID, nil
 }
 
-func (s *FusionBrainServiceImpl) waitForImageAndGet(ctx context.Context, uuid string) ([]byte, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	maxAttempts := 60 // 10 minutes with 10-second intervals
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		select {
-		case <-ctx.Done():
-			s.logger.Error(ctx, "Operation cancelled", map[string]interface{}{
-				"error": ctx.Err().Error(),
-				"uuid":  uuid,
-			})
-			return nil, fmt.Errorf("operation cancelled: %w", ctx.Err())
-		case <-ticker.C:
-			s.logger.Debug(ctx, "Checking operation status", map[string]interface{}{
-				"attempt":      attempt + 1,
-				"max_attempts": maxAttempts,
-				"uuid":         uuid,
-			})
+// waitForImageAndGet polls the generation status until the image is ready.
+// Returns a partial result with the image, the censorship flag and the number of status requests made.
+func (s *FusionBrainServiceImpl) waitForImageAndGet(ctx context.Context, uuid string) (*GenerationResult, error) {
+	result, polls, err := Poll(ctx, s.poller, func(ctx context.Context, attempt int) (*GenerationResult, PollOutcome, error) {
+		return s.checkStatus(ctx, uuid, attempt)
+	})
+	if err != nil {
+		s.logger.Error(ctx, "Failed to wait for generation", map[string]interface{}{
+			"error":    err.Error(),
+			"uuid":     uuid,
+			"attempts": polls,
+		})
+		return nil, err
+	}
 
-			req, err := http.NewRequestWithContext(ctx, "GET",
-				fusionBrainBaseURL+"key/api/v1/text2image/status/"+uuid, nil)
-			if err != nil {
-				s.logger.Error(ctx, "Failed to create status request", map[string]interface{}{
-					"error": err.Error(),
-					"uuid":  uuid,
-				})
-				return nil, fmt.Errorf("creating status request: %w", err)
-			}
-
-			s.addAuthHeaders(req)
-
-			resp, err := client.Do(req)
-			if err != nil {
-				s.logger.Error(ctx, "Status request failed", map[string]interface{}{
-					"error": err.Error(),
-					"uuid":  uuid,
-				})
-				if ctx.Err() != nil {
-					return nil, fmt.Errorf("operation cancelled during request: %w", ctx.Err())
-				}
-				continue
-			}
-
-			var response StatusResponse
-			err = json.NewDecoder(resp.Body).Decode(&response)
-			resp.Body.Close()
-			if err != nil {
-				s.logger.Error(ctx, "Failed to decode status response", map[string]interface{}{
-					"error": err.Error(),
-					"uuid":  uuid,
-				})
-				if ctx.Err() != nil {
-					return nil, fmt.Errorf("operation cancelled during response reading: %w", ctx.Err())
-				}
-				continue
-			}
-
-			s.logger.Debug(ctx, "Received operation status", map[string]interface{}{
-				"status": response.Status,
-				"uuid":   uuid,
-			})
-			if response.Status == "DONE" {
-				if len(response.Images) == 0 {
-					s.logger.Error(ctx, "Operation completed but no images received", map[string]interface{}{
-						"uuid": uuid,
-					})
-					return nil, fmt.Errorf("operation completed but no images received")
-				}
-
-				imageData, err := base64.StdEncoding.DecodeString(response.Images[0])
-				if err != nil {
-					s.logger.Error(ctx, "Failed to decode base64 image", map[string]interface{}{
-						"error": err.Error(),
-						"uuid":  uuid,
-					})
-					return nil, fmt.Errorf("decoding base64 image: %w", err)
-				}
-
-				s.logger.Info(ctx, "Image generation completed successfully", map[string]interface{}{
-					"uuid": uuid,
-				})
-				return imageData, nil
-			} else if response.Status == "FAIL" {
-				s.logger.Error(ctx, "Generation failed", map[string]interface{}{
-					"error": response.Error,
-					"uuid":  uuid,
-				})
-				return nil, fmt.Errorf("generation failed: %s", response.Error)
-			}
-
-			s.logger.Debug(ctx, "Generation in progress", map[string]interface{}{
-				"status": response.Status,
-				"uuid":   uuid,
-			})
+	if result.Censored {
+		// Вместо изображения FusionBrain возвращает заглушку цензуры
+		s.logger.Warn(ctx, "Generated image was censored", map[string]interface{}{
+			"uuid": uuid,
+		})
+	}
+	s.logger.Info(ctx, "Image generation completed successfully", map[string]interface{}{
+		"uuid":     uuid,
+		"censored": result.Censored,
+		"attempts": polls,
+	})
+	result.Attempts = polls
+	return result, nil
+}
+
+// checkStatus performs a single generation status request
+func (s *FusionBrainServiceImpl) checkStatus(ctx context.Context, uuid string, attempt int) (*GenerationResult, PollOutcome, error) {
+	s.logger.Debug(ctx, "Checking operation status", map[string]interface{}{
+		"attempt": attempt,
+		"uuid":    uuid,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+s.api.status(uuid), nil)
+	if err != nil {
+		return nil, PollTerminal, fmt.Errorf("creating status request: %w", err)
+	}
+	s.addAuthHeaders(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Warn(ctx, "Status request failed", map[string]interface{}{
+			"error":   err.Error(),
+			"uuid":    uuid,
+			"attempt": attempt,
+		})
+		return nil, PollRetryable, fmt.Errorf("status request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return nil, PollRetryable, err
 		}
+		return nil, PollTerminal, err
 	}
 
-	s.logger.Error(ctx, "Operation timed out", map[string]interface{}{
-		"attempts": maxAttempts,
-		"uuid":     uuid,
+	response, err := s.api.decodeStatus(resp.Body)
+	if err != nil {
+		s.logger.Warn(ctx, "Failed to decode status response", map[string]interface{}{
+			"error":   err.Error(),
+			"uuid":    uuid,
+			"attempt": attempt,
+		})
+		return nil, PollRetryable, fmt.Errorf("decoding status response: %w", err)
+	}
+
+	s.logger.Debug(ctx, "Received operation status", map[string]interface{}{
+		"status": response.Status,
+		"uuid":   uuid,
 	})
-	return nil, fmt.Errorf("operation timed out after %d attempts", maxAttempts)
+	switch response.Status {
+	case "DONE":
+		if len(response.Images) == 0 {
+			return nil, PollTerminal, fmt.Errorf("operation completed but no images received")
+		}
+		imageData, err := base64.StdEncoding.DecodeString(response.Images[0])
+		if err != nil {
+			return nil, PollTerminal, fmt.Errorf("decoding base64 image: %w", err)
+		}
+		return &GenerationResult{Image: imageData, Censored: response.IsCensored}, PollDone, nil
+	case "FAIL":
+		return nil, PollTerminal, fmt.Errorf("generation failed: %s", response.Error)
+	default:
+		return nil, PollPending, nil
+	}
 }
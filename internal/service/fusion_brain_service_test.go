@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFusionBrainService(t *testing.T, handler http.Handler) *FusionBrainServiceImpl {
+	t.Helper()
+	server := newStubServer(t, handler)
+
+	svc, err := NewFusionBrainService(FusionBrainConfig{
+		API:       FusionBrainAPIText2Image,
+		APIKey:    "key",
+		SecretKey: "secret",
+	}, newQuietLogger())
+	assert.NoError(t, err)
+	svc.baseURL = server.URL + "/"
+	svc.client = server.Client()
+	svc.poller = NewPoller(testPollConfig)
+	svc.modelPoller = NewPoller(testPollConfig)
+	return svc
+}
+
+// fusionBrainModels отдает список моделей FusionBrain
+func fusionBrainModels(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+		{"id": 4, "name": "Kandinsky", "version": 3.1, "type": "TEXT2IMAGE"},
+		{"id": 5, "name": "Kandinsky Turbo", "version": 3.2, "type": "TEXT2IMAGE"},
+	})
+}
+
+// fusionBrainStatusHandler отдает статусы генерации по очереди, повторяя последний
+func fusionBrainStatusHandler(t *testing.T, statuses ...interface{}) http.Handler {
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /key/api/v1/models", fusionBrainModels)
+	mux.HandleFunc("GET /key/api/v1/text2image/availability", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "4", r.URL.Query().Get("model_id"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"model_status": "ACTIVE"})
+	})
+	mux.HandleFunc("POST /key/api/v1/text2image/run", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Key key", r.Header.Get("X-Key"))
+		assert.Equal(t, "Secret secret", r.Header.Get("X-Secret"))
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "4", r.FormValue("model_id"))
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"uuid": "uuid-1", "status": "INITIAL"})
+	})
+	mux.HandleFunc("GET /key/api/v1/text2image/status/uuid-1", func(w http.ResponseWriter, r *http.Request) {
+		index := min(int(polls.Add(1)), len(statuses)) - 1
+		if code, ok := statuses[index].(int); ok {
+			w.WriteHeader(code)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(statuses[index])
+	})
+	return mux
+}
+
+func TestFusionBrainService_PollsUntilDone(t *testing.T) {
+	image := []byte("kandinsky")
+	svc := newTestFusionBrainService(t, fusionBrainStatusHandler(t,
+		map[string]interface{}{"uuid": "uuid-1", "status": "INITIAL"},
+		http.StatusServiceUnavailable,
+		map[string]interface{}{"uuid": "uuid-1", "status": "PROCESSING"},
+		map[string]interface{}{
+			"uuid":     "uuid-1",
+			"status":   "DONE",
+			"images":   []string{base64.StdEncoding.EncodeToString(image)},
+			"censored": true,
+		},
+	))
+
+	tracker := &recordingTracker{}
+	ctx := withProviderName(WithGenerationTracker(context.Background(), tracker), ProviderFusionBrain)
+	result, err := svc.GenerateImage(ctx, "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.True(t, result.Censored)
+	assert.Equal(t, "Kandinsky 3.1", result.Model)
+	assert.Equal(t, 5, result.Attempts, "one start request and four status checks")
+	assert.Equal(t, map[string]string{ProviderFusionBrain: "uuid-1"}, tracker.operations)
+}
+
+func TestFusionBrainService_GenerationFailed(t *testing.T) {
+	svc := newTestFusionBrainService(t, fusionBrainStatusHandler(t,
+		map[string]interface{}{"uuid": "uuid-1", "status": "FAIL", "errorDescription": "queue overflow"},
+	))
+
+	_, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.ErrorContains(t, err, "queue overflow")
+}
+
+func TestFusionBrainService_Timeout(t *testing.T) {
+	svc := newTestFusionBrainService(t, fusionBrainStatusHandler(t,
+		map[string]interface{}{"uuid": "uuid-1", "status": "PROCESSING"},
+	))
+	svc.poller = NewPoller(PollConfig{Interval: testPollConfig.Interval, Timeout: 20 * testPollConfig.Interval})
+
+	_, err := svc.ResumeImage(context.Background(), "uuid-1")
+
+	assert.ErrorIs(t, err, ErrPollTimeout)
+}
+
+func TestFusionBrainService_LazyModelWithRetryAndRefresh(t *testing.T) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /key/api/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			// Временный сбой при первом обращении не отключает провайдера
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			fusionBrainModels(w, r)
+		default:
+			_ = json.NewEncoder(w).Encode([]map[string]interface{}{{"id": 6, "name": "Kandinsky Turbo", "version": 4}})
+		}
+	})
+	svc := newTestFusionBrainService(t, mux)
+	svc.cfg.Model = "kandinsky turbo"
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	model, err := svc.currentModel(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "5", model.ID)
+	assert.Equal(t, "Kandinsky Turbo 3.2", model.String())
+	assert.Equal(t, int32(2), requests.Load())
+
+	// До истечения ModelRefresh список моделей не запрашивается
+	_, err = svc.currentModel(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	now = now.Add(fusionBrainDefaultModelRefresh)
+	model, err = svc.currentModel(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "6", model.ID)
+}
+
+func TestFusionBrainService_ModelFetchIsShared(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /key/api/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		fusionBrainModels(w, r)
+	})
+	svc := newTestFusionBrainService(t, mux)
+
+	// Первый вызывающий сдается, пока список моделей еще загружается
+	ctx, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := svc.currentModel(ctx)
+		firstDone <- err
+	}()
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	secondDone := make(chan FusionBrainModel, 1)
+	go func() {
+		model, err := svc.currentModel(context.Background())
+		assert.NoError(t, err)
+		secondDone <- model
+	}()
+	assert.Eventually(t, func() bool {
+		svc.modelFetches.mu.Lock()
+		defer svc.modelFetches.mu.Unlock()
+		call := svc.modelFetches.calls["models"]
+		return call != nil && call.waiters == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+
+	// Загрузка идет без блокировки: кэшированная модель читается сразу
+	assert.Empty(t, svc.cachedModelName())
+
+	close(release)
+	model := <-secondDone
+	assert.Equal(t, "4", model.ID)
+	assert.Equal(t, int32(1), requests.Load(), "the second caller joins the first request")
+}
+
+func TestFusionBrainService_ModelNotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /key/api/v1/models", fusionBrainModels)
+	svc := newTestFusionBrainService(t, mux)
+	svc.cfg.Model = "Midjourney"
+
+	_, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.ErrorContains(t, err, `model "Midjourney" not found, available: Kandinsky 3.1, Kandinsky Turbo 3.2`)
+}
+
+func TestFusionBrainService_GenerationParams(t *testing.T) {
+	handler := fusionBrainStatusHandler(t, map[string]interface{}{
+		"uuid":   "uuid-1",
+		"status": "DONE",
+		"images": []string{base64.StdEncoding.EncodeToString([]byte("image"))},
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.HandleFunc("POST /key/api/v1/text2image/run", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		var params GenerateRequest
+		assert.NoError(t, json.Unmarshal([]byte(r.FormValue("params")), &params))
+		assert.Equal(t, GenerateRequest{
+			Type:                  "GENERATE",
+			Style:                 "ANIME",
+			NumImages:             1,
+			Width:                 1024,
+			Height:                576,
+			NegativePromptDecoder: "text, watermark",
+			GenerateParams:        GenerateParams{Query: "prompt"},
+		}, params)
+		_ = json.NewEncoder(w).Encode(map[string]string{"uuid": "uuid-1"})
+	})
+	svc := newTestFusionBrainService(t, mux)
+	svc.cfg.Style = "ANIME"
+	svc.cfg.NegativePrompt = "text, watermark"
+	svc.cfg.Height = 576
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Kandinsky 3.1", result.Model)
+}
+
+func TestNewFusionBrainService_InvalidConfig(t *testing.T) {
+	_, err := NewFusionBrainService(FusionBrainConfig{APIKey: "key"}, newQuietLogger())
+	assert.Error(t, err)
+
+	_, err = NewFusionBrainService(FusionBrainConfig{API: "v2", APIKey: "key", SecretKey: "secret"}, newQuietLogger())
+	assert.ErrorContains(t, err, `unknown FusionBrain API "v2"`)
+}
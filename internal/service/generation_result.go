@@ -0,0 +1,57 @@
+package service
+
+import (
+	"net/http"
+	"time"
+)
+
+// GenerationResult describes a generated image together with the details of
+// how it was produced. Providers fill in what they know (model, seed, prompt,
+// attempts); the orchestration layer adds the provider name and latency.
+type GenerationResult struct {
+	// Image - байты изображения
+	Image []byte
+	// MIMEType - тип изображения, например "image/jpeg"
+	MIMEType string
+	// Provider - имя провайдера в реестре
+	Provider string
+	// Model - модель, которой было сгенерировано изображение
+	Model string
+	// Seed - сид генерации, если провайдер его поддерживает
+	Seed string
+	// Prompt - промпт, фактически отправленный провайдеру
+	Prompt string
+	// Latency - время генерации у провайдера
+	Latency time.Duration
+	// Attempts - количество запросов к API провайдера (запуск и опросы статуса)
+	Attempts int
+	// Censored - провайдер сообщил, что изображение заменено заглушкой цензуры
+	Censored bool
+	// Cached - изображение взято из кэша, а не сгенерировано заново
+	Cached bool
+}
+
+// MemeResult is the outcome of the /meme command: the image plus the stages
+// that led to it
+type MemeResult struct {
+	*GenerationResult
+	// Caption - подпись к мему
+	Caption string
+	// UserPrompt - исходный запрос пользователя
+	UserPrompt string
+	// EnhancedPrompt - промпт после улучшения через GPT, по нему генерируется изображение
+	EnhancedPrompt string
+	// Options - параметры генерации из флагов команды; /reroll повторяет их
+	Options ImageOptions
+	// CaptionMode - где оказалась подпись: на изображении, в подписи Telegram или в обоих местах
+	CaptionMode CaptionMode
+	// EnhanceDuration - время улучшения промпта через GPT
+	EnhanceDuration time.Duration
+	// GenerationDuration - время генерации изображения (включая ожидание всех провайдеров)
+	GenerationDuration time.Duration
+}
+
+// detectMIMEType sniffs the MIME type of image data
+func detectMIMEType(data []byte) string {
+	return http.DetectContentType(data)
+}
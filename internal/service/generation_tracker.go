@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// GenerationTracker receives the progress of a meme generation, so that it can
+// be persisted and resumed after a restart
+type GenerationTracker interface {
+	// PromptEnhanced вызывается после улучшения промпта через GPT
+	PromptEnhanced(prompt, caption string) error
+	// OperationStarted вызывается, когда провайдер запустил асинхронную операцию
+	OperationStarted(provider, operationID string) error
+}
+
+type trackerKey struct{}
+
+type providerNameKey struct{}
+
+// WithGenerationTracker returns a context that reports generation progress to tracker
+func WithGenerationTracker(ctx context.Context, tracker GenerationTracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, tracker)
+}
+
+// generationTracker returns the tracker stored in ctx or nil
+func generationTracker(ctx context.Context) GenerationTracker {
+	tracker, _ := ctx.Value(trackerKey{}).(GenerationTracker)
+	return tracker
+}
+
+// withProviderName marks ctx with the registry name of the provider it is passed to
+func withProviderName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, providerNameKey{}, name)
+}
+
+// trackOperation reports an operation started by the provider running under ctx.
+// Providers call it right after the operation ID is known.
+func trackOperation(ctx context.Context, operationID string) error {
+	tracker := generationTracker(ctx)
+	if tracker == nil {
+		return nil
+	}
+	name, _ := ctx.Value(providerNameKey{}).(string)
+	return tracker.OperationStarted(name, operationID)
+}
+
+// startedOperation is an operation reported to a trackerFanout
+type startedOperation struct {
+	provider    string
+	operationID string
+}
+
+// trackerFanout forwards progress of a shared generation to the trackers of
+// every caller waiting for it. A tracker that joins late receives the
+// operations started before it joined.
+type trackerFanout struct {
+	mu         sync.Mutex
+	trackers   map[int]GenerationTracker
+	nextID     int
+	operations []startedOperation
+}
+
+// newTrackerFanout creates a fan-out without trackers
+func newTrackerFanout() *trackerFanout {
+	return &trackerFanout{trackers: make(map[int]GenerationTracker)}
+}
+
+// add subscribes tracker to the generation and returns a function that
+// unsubscribes it. A nil tracker is ignored.
+func (f *trackerFanout) add(tracker GenerationTracker) (remove func()) {
+	if tracker == nil {
+		return func() {}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID
+	f.nextID++
+	f.trackers[id] = tracker
+	for _, operation := range f.operations {
+		// Ошибку сохранения увидит только опоздавший, общей генерации она не касается
+		_ = tracker.OperationStarted(operation.provider, operation.operationID)
+	}
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.trackers, id)
+	}
+}
+
+// PromptEnhanced forwards the enhanced prompt to every subscribed tracker
+func (f *trackerFanout) PromptEnhanced(prompt, caption string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+	for _, tracker := range f.trackers {
+		errs = append(errs, tracker.PromptEnhanced(prompt, caption))
+	}
+	return errors.Join(errs...)
+}
+
+// OperationStarted forwards the operation to every subscribed tracker and
+// remembers it for trackers that join later
+func (f *trackerFanout) OperationStarted(provider, operationID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.operations = append(f.operations, startedOperation{provider: provider, operationID: operationID})
+	var errs []error
+	for _, tracker := range f.trackers {
+		errs = append(errs, tracker.OperationStarted(provider, operationID))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Причины ошибок разбора ответа GPT, они же метки метрики GPTParseFailures
+const (
+	// gptParseNoJSON - в ответе нет JSON-объекта
+	gptParseNoJSON = "no_json"
+	// gptParseInvalidJSON - объект найден, но не разбирается (например, обрезан)
+	gptParseInvalidJSON = "invalid_json"
+	// gptParseMissingField - обязательное поле отсутствует или пустое
+	gptParseMissingField = "missing_field"
+	// gptParseTooLong - поле длиннее допустимого
+	gptParseTooLong = "too_long"
+)
+
+const (
+	// gptMaxPromptFieldLength - ограничение context и detail в символах
+	gptMaxPromptFieldLength = 500
+	// gptMaxCaptionLength - ограничение подписи в символах: она рисуется на картинке
+	gptMaxCaptionLength = 200
+)
+
+// gptRepairPrompt просит модель исправить ответ, который не удалось разобрать
+const gptRepairPrompt = `Предыдущий ответ не удалось разобрать: %v.
+Ответь еще раз только JSON-объектом с непустыми строковыми полями "context" (до %d символов), "detail" (до %d символов) и "caption" (до %d символов), без пояснений и markdown.`
+
+// gptPromptSchema describes GPTPromptResponse for the structured output modes of LLM backends
+var gptPromptSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"context": map[string]interface{}{"type": "string"},
+		"detail":  map[string]interface{}{"type": "string"},
+		"caption": map[string]interface{}{"type": "string"},
+	},
+	"required": []string{"context", "detail", "caption"},
+}
+
+// memeTemplateChoiceSchema describes MemeTemplateChoice
+var memeTemplateChoiceSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"template": map[string]interface{}{"type": "string"},
+		"slots": map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		},
+	},
+	"required": []string{"template", "slots"},
+}
+
+// gptParseError is a failure to parse a GPT answer, with a reason for metrics
+type gptParseError struct {
+	reason string
+	err    error
+}
+
+func (e *gptParseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *gptParseError) Unwrap() error {
+	return e.err
+}
+
+// gptParseReason returns the metric label of a parse error
+func gptParseReason(err error) string {
+	var parseErr *gptParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.reason
+	}
+	return gptParseInvalidJSON
+}
+
+// parsePromptResponse extracts and validates the answer to GenerateImagePrompt
+func parsePromptResponse(text string) (*GPTPromptResponse, error) {
+	var response GPTPromptResponse
+	if err := decodeGPTJSON(text, &response); err != nil {
+		return nil, err
+	}
+	if err := response.validate(); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// validate trims the fields and checks that all of them are present and fit the limits
+func (r *GPTPromptResponse) validate() error {
+	fields := []struct {
+		name      string
+		value     *string
+		maxLength int
+	}{
+		{name: "context", value: &r.Context, maxLength: gptMaxPromptFieldLength},
+		{name: "detail", value: &r.Detail, maxLength: gptMaxPromptFieldLength},
+		{name: "caption", value: &r.Caption, maxLength: gptMaxCaptionLength},
+	}
+	for _, field := range fields {
+		*field.value = strings.TrimSpace(*field.value)
+		if *field.value == "" {
+			return &gptParseError{reason: gptParseMissingField, err: fmt.Errorf("field %q is empty", field.name)}
+		}
+		if length := utf8.RuneCountInString(*field.value); length > field.maxLength {
+			return &gptParseError{
+				reason: gptParseTooLong,
+				err:    fmt.Errorf("field %q is %d characters long, the limit is %d", field.name, length, field.maxLength),
+			}
+		}
+	}
+	return nil
+}
+
+// decodeGPTJSON finds the JSON object in a GPT answer and decodes it into v
+func decodeGPTJSON(text string, v interface{}) error {
+	object, ok := extractJSONObject(text)
+	if !ok {
+		return &gptParseError{reason: gptParseNoJSON, err: fmt.Errorf("no JSON object in response")}
+	}
+	if err := json.Unmarshal([]byte(object), v); err != nil {
+		return &gptParseError{reason: gptParseInvalidJSON, err: fmt.Errorf("decoding JSON: %w", err)}
+	}
+	return nil
+}
+
+// extractJSONObject returns the first JSON object in text. Markdown fences and
+// prose around the object are skipped and trailing commas are removed. An
+// object that is never closed (e.g. cut off by the token limit) is returned
+// as is, so that decoding reports it.
+func extractJSONObject(text string) (string, bool) {
+	start := strings.IndexByte(text, '{')
+	if start == -1 {
+		return "", false
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	end := len(text)
+scan:
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				end = i + 1
+				break scan
+			}
+		}
+	}
+	return removeTrailingCommas(text[start:end]), true
+}
+
+// removeTrailingCommas drops commas right before a closing brace or bracket,
+// which models often leave and encoding/json rejects
+func removeTrailingCommas(object string) string {
+	var b strings.Builder
+	b.Grow(len(object))
+	inString, escaped := false, false
+	for i := 0; i < len(object); i++ {
+		c := object[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case !inString && c == ',':
+			next := strings.TrimLeft(object[i+1:], " \t\r\n")
+			if next != "" && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
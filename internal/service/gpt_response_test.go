@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePromptResponse(t *testing.T) {
+	want := &GPTPromptResponse{Context: "A cat in space", Detail: "wearing a tiny helmet", Caption: "Хьюстон, у нас кот"}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{
+			name: "plain",
+			text: `{"context": "A cat in space", "detail": "wearing a tiny helmet", "caption": "Хьюстон, у нас кот"}`,
+		},
+		{
+			name: "json fence",
+			text: "```json\n{\"context\": \"A cat in space\", \"detail\": \"wearing a tiny helmet\", \"caption\": \"Хьюстон, у нас кот\"}\n```",
+		},
+		{
+			name: "prose around",
+			text: "Вот ваш мем:\n{\"context\": \"A cat in space\", \"detail\": \"wearing a tiny helmet\", \"caption\": \"Хьюстон, у нас кот\"}\nНадеюсь, смешно!",
+		},
+		{
+			name: "trailing commas",
+			text: "{\n  \"context\": \"A cat in space\",\n  \"detail\": \"wearing a tiny helmet\",\n  \"caption\": \"Хьюстон, у нас кот\",\n}",
+		},
+		{
+			name: "padded fields",
+			text: `{"context": " A cat in space ", "detail": "wearing a tiny helmet", "caption": "Хьюстон, у нас кот\n"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := parsePromptResponse(tt.text)
+			assert.NoError(t, err)
+			assert.Equal(t, want, response)
+		})
+	}
+}
+
+func TestParsePromptResponse_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		wantReason string
+		wantErr    string
+	}{
+		{name: "no json", text: "Извините, я не могу помочь с этим запросом", wantReason: gptParseNoJSON},
+		{name: "cut off", text: `{"context": "A cat in space", "detail": "wearing a ti`, wantReason: gptParseInvalidJSON},
+		{name: "wrong type", text: `{"context": ["A cat"], "detail": "x", "caption": "y"}`, wantReason: gptParseInvalidJSON},
+		{name: "missing caption", text: `{"context": "A cat in space", "detail": "wearing a tiny helmet"}`, wantReason: gptParseMissingField, wantErr: `field "caption" is empty`},
+		{name: "blank detail", text: `{"context": "A cat", "detail": "  ", "caption": "кот"}`, wantReason: gptParseMissingField, wantErr: `field "detail" is empty`},
+		{
+			name:       "caption too long",
+			text:       `{"context": "A cat", "detail": "helmet", "caption": "` + strings.Repeat("я", gptMaxCaptionLength+1) + `"}`,
+			wantReason: gptParseTooLong,
+			wantErr:    `field "caption" is 201 characters long`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePromptResponse(tt.text)
+			assert.Error(t, err)
+			assert.Equal(t, tt.wantReason, gptParseReason(err))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtractJSONObject(t *testing.T) {
+	// Скобки и запятые внутри строк не считаются разметкой
+	object, ok := extractJSONObject(`Ответ: {"caption": "когда {код} работает,}", "slots": {"a": "b",},} и все`)
+	assert.True(t, ok)
+	assert.Equal(t, `{"caption": "когда {код} работает,}", "slots": {"a": "b"}}`, object)
+
+	object, ok = extractJSONObject(`{"caption": "кавычка \" и скобка }"}`)
+	assert.True(t, ok)
+	assert.Equal(t, `{"caption": "кавычка \" и скобка }"}`, object)
+
+	_, ok = extractJSONObject("просто текст")
+	assert.False(t, ok)
+}
+
+func TestGPTService_GenerateImagePrompt_Repair(t *testing.T) {
+	llm := &scriptedLLM{name: "test", answers: []string{
+		`{"context": "A cat in space", "detail": "wearing a tiny helmet"}`,
+		`{"context": "A cat in space", "detail": "wearing a tiny helmet", "caption": "Хьюстон, у нас кот"}`,
+	}}
+	svc := NewGPTService(newQuietLogger(), llm)
+
+	prompt, caption, err := svc.GenerateImagePrompt(context.Background(), "кот в космосе")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "A cat in space.wearing a tiny helmet", prompt)
+	assert.Equal(t, "Хьюстон, у нас кот", caption)
+	assert.Len(t, llm.requests, 2)
+	assert.Equal(t, gptPromptSchema, llm.requests[0].JSONSchema)
+
+	// Повтор видит свой ответ и причину ошибки
+	repair := llm.requests[1].Messages
+	assert.Len(t, repair, 4)
+	assert.Equal(t, LLMMessage{Role: LLMRoleAssistant, Text: `{"context": "A cat in space", "detail": "wearing a tiny helmet"}`}, repair[2])
+	assert.Contains(t, repair[3].Text, `field "caption" is empty`)
+	assert.Len(t, llm.requests[0].Messages, 2, "the first request is not modified")
+
+	// Повтор только один: после второй ошибки используется исходный промпт
+	llm = &scriptedLLM{name: "test", answers: []string{"не JSON", "опять не JSON", "{}"}}
+	svc = NewGPTService(newQuietLogger(), llm)
+
+	prompt, caption, err = svc.GenerateImagePrompt(context.Background(), "кот")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "кот", prompt)
+	assert.Empty(t, caption)
+	assert.Len(t, llm.requests, 2)
+}
+
+func TestGPTService_ChooseMemeTemplate(t *testing.T) {
+	llm := &scriptedLLM{name: "test", answers: []string{
+		"```json\n{\"template\": \"reject_approve\", \"slots\": {\"top\": \"Писать тесты\", \"bottom\": \"Писать мемы\",},}\n```",
+		"Не могу выбрать",
+	}}
+	svc := NewGPTService(newQuietLogger(), llm)
+
+	choice, err := svc.ChooseMemeTemplate(context.Background(), "тесты", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &MemeTemplateChoice{Template: "reject_approve", Slots: map[string]string{"top": "Писать тесты", "bottom": "Писать мемы"}}, choice)
+	assert.Equal(t, memeTemplateChoiceSchema, llm.requests[0].JSONSchema)
+
+	_, err = svc.ChooseMemeTemplate(context.Background(), "тесты", nil)
+	assert.ErrorContains(t, err, "no JSON object in response")
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+)
+
+// GPTServiceImpl реализует GPTService поверх любой языковой модели
+type GPTServiceImpl struct {
+	logger *logger.Logger
+	client LLMClient
+}
+
+// NewGPTService создает новый экземпляр GPT сервиса
+func NewGPTService(log *logger.Logger, client LLMClient) *GPTServiceImpl {
+	return &GPTServiceImpl{
+		logger: log,
+		client: client,
+	}
+}
+
+// GenerateImagePrompt генерирует промпт и подпись для создания изображения
+func (s *GPTServiceImpl) GenerateImagePrompt(ctx context.Context, userPrompt string) (string, string, error) {
+	request := LLMRequest{
+		Temperature: 0.6,
+		MaxTokens:   200,
+		JSONSchema:  gptPromptSchema,
+		Messages: []LLMMessage{
+			{
+				Role: LLMRoleSystem,
+				Text: `
+				Ты выступаешь в роли креативного мем-редактора и стендапера в одном лице. Твоя задача — преобразовать короткое описание мема так, чтобы получилась злободневная, ироничная и запоминающаяся шутка, содержащая:
+				1. Небольшую завязку (контекст или ситуацию), которая намекает на современную поп-культуру, тренд или повседневную проблему.
+				2. Юмористический поворот с использованием абсурда, гиперболы или контраста.
+				3. Эмоциональные слова и лёгкий сленг, которые усилят комичность.
+				4. Отсылку к чему-то неожиданному (исторический факт, известная личность, бытовая мелочь), чтобы вызвать «эффект сюрприза».
+				5. Финальную формулировку для подписи на изображении (короткую, не более 1–2 строк).
+
+				Ответ должен быть в формате JSON:
+				{
+					"context": "Контекст/ситуация на английском языке",
+					"detail": "Остроумная деталь на английском языке",
+					"caption": "Итоговая подпись для картинки на русском языке"
+				}
+				`,
+			},
+			{
+				Role: LLMRoleUser,
+				Text: fmt.Sprintf(`Создай краткое описание мема на тему: %s. Опиши основные элементы, цвета и настроение.`, userPrompt),
+			},
+		},
+	}
+
+	// Отправляем запрос
+	s.logger.Debug(ctx, "Initiating GPT request", map[string]interface{}{
+		"prompt_length": len(userPrompt),
+		"llm":           s.client.Name(),
+	})
+
+	text, err := s.client.Complete(ctx, request)
+	if err != nil {
+		s.logger.Error(ctx, "Failed to generate enhanced prompt, falling back to original", map[string]interface{}{
+			"error":           err.Error(),
+			"original_prompt": userPrompt,
+		})
+		return userPrompt, "", nil
+	}
+
+	promptResponse, err := parsePromptResponse(text)
+	if err != nil {
+		s.countParseFailure(ctx, err, text)
+		promptResponse, err = s.repairPromptResponse(ctx, request, text, err)
+	}
+	if err != nil {
+		s.logger.Error(ctx, "Failed to parse GPT JSON response, using original text", map[string]interface{}{
+			"error":           err.Error(),
+			"original_prompt": userPrompt,
+		})
+		return userPrompt, "", nil
+	}
+
+	// Формируем итоговый промпт из context и detail
+	enhancedPrompt := promptResponse.Context + "." + promptResponse.Detail
+
+	s.logger.Debug(ctx, "Successfully parsed GPT response", map[string]interface{}{
+		"context": promptResponse.Context,
+		"detail":  promptResponse.Detail,
+		"caption": promptResponse.Caption,
+	})
+
+	return enhancedPrompt, promptResponse.Caption, nil
+}
+
+// ChooseMemeTemplate просит GPT выбрать шаблон мема под тему и придумать тексты для его слотов
+func (s *GPTServiceImpl) ChooseMemeTemplate(ctx context.Context, userPrompt string, templates []MemeTemplate) (*MemeTemplateChoice, error) {
+	request := LLMRequest{
+		Temperature: 0.7,
+		MaxTokens:   300,
+		JSONSchema:  memeTemplateChoiceSchema,
+		Messages: []LLMMessage{
+			{
+				Role: LLMRoleSystem,
+				Text: `
+				Ты автор мемов. Выбери из списка шаблон мема, который лучше всего подходит к теме, и придумай короткие смешные тексты для каждого его слота.
+				Тексты пиши на русском языке, не длиннее 6-8 слов на слот.
+
+				Шаблоны:
+				` + describeMemeTemplates(templates) + `
+
+				Ответ должен быть в формате JSON:
+				{
+					"template": "ID шаблона",
+					"slots": {"имя слота": "текст"}
+				}
+				`,
+			},
+			{
+				Role: LLMRoleUser,
+				Text: fmt.Sprintf("Тема мема: %s", userPrompt),
+			},
+		},
+	}
+
+	text, err := s.client.Complete(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var choice MemeTemplateChoice
+	if err := decodeGPTJSON(text, &choice); err != nil {
+		s.countParseFailure(ctx, err, text)
+		return nil, fmt.Errorf("parsing meme template choice: %w", err)
+	}
+
+	s.logger.Debug(ctx, "GPT chose meme template", map[string]interface{}{
+		"template": choice.Template,
+		"slots":    choice.Slots,
+	})
+	return &choice, nil
+}
+
+// repairPromptResponse asks the model once more, showing it the answer that
+// could not be parsed and the reason
+func (s *GPTServiceImpl) repairPromptResponse(ctx context.Context, request LLMRequest, text string, parseErr error) (*GPTPromptResponse, error) {
+	// Пустой ответ не отправляем: Yandex GPT не принимает сообщения без текста
+	if strings.TrimSpace(text) != "" {
+		request.Messages = append(request.Messages, LLMMessage{Role: LLMRoleAssistant, Text: text})
+	}
+	request.Messages = append(request.Messages, LLMMessage{
+		Role: LLMRoleUser,
+		Text: fmt.Sprintf(gptRepairPrompt, parseErr, gptMaxPromptFieldLength, gptMaxPromptFieldLength, gptMaxCaptionLength),
+	})
+
+	repaired, err := s.client.Complete(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("repairing response: %w", err)
+	}
+	response, err := parsePromptResponse(repaired)
+	if err != nil {
+		s.countParseFailure(ctx, err, repaired)
+		return nil, fmt.Errorf("repaired response: %w", err)
+	}
+	s.logger.Info(ctx, "GPT response repaired", map[string]interface{}{
+		"reason": gptParseReason(parseErr),
+	})
+	return response, nil
+}
+
+// countParseFailure logs a GPT answer that could not be parsed and counts the reason
+func (s *GPTServiceImpl) countParseFailure(ctx context.Context, err error, text string) {
+	reason := gptParseReason(err)
+	metrics.GPTParseFailures.Inc(reason)
+	s.logger.Warn(ctx, "Failed to parse GPT response", map[string]interface{}{
+		"error":  err.Error(),
+		"reason": reason,
+		"llm":    s.client.Name(),
+		"text":   truncateText(text, 500),
+	})
+}
+
+// describeMemeTemplates lists templates with their slots for the GPT prompt
+func describeMemeTemplates(templates []MemeTemplate) string {
+	var b strings.Builder
+	for _, template := range templates {
+		fmt.Fprintf(&b, "- %s (%s): %s. Слоты:", template.ID, template.Name, template.Description)
+		for _, slot := range template.Slots {
+			fmt.Fprintf(&b, " %s - %s;", slot.Name, slot.Description)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// GPTPromptResponse представляет структурированный ответ от GPT
+type GPTPromptResponse struct {
+	Context string `json:"context"`
+	Detail  string `json:"detail"`
+	Caption string `json:"caption"`
+}
+
+// truncateText обрезает текст до указанной длины, сохраняя целые предложения
+func truncateText(text string, maxLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+
+	lastDot := strings.LastIndex(text[:maxLength], ".")
+	if lastDot == -1 {
+		return text[:maxLength]
+	}
+
+	return text[:lastDot+1]
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/azalio/meme-bot/pkg/logger"
+)
+
+// Общие помощники тестов. Все тесты пакета живут во внутреннем пакете service,
+// чтобы подменять HTTP клиентов, часы и пуллеры сервисов.
+
+// testPollConfig опрашивает операции без реальных задержек
+var testPollConfig = PollConfig{
+	InitialDelay: time.Millisecond,
+	Interval:     time.Millisecond,
+	MaxInterval:  2 * time.Millisecond,
+	Multiplier:   2,
+	Timeout:      2 * time.Second,
+}
+
+// newQuietLogger создает логгер, который пишет только фатальные ошибки
+func newQuietLogger() *logger.Logger {
+	log, _ := logger.New(logger.Config{Level: logger.FatalLevel, Service: "test"})
+	return log
+}
+
+// newStubServer запускает тестовый HTTP сервер вместо API провайдера и
+// останавливает его в конце теста
+func newStubServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// staticAuth возвращает фиксированный IAM токен
+type staticAuth struct{}
+
+func (staticAuth) GetIAMToken(ctx context.Context) (string, error) { return "iam-token", nil }
+
+func (staticAuth) RefreshIAMToken(ctx context.Context, oauthToken string) (string, error) {
+	return "iam-token", nil
+}
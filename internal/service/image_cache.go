@@ -0,0 +1,350 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultImageCacheEntries - сколько изображений хранится в памяти
+	defaultImageCacheEntries = 100
+	// defaultImageCacheMemoryBytes - сколько байт изображений хранится в памяти
+	defaultImageCacheMemoryBytes = 64 << 20
+	// defaultImageCacheTTL - время жизни закэшированного изображения
+	defaultImageCacheTTL = 24 * time.Hour
+	// defaultImageCacheDiskBytes - сколько байт изображений хранится на диске
+	defaultImageCacheDiskBytes = 512 << 20
+	// imageCacheFileSuffix - расширение файлов дискового кэша
+	imageCacheFileSuffix = ".json"
+)
+
+// ImageCacheKey identifies a generated image. Only requests with an explicit
+// seed are cached; empty provider, model and aspect ratio mean "whatever the
+// provider chose".
+type ImageCacheKey struct {
+	Provider    string
+	Model       string
+	Seed        string
+	AspectRatio string
+	// Prompt - улучшенный промпт; регистр и лишние пробелы не учитываются
+	Prompt string
+}
+
+// newImageCacheKey builds the cache key of a request
+func newImageCacheKey(prompt string, opts ImageOptions) ImageCacheKey {
+	return ImageCacheKey{
+		Provider:    opts.Provider,
+		Model:       opts.Model,
+		Seed:        opts.Seed,
+		AspectRatio: opts.AspectRatio,
+		Prompt:      prompt,
+	}
+}
+
+// Hash returns the content address of the key: a hex SHA-256 of its fields
+func (k ImageCacheKey) Hash() string {
+	fields := []string{
+		strings.ToLower(k.Provider),
+		strings.ToLower(k.Model),
+		k.Seed,
+		k.AspectRatio,
+		normalizePrompt(k.Prompt),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ImageCacheConfig holds limits of the image cache
+type ImageCacheConfig struct {
+	// MaxEntries - максимальное число изображений в памяти; 0 отключает кэш в памяти
+	MaxEntries int
+	// MaxMemoryBytes - максимальный суммарный размер изображений в памяти
+	MaxMemoryBytes int64
+	// TTL - время жизни изображения в кэше
+	TTL time.Duration
+	// Dir - каталог дискового кэша; пустое значение отключает диск
+	Dir string
+	// MaxDiskBytes - максимальный суммарный размер файлов дискового кэша
+	MaxDiskBytes int64
+}
+
+// DefaultImageCacheConfig returns limits of a memory-only cache
+func DefaultImageCacheConfig() ImageCacheConfig {
+	return ImageCacheConfig{
+		MaxEntries:     defaultImageCacheEntries,
+		MaxMemoryBytes: defaultImageCacheMemoryBytes,
+		TTL:            defaultImageCacheTTL,
+		MaxDiskBytes:   defaultImageCacheDiskBytes,
+	}
+}
+
+// cachedImage is an entry of the image cache. It is also the format of disk files.
+type cachedImage struct {
+	Hash     string            `json:"hash"`
+	Result   *GenerationResult `json:"result"`
+	StoredAt time.Time         `json:"stored_at"`
+}
+
+// ImageCache keeps generated images in a memory LRU and, optionally, in a
+// directory on disk. Disk entries survive restarts; the least recently used
+// files are removed when the directory grows over its limit.
+type ImageCache struct {
+	cfg ImageCacheConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	lru         *list.List
+	memoryBytes int64
+
+	// diskMu сериализует запись и очистку дискового кэша
+	diskMu sync.Mutex
+}
+
+// NewImageCache creates a cache, creating the disk directory if it is configured.
+// Negative limits are replaced with defaults.
+func NewImageCache(cfg ImageCacheConfig) (*ImageCache, error) {
+	defaults := DefaultImageCacheConfig()
+	if cfg.MaxEntries < 0 {
+		cfg.MaxEntries = defaults.MaxEntries
+	}
+	if cfg.MaxMemoryBytes <= 0 {
+		cfg.MaxMemoryBytes = defaults.MaxMemoryBytes
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaults.TTL
+	}
+	if cfg.MaxDiskBytes <= 0 {
+		cfg.MaxDiskBytes = defaults.MaxDiskBytes
+	}
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating image cache directory: %w", err)
+		}
+	}
+
+	return &ImageCache{
+		cfg:     cfg,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// Get returns a copy of the cached result for key. The second value tells
+// where the image was found: "memory", "disk" or "" on a miss.
+func (c *ImageCache) Get(key ImageCacheKey) (*GenerationResult, string) {
+	hash := key.Hash()
+
+	if result, ok := c.getMemory(hash); ok {
+		return result, "memory"
+	}
+	if c.cfg.Dir == "" {
+		return nil, ""
+	}
+
+	entry, err := c.readDisk(hash)
+	if err != nil || entry == nil {
+		return nil, ""
+	}
+	c.putMemory(entry)
+	clone := *entry.Result
+	return &clone, "disk"
+}
+
+// Put stores a copy of result under key. Disk errors are returned, but the
+// result stays cached in memory anyway.
+func (c *ImageCache) Put(key ImageCacheKey, result *GenerationResult) error {
+	if result == nil || len(result.Image) == 0 {
+		return nil
+	}
+	clone := *result
+	entry := &cachedImage{Hash: key.Hash(), Result: &clone, StoredAt: c.now()}
+
+	c.putMemory(entry)
+	if c.cfg.Dir == "" {
+		return nil
+	}
+	return c.writeDisk(entry)
+}
+
+// Len returns the number of images cached in memory
+func (c *ImageCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// getMemory looks the hash up in the memory tier, dropping expired entries
+func (c *ImageCache) getMemory(hash string) (*GenerationResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cachedImage)
+	if c.expired(entry) {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	clone := *entry.Result
+	return &clone, true
+}
+
+// putMemory adds the entry to the memory tier and evicts the least recently
+// used entries that do not fit the limits
+func (c *ImageCache) putMemory(entry *cachedImage) {
+	size := int64(len(entry.Result.Image))
+	if c.cfg.MaxEntries == 0 || size > c.cfg.MaxMemoryBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[entry.Hash]; ok {
+		c.removeElement(element)
+	}
+	c.entries[entry.Hash] = c.lru.PushFront(entry)
+	c.memoryBytes += size
+
+	for c.lru.Len() > c.cfg.MaxEntries || c.memoryBytes > c.cfg.MaxMemoryBytes {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement drops an entry from the memory tier. Must be called with the mutex held.
+func (c *ImageCache) removeElement(element *list.Element) {
+	entry := c.lru.Remove(element).(*cachedImage)
+	delete(c.entries, entry.Hash)
+	c.memoryBytes -= int64(len(entry.Result.Image))
+}
+
+// expired reports whether the entry is older than the TTL
+func (c *ImageCache) expired(entry *cachedImage) bool {
+	return c.now().Sub(entry.StoredAt) > c.cfg.TTL
+}
+
+// diskPath returns the file of the entry with the given hash
+func (c *ImageCache) diskPath(hash string) string {
+	return filepath.Join(c.cfg.Dir, hash+imageCacheFileSuffix)
+}
+
+// readDisk loads an entry from disk. Missing and expired entries return nil.
+func (c *ImageCache) readDisk(hash string) (*cachedImage, error) {
+	path := c.diskPath(hash)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cached image: %w", err)
+	}
+
+	var entry cachedImage
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Result == nil || entry.Hash != hash {
+		// Поврежденный файл бесполезен
+		os.Remove(path)
+		return nil, fmt.Errorf("decoding cached image %s: %v", path, err)
+	}
+	if c.expired(&entry) {
+		os.Remove(path)
+		return nil, nil
+	}
+
+	// Время изменения файла - это время последнего использования для очистки
+	now := c.now()
+	os.Chtimes(path, now, now)
+	return &entry, nil
+}
+
+// writeDisk stores the entry atomically and trims the directory to its size limit
+func (c *ImageCache) writeDisk(entry *cachedImage) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding cached image: %w", err)
+	}
+	if int64(len(data)) > c.cfg.MaxDiskBytes {
+		return nil
+	}
+
+	c.diskMu.Lock()
+	defer c.diskMu.Unlock()
+
+	tmp, err := os.CreateTemp(c.cfg.Dir, entry.Hash+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing cached image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.diskPath(entry.Hash)); err != nil {
+		return fmt.Errorf("replacing cached image: %w", err)
+	}
+	return c.trimDisk()
+}
+
+// trimDisk removes expired files and then the least recently used ones until
+// the directory fits MaxDiskBytes. Must be called with diskMu held.
+func (c *ImageCache) trimDisk() error {
+	files, err := os.ReadDir(c.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("listing image cache: %w", err)
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var cached []cacheFile
+	var total int64
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), imageCacheFileSuffix) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(c.cfg.Dir, file.Name())
+		// Файл, который не использовали дольше TTL, заведомо просрочен
+		if c.now().Sub(info.ModTime()) > c.cfg.TTL {
+			os.Remove(path)
+			continue
+		}
+		cached = append(cached, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(cached, func(i, j int) bool { return cached[i].modTime.Before(cached[j].modTime) })
+	for _, file := range cached {
+		if total <= c.cfg.MaxDiskBytes {
+			break
+		}
+		if err := os.Remove(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("evicting cached image: %w", err)
+		}
+		total -= file.size
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestImageCache(t *testing.T, cfg ImageCacheConfig) (*ImageCache, *time.Time) {
+	t.Helper()
+
+	cache, err := NewImageCache(cfg)
+	assert.NoError(t, err)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func testCachedResult(image string) *GenerationResult {
+	return &GenerationResult{Image: []byte(image), Provider: "fake", Model: "model", Seed: "42"}
+}
+
+func TestImageCacheKey_Hash(t *testing.T) {
+	key := ImageCacheKey{Provider: "yandex_art", Seed: "1", AspectRatio: "16:9", Prompt: "Кот  в шляпе"}
+
+	assert.Equal(t, key.Hash(), ImageCacheKey{Provider: "Yandex_Art", Seed: "1", AspectRatio: "16:9", Prompt: " кот в ШЛЯПЕ"}.Hash())
+	assert.NotEqual(t, key.Hash(), ImageCacheKey{Provider: "yandex_art", Seed: "2", AspectRatio: "16:9", Prompt: "Кот в шляпе"}.Hash())
+	assert.NotEqual(t, key.Hash(), ImageCacheKey{Seed: "1", AspectRatio: "16:9", Prompt: "Кот в шляпе"}.Hash())
+	assert.Len(t, key.Hash(), 64)
+}
+
+func TestImageCache_MemoryLRU(t *testing.T) {
+	cache, _ := newTestImageCache(t, ImageCacheConfig{MaxEntries: 2})
+	first := ImageCacheKey{Prompt: "first"}
+	second := ImageCacheKey{Prompt: "second"}
+	third := ImageCacheKey{Prompt: "third"}
+
+	assert.NoError(t, cache.Put(first, testCachedResult("1")))
+	assert.NoError(t, cache.Put(second, testCachedResult("2")))
+	// Обращение делает first самым свежим, вытесняется second
+	result, tier := cache.Get(first)
+	assert.Equal(t, "memory", tier)
+	assert.Equal(t, []byte("1"), result.Image)
+	assert.NoError(t, cache.Put(third, testCachedResult("3")))
+
+	_, tier = cache.Get(second)
+	assert.Empty(t, tier)
+	_, tier = cache.Get(first)
+	assert.Equal(t, "memory", tier)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestImageCache_MemoryByteLimit(t *testing.T) {
+	cache, _ := newTestImageCache(t, ImageCacheConfig{MaxEntries: 10, MaxMemoryBytes: 5})
+
+	assert.NoError(t, cache.Put(ImageCacheKey{Prompt: "a"}, testCachedResult("abc")))
+	assert.NoError(t, cache.Put(ImageCacheKey{Prompt: "b"}, testCachedResult("def")))
+	assert.NoError(t, cache.Put(ImageCacheKey{Prompt: "huge"}, testCachedResult("too large")))
+
+	assert.Equal(t, 1, cache.Len())
+	_, tier := cache.Get(ImageCacheKey{Prompt: "b"})
+	assert.Equal(t, "memory", tier)
+}
+
+func TestImageCache_TTL(t *testing.T) {
+	cache, now := newTestImageCache(t, ImageCacheConfig{MaxEntries: 10, TTL: time.Hour})
+	key := ImageCacheKey{Prompt: "prompt"}
+	assert.NoError(t, cache.Put(key, testCachedResult("image")))
+
+	*now = now.Add(30 * time.Minute)
+	_, tier := cache.Get(key)
+	assert.Equal(t, "memory", tier)
+
+	*now = now.Add(time.Hour)
+	result, tier := cache.Get(key)
+	assert.Nil(t, result)
+	assert.Empty(t, tier)
+	assert.Zero(t, cache.Len())
+}
+
+func TestImageCache_DiskTierSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	key := ImageCacheKey{Provider: "fake", Seed: "42", Prompt: "prompt"}
+
+	cache, _ := newTestImageCache(t, ImageCacheConfig{MaxEntries: 10, Dir: dir})
+	assert.NoError(t, cache.Put(key, testCachedResult("image")))
+
+	restarted, _ := newTestImageCache(t, ImageCacheConfig{MaxEntries: 10, Dir: dir})
+	result, tier := restarted.Get(key)
+	assert.Equal(t, "disk", tier)
+	if assert.NotNil(t, result) {
+		assert.Equal(t, []byte("image"), result.Image)
+		assert.Equal(t, "fake", result.Provider)
+		assert.Equal(t, "42", result.Seed)
+	}
+
+	// После чтения с диска изображение поднимается в память
+	_, tier = restarted.Get(key)
+	assert.Equal(t, "memory", tier)
+}
+
+func TestImageCache_DiskSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	cache, now := newTestImageCache(t, ImageCacheConfig{Dir: dir, MaxDiskBytes: 400})
+
+	for i, prompt := range []string{"first", "second", "third"} {
+		*now = now.Add(time.Minute)
+		key := ImageCacheKey{Prompt: prompt}
+		assert.NoError(t, cache.Put(key, testCachedResult("image")))
+		// Время изменения файлов задает порядок вытеснения
+		stamp := now.Add(time.Duration(i) * time.Second)
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, key.Hash()+imageCacheFileSuffix), stamp, stamp))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+imageCacheFileSuffix))
+	assert.NoError(t, err)
+	assert.Less(t, len(files), 3)
+	_, tier := cache.Get(ImageCacheKey{Prompt: "third"})
+	assert.Equal(t, "disk", tier)
+	_, tier = cache.Get(ImageCacheKey{Prompt: "first"})
+	assert.Empty(t, tier)
+}
+
+func TestImageCache_CorruptedDiskEntry(t *testing.T) {
+	dir := t.TempDir()
+	cache, _ := newTestImageCache(t, ImageCacheConfig{Dir: dir})
+	key := ImageCacheKey{Prompt: "prompt"}
+	path := filepath.Join(dir, key.Hash()+imageCacheFileSuffix)
+	assert.NoError(t, os.WriteFile(path, []byte("{broken"), 0o644))
+
+	result, tier := cache.Get(key)
+	assert.Nil(t, result)
+	assert.Empty(t, tier)
+	assert.NoFileExists(t, path)
+}
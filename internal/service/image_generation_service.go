@@ -2,124 +2,755 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"image"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/azalio/meme-bot/internal/config"
 	"github.com/azalio/meme-bot/internal/otel/metrics"
 	"github.com/azalio/meme-bot/pkg/logger"
 )
 
-// ImageGenerationService provides a unified interface for image generation
+// GenerationStrategy defines how providers are launched for a single request
+type GenerationStrategy string
+
+const (
+	// StrategyRace запускает все провайдеры одновременно
+	StrategyRace GenerationStrategy = "race"
+	// StrategyHedged запускает предпочтительный провайдер, а следующий - только если
+	// результат не пришел за время задержки хеджирования (или предыдущий упал)
+	StrategyHedged GenerationStrategy = "hedged"
+	// StrategySequential запускает следующий провайдер только после ошибки предыдущего
+	StrategySequential GenerationStrategy = "sequential"
+)
+
+// ErrCircuitOpen is returned for providers skipped because their circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// defaultHedgeDelay is used when neither configuration nor observed latencies provide a delay
+const defaultHedgeDelay = 15 * time.Second
+
+// ParseGenerationStrategy converts a configuration value into a GenerationStrategy.
+// An empty value selects StrategyRace.
+func ParseGenerationStrategy(value string) (GenerationStrategy, error) {
+	switch strategy := GenerationStrategy(strings.ToLower(strings.TrimSpace(value))); strategy {
+	case "":
+		return StrategyRace, nil
+	case StrategyRace, StrategyHedged, StrategySequential:
+		return strategy, nil
+	default:
+		return StrategyRace, fmt.Errorf("unknown generation strategy: %q", value)
+	}
+}
+
+// ImageGenerationService provides a unified interface for image generation.
+// It launches enabled providers from the registry according to the configured
+// strategy and returns the first successful result.
 type ImageGenerationService struct {
-	fusionBrain  *FusionBrainServiceImpl
-	yandexArt    *YandexArtServiceImpl
-	cloudflareAI *CloudflareAIServiceImpl
-	logger       *logger.Logger
+	registry   *ProviderRegistry
+	logger     *logger.Logger
+	strategy   GenerationStrategy
+	hedgeDelay time.Duration
+	stats      *providerStats
+	selection  SelectionMode
+	selector   *adaptiveSelector
+	normalizer *ImageNormalizer
+	inspector  *ImageInspector
+	cache      *ImageCache
+	// flights объединяет одновременные запросы с одинаковым промптом
+	flights *flightGroup[*GenerationResult]
+
+	breakerConfig CircuitBreakerConfig
+	breakersMu    sync.Mutex
+	breakers      map[string]*CircuitBreaker
+}
+
+// ImageServiceOption configures ImageGenerationService
+type ImageServiceOption func(*ImageGenerationService)
+
+// WithStrategy sets the provider launch strategy
+func WithStrategy(strategy GenerationStrategy) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.strategy = strategy
+	}
+}
+
+// WithHedgeDelay sets the fallback delay before launching the next provider in
+// hedged mode. Observed provider latencies take precedence once enough data is collected.
+func WithHedgeDelay(delay time.Duration) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		if delay > 0 {
+			s.hedgeDelay = delay
+		}
+	}
+}
+
+// WithAdaptiveSelection makes the service order providers by observed success
+// rate and latency, exploring a random order with probability epsilon
+func WithAdaptiveSelection(epsilon float64) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.selection = SelectionAdaptive
+		s.selector = newAdaptiveSelector(s.stats, epsilon)
+	}
+}
+
+// WithCircuitBreakerConfig sets thresholds for per-provider circuit breakers
+func WithCircuitBreakerConfig(cfg CircuitBreakerConfig) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.breakerConfig = cfg
+	}
+}
+
+// WithImageNormalizer validates and converts every provider result before it
+// is accepted. Images the normalizer rejects count as provider failures.
+func WithImageNormalizer(normalizer *ImageNormalizer) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.normalizer = normalizer
+	}
+}
+
+// WithImageInspector rejects blank and placeholder images. Such results count
+// as provider failures, so the service keeps waiting for other providers.
+func WithImageInspector(inspector *ImageInspector) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.inspector = inspector
+	}
+}
+
+// WithImageCache serves repeated requests from the cache and stores every
+// generated image in it
+func WithImageCache(cache *ImageCache) ImageServiceOption {
+	return func(s *ImageGenerationService) {
+		s.cache = cache
+	}
 }
 
 // NewImageGenerationService creates a new instance of ImageGenerationService
+// with the built-in providers enabled and ordered according to the configuration
 func NewImageGenerationService(
 	cfg *config.Config,
 	log *logger.Logger,
 	auth YandexAuthService,
-	gpt YandexGPTService,
+	gpt GPTService,
 ) *ImageGenerationService {
-	return &ImageGenerationService{
-		fusionBrain:  NewFusionBrainService(log),
-		yandexArt:    NewYandexArtService(cfg, log, auth, gpt),
-		cloudflareAI: NewCloudflareAIService(log),
-		logger:       log,
+	registry := NewProviderRegistry()
+	registerDefaultProviders(registry, cfg, log, auth, gpt)
+
+	if err := registry.Configure(cfg.ImageProviders); err != nil {
+		log.Warn(context.Background(), "Image provider configuration contains errors", map[string]interface{}{
+			"error":      err.Error(),
+			"registered": registry.Names(),
+		})
 	}
-}
 
-// GenerateImage attempts to generate an image using available services
-func (s *ImageGenerationService) GenerateImage(ctx context.Context, promptText string) ([]byte, error) {
-	// Создаем каналы для получения результатов и ошибок
-	resultChan := make(chan []byte)
-	errorChan := make(chan error)
+	strategy, err := ParseGenerationStrategy(cfg.ImageStrategy)
+	if err != nil {
+		log.Warn(context.Background(), "Invalid image generation strategy, falling back to race", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
 
-	// Запускаем генерацию изображений в параллельных горутинах
-	go func() {
-		if s.fusionBrain != nil {
-			s.logger.Info(ctx, "Attempting FusionBrain image generation", map[string]interface{}{
-				"prompt_length": len(promptText),
-			})
+	opts := []ImageServiceOption{
+		WithStrategy(strategy),
+		WithHedgeDelay(cfg.ImageHedgeDelay),
+		WithCircuitBreakerConfig(CircuitBreakerConfig{
+			Window:      cfg.CircuitBreakerWindow,
+			MinRequests: cfg.CircuitBreakerMinRequests,
+			FailureRate: cfg.CircuitBreakerFailureRate,
+			Cooldown:    cfg.CircuitBreakerCooldown,
+		}),
+		WithImageNormalizer(NewImageNormalizer(ImageNormalizerConfig{
+			MaxSide:     cfg.ImageMaxSide,
+			JPEGQuality: cfg.ImageJPEGQuality,
+		})),
+	}
 
-			imageData, err := s.fusionBrain.GenerateImage(ctx, promptText)
-			if err == nil {
-				s.logger.Info(ctx, "Successfully generated image with FusionBrain", map[string]interface{}{
-					"image_size": len(imageData),
-				})
-				metrics.FusionBrainSuccessCounter.Inc("success")
-				resultChan <- imageData
-				return
-			}
-			s.logger.Error(ctx, "FusionBrain generation failed", map[string]interface{}{
+	var placeholders []uint64
+	for _, value := range cfg.ImagePlaceholderHashes {
+		hash, err := ParsePerceptualHash(value)
+		if err != nil {
+			log.Warn(context.Background(), "Ignoring invalid placeholder hash", map[string]interface{}{
 				"error": err.Error(),
 			})
-			metrics.FusionBrainFailureCounter.Inc("failure")
+			continue
 		}
-		errorChan <- fmt.Errorf("FusionBrain generation failed")
-	}()
+		placeholders = append(placeholders, hash)
+	}
+	opts = append(opts, WithImageInspector(NewImageInspector(ImageInspectorConfig{
+		BlankStdDev:       cfg.ImageBlankStdDev,
+		PlaceholderHashes: placeholders,
+	})))
 
-	go func() {
-		s.logger.Info(ctx, "Attempting YandexArt image generation", map[string]interface{}{
-			"prompt_length": len(promptText),
+	if cfg.ImageCacheSize > 0 || cfg.ImageCacheDir != "" {
+		cache, err := NewImageCache(ImageCacheConfig{
+			MaxEntries:     cfg.ImageCacheSize,
+			MaxMemoryBytes: int64(cfg.ImageCacheMemoryMB) << 20,
+			TTL:            cfg.ImageCacheTTL,
+			Dir:            cfg.ImageCacheDir,
+			MaxDiskBytes:   int64(cfg.ImageCacheDiskMB) << 20,
 		})
-		imageData, err := s.yandexArt.GenerateImage(ctx, promptText)
-		if err == nil {
-			s.logger.Info(ctx, "Successfully generated image with YandexArt", map[string]interface{}{
-				"image_size": len(imageData),
+		if err != nil {
+			log.Warn(context.Background(), "Image cache disabled", map[string]interface{}{
+				"error": err.Error(),
 			})
-			metrics.YandexArtSuccessCounter.Inc("success")
-			resultChan <- imageData
-			return
+		} else {
+			opts = append(opts, WithImageCache(cache))
 		}
-		s.logger.Error(ctx, "YandexArt generation failed", map[string]interface{}{
+	}
+
+	selection, err := ParseSelectionMode(cfg.ImageProviderSelection)
+	if err != nil {
+		log.Warn(context.Background(), "Invalid provider selection mode, falling back to static", map[string]interface{}{
 			"error": err.Error(),
 		})
-		metrics.YandexArtFailureCounter.Inc("failure")
-		errorChan <- fmt.Errorf("YandexArt generation failed")
-	}()
+	}
+	if selection == SelectionAdaptive {
+		opts = append(opts, WithAdaptiveSelection(cfg.ImageAdaptiveEpsilon))
+	}
 
-	// Добавляем третью горутину для Cloudflare AI
-	go func() {
-		if s.cloudflareAI != nil {
-			s.logger.Info(ctx, "Attempting Cloudflare AI image generation", map[string]interface{}{
-				"prompt_length": len(promptText),
+	return NewImageGenerationServiceWithRegistry(log, registry, opts...)
+}
+
+// NewImageGenerationServiceWithRegistry creates an ImageGenerationService
+// that uses providers from the given registry
+func NewImageGenerationServiceWithRegistry(
+	log *logger.Logger,
+	registry *ProviderRegistry,
+	opts ...ImageServiceOption,
+) *ImageGenerationService {
+	s := &ImageGenerationService{
+		registry:   registry,
+		logger:     log,
+		strategy:   StrategyRace,
+		hedgeDelay: defaultHedgeDelay,
+		stats:      newProviderStats(defaultStatsWindow),
+		selection:  SelectionStatic,
+		flights:    newFlightGroup[*GenerationResult](),
+
+		breakerConfig: DefaultCircuitBreakerConfig(),
+		breakers:      make(map[string]*CircuitBreaker),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.selector == nil {
+		// Статистика считается всегда, чтобы ее можно было посмотреть в снимке оценок
+		s.selector = newAdaptiveSelector(s.stats, defaultAdaptiveEpsilon)
+	}
+	if s.selection == SelectionAdaptive && s.strategy == StrategyRace {
+		// В гонке все провайдеры стартуют одновременно, и порядок ни на что не влияет,
+		// а отмененные проигравшие не пополняют статистику
+		log.Warn(context.Background(), "Adaptive provider selection does not work with the race strategy, using hedged", map[string]interface{}{
+			"hedge_delay": s.hedgeDelay.String(),
+		})
+		s.strategy = StrategyHedged
+	}
+
+	// Создаем breaker'ы заранее, чтобы их состояние сразу попало в метрики
+	for _, name := range registry.Names() {
+		s.breaker(name)
+	}
+	return s
+}
+
+// Registry returns the provider registry used by the service
+func (s *ImageGenerationService) Registry() *ProviderRegistry {
+	return s.registry
+}
+
+// ProviderStates returns circuit breaker states of the enabled providers
+func (s *ImageGenerationService) ProviderStates() map[string]BreakerState {
+	providers := s.registry.Providers()
+	states := make(map[string]BreakerState, len(providers))
+	for _, provider := range providers {
+		states[provider.Name] = s.breaker(provider.Name).State()
+	}
+	return states
+}
+
+// ProviderScores returns a snapshot of observed statistics and adaptive scores
+// of the enabled providers, in the order the next request would try them
+// (ignoring exploration rounds)
+func (s *ImageGenerationService) ProviderScores() []ProviderScore {
+	providers := s.registry.Providers()
+	if s.selection == SelectionAdaptive {
+		providers = s.selector.rank(providers)
+	}
+
+	scores := make([]ProviderScore, 0, len(providers))
+	for _, provider := range providers {
+		score := s.selector.snapshot(provider.Name)
+		score.BreakerState = s.breaker(provider.Name).State().String()
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+// Ready reports whether at least one enabled provider can accept requests
+func (s *ImageGenerationService) Ready() bool {
+	for _, state := range s.ProviderStates() {
+		if state != BreakerOpen {
+			return true
+		}
+	}
+	return false
+}
+
+// breaker returns the circuit breaker of the provider, creating it on first use
+func (s *ImageGenerationService) breaker(provider string) *CircuitBreaker {
+	s.breakersMu.Lock()
+	defer s.breakersMu.Unlock()
+
+	breaker, ok := s.breakers[provider]
+	if !ok {
+		breaker = NewCircuitBreaker(s.breakerConfig, func(from, to BreakerState) {
+			s.logger.Warn(context.Background(), "Provider circuit breaker state changed", map[string]interface{}{
+				"provider": provider,
+				"from":     from.String(),
+				"to":       to.String(),
 			})
+		})
+		s.breakers[provider] = breaker
+		// Состояние читается при сборе метрик: переход open -> half-open
+		// происходит по истечении cool-down без какого-либо события
+		metrics.CircuitBreakerState.SetFunc(provider, func() float64 {
+			return float64(breaker.State())
+		})
+	}
+	return breaker
+}
+
+// providerNames returns names of the given providers
+func providerNames(providers []ImageProvider) []string {
+	names := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		names = append(names, provider.Name)
+	}
+	return names
+}
+
+// providerResult holds the outcome of a single provider call
+type providerResult struct {
+	provider string
+	result   *GenerationResult
+	err      error
+}
+
+// GenerateImage attempts to generate an image using available services.
+// A request with an explicit seed is reproducible, so a cached image generated
+// from the same prompt and options is returned immediately unless the options
+// ask to bypass the cache. Requests without a seed always get a new image.
+// Concurrent requests with the same normalized prompt and options share a single
+// generation: it keeps running while at least one of the callers is waiting for it.
+func (s *ImageGenerationService) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	opts := imageOptions(ctx)
+	key := newImageCacheKey(promptText, opts)
+	if cached := s.cachedImage(ctx, key, opts); cached != nil {
+		return cached, nil
+	}
 
-			imageData, err := s.cloudflareAI.GenerateImage(ctx, promptText)
-			if err == nil {
-				s.logger.Info(ctx, "Successfully generated image with Cloudflare AI", map[string]interface{}{
-					"image_size": len(imageData),
+	result, shared, err := s.flights.Do(ctx, key.Hash(), func(ctx context.Context) (*GenerationResult, error) {
+		result, err := s.generateImage(ctx, promptText, opts)
+		if err == nil && s.cacheable(opts, result) {
+			if err := s.cache.Put(key, result); err != nil {
+				s.logger.Warn(ctx, "Failed to cache generated image", map[string]interface{}{
+					"error": err.Error(),
 				})
-				metrics.CloudflareAISuccessCounter.Inc("success")
-				resultChan <- imageData
-				return
 			}
-			s.logger.Error(ctx, "Cloudflare AI generation failed", map[string]interface{}{
-				"error": err.Error(),
-			})
-			metrics.CloudflareAIFailureCounter.Inc("failure")
 		}
-		errorChan <- fmt.Errorf("Cloudflare AI generation failed")
+		return result, err
+	})
+	if shared {
+		s.logger.Debug(ctx, "Image generation collapsed into an in-flight request", map[string]interface{}{
+			"prompt_length": len(promptText),
+		})
+		metrics.RequestsCollapsed.Inc("generate_image")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Каждый вызывающий получает свою копию, чтобы изменения полей не влияли на других
+	clone := *result
+	return &clone, nil
+}
+
+// cacheable reports whether the result of a request may be served again.
+// Without a seed the user expects a new picture every time, and last resort
+// providers are only a stand-in for a failed generation.
+func (s *ImageGenerationService) cacheable(opts ImageOptions, result *GenerationResult) bool {
+	if s.cache == nil || opts.Seed == "" {
+		return false
+	}
+	if result == nil {
+		return true
+	}
+	return !slices.ContainsFunc(s.registry.Providers(), func(provider ImageProvider) bool {
+		return provider.LastResort && provider.Name == result.Provider
+	})
+}
+
+// cachedImage returns the cached result for key, counting hits and misses.
+// It returns nil when there is no cache, no entry or the request is not
+// cacheable or bypasses the cache.
+func (s *ImageGenerationService) cachedImage(ctx context.Context, key ImageCacheKey, opts ImageOptions) *GenerationResult {
+	if !s.cacheable(opts, nil) {
+		return nil
+	}
+	if opts.NoCache {
+		metrics.ImageCacheMisses.Inc("bypass")
+		return nil
+	}
+
+	result, tier := s.cache.Get(key)
+	if result == nil {
+		metrics.ImageCacheMisses.Inc("miss")
+		return nil
+	}
+	metrics.ImageCacheHits.Inc(tier)
+	s.logger.Info(ctx, "Image served from cache", map[string]interface{}{
+		"provider": result.Provider,
+		"model":    result.Model,
+		"seed":     result.Seed,
+		"tier":     tier,
+	})
+	result.Cached = true
+	return result
+}
+
+// generateImage runs a single generation with providers in the configured order
+func (s *ImageGenerationService) generateImage(ctx context.Context, promptText string, opts ImageOptions) (*GenerationResult, error) {
+	providers := s.registry.Providers()
+	if opts.Provider != "" {
+		// Запрошен конкретный провайдер - остальные не запускаем
+		providers = slices.DeleteFunc(providers, func(provider ImageProvider) bool {
+			return provider.Name != opts.Provider
+		})
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("image generation provider %q is not enabled", opts.Provider)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no image generation providers enabled")
+	}
+
+	// Запасные провайдеры не участвуют в гонке и ждут, пока не откажут все остальные
+	var lastResort []ImageProvider
+	if opts.Provider == "" {
+		providers = slices.DeleteFunc(providers, func(provider ImageProvider) bool {
+			if provider.LastResort {
+				lastResort = append(lastResort, provider)
+			}
+			return provider.LastResort
+		})
+	}
+	if len(providers) == 0 {
+		return s.generate(ctx, lastResort, promptText, StrategySequential)
+	}
+
+	if s.selection == SelectionAdaptive {
+		var exploring bool
+		providers, exploring = s.selector.order(providers)
+		s.logger.Debug(ctx, "Adaptive provider order selected", map[string]interface{}{
+			"order":     providerNames(providers),
+			"exploring": exploring,
+		})
+	}
+
+	result, err := s.generate(ctx, providers, promptText, s.strategy)
+	if err == nil || len(lastResort) == 0 || ctx.Err() != nil {
+		return result, err
+	}
+
+	s.logger.Warn(ctx, "All image providers failed, falling back to last resort providers", map[string]interface{}{
+		"providers": providerNames(lastResort),
+		"error":     err.Error(),
+	})
+	result, fallbackErr := s.generate(ctx, lastResort, promptText, StrategySequential)
+	if fallbackErr != nil {
+		return nil, errors.Join(err, fallbackErr)
+	}
+	return result, nil
+}
+
+// ErrNothingToResume is returned by ResumeImage when none of the operations
+// belongs to an enabled provider that can resume them
+var ErrNothingToResume = errors.New("no resumable operations")
+
+// resumedOperation adapts an operation started before a restart to ImageGenerator
+type resumedOperation struct {
+	generator   ResumableGenerator
+	operationID string
+}
+
+// GenerateImage waits for the operation; the prompt has already been sent
+func (r resumedOperation) GenerateImage(ctx context.Context, _ string) (*GenerationResult, error) {
+	return r.generator.ResumeImage(ctx, r.operationID)
+}
+
+// ResumeImage waits for provider operations started before a restart.
+// operations maps provider names to operation IDs. The operations are already
+// running on the provider side, so all of them are awaited at once and the
+// first valid image wins.
+func (s *ImageGenerationService) ResumeImage(ctx context.Context, promptText string, operations map[string]string) (*GenerationResult, error) {
+	var providers []ImageProvider
+	for _, provider := range s.registry.Providers() {
+		operationID, ok := operations[provider.Name]
+		if !ok {
+			continue
+		}
+		resumable, ok := provider.Generator.(ResumableGenerator)
+		if !ok {
+			continue
+		}
+		provider.Generator = resumedOperation{generator: resumable, operationID: operationID}
+		providers = append(providers, provider)
+	}
+	if len(providers) == 0 {
+		return nil, ErrNothingToResume
+	}
+
+	return s.generate(ctx, providers, promptText, StrategyRace)
+}
+
+// generate launches providers in order according to the strategy and returns
+// the first successful result. Once a winner is chosen (or the caller gives up)
+// the derived context is cancelled, so the remaining providers stop polling
+// their APIs. The results channel is buffered for every provider, which
+// guarantees that no goroutine blocks on send after generate has returned.
+func (s *ImageGenerationService) generate(
+	ctx context.Context,
+	providers []ImageProvider,
+	promptText string,
+	strategy GenerationStrategy,
+) (*GenerationResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan providerResult, len(providers))
+	next, pending := 0, 0
+	var errs []error
+
+	// launch запускает следующий по порядку провайдер, пропуская провайдеры
+	// с открытым circuit breaker. Возвращает имя запущенного провайдера.
+	launch := func() (string, bool) {
+		for next < len(providers) {
+			provider := providers[next]
+			next++
+
+			if !s.breaker(provider.Name).Allow() {
+				s.logger.Debug(ctx, "Skipping provider with open circuit breaker", map[string]interface{}{
+					"provider": provider.Name,
+				})
+				metrics.CircuitBreakerRejections.Inc(provider.Name)
+				errs = append(errs, fmt.Errorf("%s: %w", provider.Name, ErrCircuitOpen))
+				continue
+			}
+
+			pending++
+			go func() {
+				results <- s.runProvider(ctx, provider, promptText)
+			}()
+			return provider.Name, true
+		}
+		return "", false
+	}
+
+	// hedgeTimer срабатывает, когда пора запускать следующий провайдер, не дожидаясь ошибки
+	var hedgeTimer *time.Timer
+	var hedgeC <-chan time.Time
+	defer func() {
+		if hedgeTimer != nil {
+			hedgeTimer.Stop()
+		}
 	}()
 
-	// Ожидаем первый успешный результат или все ошибки
-	var errors []error
+	// launchNext запускает следующие провайдеры согласно стратегии и взводит таймер хеджирования
+	launchNext := func() {
+		if hedgeTimer != nil {
+			hedgeTimer.Stop()
+			hedgeTimer, hedgeC = nil, nil
+		}
+		for next < len(providers) {
+			name, ok := launch()
+			if !ok || next == len(providers) {
+				return
+			}
+			delay, ok := s.launchDelay(strategy, name)
+			if !ok {
+				return
+			}
+			if delay > 0 {
+				hedgeTimer = time.NewTimer(delay)
+				hedgeC = hedgeTimer.C
+				return
+			}
+		}
+	}
 
-	for i := 0; i < 3; i++ {
+	launchNext()
+
+	// Ожидаем первый успешный результат или ошибки от всех провайдеров
+	for pending > 0 {
 		select {
-		case imageData := <-resultChan:
-			return imageData, nil
-		case err := <-errorChan:
-			errors = append(errors, err)
-			if len(errors) == 2 {
-				return nil, fmt.Errorf("all image generation services failed: %w", errors[0])
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				s.logger.Debug(ctx, "Provider won, cancelling the rest", map[string]interface{}{
+					"provider": result.provider,
+					"strategy": string(strategy),
+				})
+				return result.result, nil
 			}
+			errs = append(errs, fmt.Errorf("%s: %w", result.provider, result.err))
+			// Провайдер упал - сразу переходим к следующему
+			launchNext()
+		case <-hedgeC:
+			s.logger.Debug(ctx, "No result within hedge delay, launching next provider", map[string]interface{}{
+				"launched": next,
+				"total":    len(providers),
+			})
+			hedgeTimer, hedgeC = nil, nil
+			launchNext()
+		case <-ctx.Done():
+			return nil, fmt.Errorf("image generation cancelled: %w", ctx.Err())
+		}
+	}
+
+	return nil, fmt.Errorf("all image generation services failed: %w", errors.Join(errs...))
+}
+
+// launchDelay returns how long to wait for the given (already launched) provider
+// before starting the next one. The second value is false when the next provider
+// must be started only after a failure.
+func (s *ImageGenerationService) launchDelay(strategy GenerationStrategy, provider string) (time.Duration, bool) {
+	switch strategy {
+	case StrategyHedged:
+		if observed, ok := s.stats.latencyPercentile(provider, 0.5); ok {
+			return observed, true
 		}
+		return s.hedgeDelay, true
+	case StrategySequential:
+		return 0, false
+	default:
+		return 0, true
 	}
+}
 
-	return nil, fmt.Errorf("unexpected error: no results received")
+// runProvider calls a single provider, logging and counting the outcome
+func (s *ImageGenerationService) runProvider(ctx context.Context, provider ImageProvider, promptText string) providerResult {
+	s.logger.Info(ctx, "Attempting image generation", map[string]interface{}{
+		"provider":      provider.Name,
+		"prompt_length": len(promptText),
+	})
+
+	startTime := time.Now()
+	result, err := generateWithPrompt(withProviderName(ctx, provider.Name), provider.Generator, promptText)
+	latency := time.Since(startTime)
+	if err == nil && (result == nil || len(result.Image) == 0) {
+		err = fmt.Errorf("provider returned no image")
+	}
+	if err == nil {
+		// Битое, однотонное или зацензуренное изображение - это ошибка провайдера, пусть победит другой
+		err = s.validate(ctx, provider.Name, result)
+	}
+	if err != nil {
+		// Отмененный провайдер проиграл гонку, это не ошибка провайдера
+		if ctx.Err() != nil {
+			s.breaker(provider.Name).Release()
+			s.logger.Debug(ctx, "Image generation cancelled", map[string]interface{}{
+				"provider": provider.Name,
+				"reason":   ctx.Err().Error(),
+			})
+			return providerResult{provider: provider.Name, err: err}
+		}
+		reason := failureReason(err)
+		s.logger.Error(ctx, "Image generation failed", map[string]interface{}{
+			"provider": provider.Name,
+			"reason":   reason,
+			"error":    err.Error(),
+		})
+		provider.failureCounter.Inc(reason)
+		if reason != "failure" {
+			metrics.ImageRejections.Inc(reason)
+		}
+		s.stats.observe(provider.Name, latency, false)
+		s.breaker(provider.Name).Record(false)
+		return providerResult{provider: provider.Name, err: err}
+	}
+
+	result.Provider = provider.Name
+	result.Latency = latency
+	if result.Prompt == "" {
+		result.Prompt = promptText
+	}
+	if result.MIMEType == "" {
+		result.MIMEType = detectMIMEType(result.Image)
+	}
+
+	s.logger.Info(ctx, "Successfully generated image", map[string]interface{}{
+		"provider":   provider.Name,
+		"model":      result.Model,
+		"seed":       result.Seed,
+		"image_size": len(result.Image),
+		"latency":    latency.String(),
+		"attempts":   result.Attempts,
+	})
+	provider.successCounter.Inc("success")
+	s.stats.observe(provider.Name, latency, true)
+	s.breaker(provider.Name).Record(true)
+	return providerResult{provider: provider.Name, result: result}
+}
+
+// validate rejects censored and degenerate images and replaces the provider
+// image with its normalized version
+func (s *ImageGenerationService) validate(ctx context.Context, provider string, result *GenerationResult) error {
+	if result.Censored {
+		return fmt.Errorf("%w: provider replaced the image with a placeholder", ErrCensoredImage)
+	}
+
+	var decoded image.Image
+	if s.normalizer != nil {
+		originalSize := len(result.Image)
+		normalized, err := s.normalizer.Normalize(result.Image)
+		if err != nil {
+			return fmt.Errorf("provider returned unusable image: %w", err)
+		}
+
+		s.logger.Debug(ctx, "Image normalized", map[string]interface{}{
+			"provider":      provider,
+			"source_format": normalized.SourceFormat,
+			"original_size": originalSize,
+			"size":          len(normalized.Data),
+			"width":         normalized.Width,
+			"height":        normalized.Height,
+		})
+		result.Image = normalized.Data
+		result.MIMEType = normalized.MIMEType
+		decoded = normalized.Image
+	}
+
+	if s.inspector != nil {
+		var err error
+		if decoded != nil {
+			err = s.inspector.InspectImage(decoded)
+		} else {
+			err = s.inspector.Inspect(result.Image)
+		}
+		if err != nil {
+			return fmt.Errorf("provider returned unusable image: %w", err)
+		}
+	}
+
+	if decoded != nil {
+		// Хэш пригодится, чтобы добавить новую заглушку в IMAGE_PLACEHOLDER_HASHES
+		s.logger.Debug(ctx, "Image accepted", map[string]interface{}{
+			"provider":        provider,
+			"perceptual_hash": fmt.Sprintf("%016x", PerceptualHash(decoded)),
+		})
+	}
+	return nil
 }
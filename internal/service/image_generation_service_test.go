@@ -0,0 +1,624 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGenerator имитирует провайдера изображений с заданной задержкой и результатом
+type fakeGenerator struct {
+	delay         time.Duration
+	image         []byte
+	err           error
+	ignoreContext bool // продолжает "работать" после отмены контекста
+	censored      bool
+	calls         atomic.Int32
+}
+
+func (f *fakeGenerator) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	f.calls.Add(1)
+	timer := time.NewTimer(f.delay)
+	defer timer.Stop()
+
+	if !f.ignoreContext {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else {
+		<-timer.C
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &GenerationResult{Image: f.image, Model: "fake-model", Attempts: 1, Censored: f.censored}, nil
+}
+
+func newTestService(
+	t *testing.T,
+	generators map[string]*fakeGenerator,
+	order []string,
+	opts ...ImageServiceOption,
+) *ImageGenerationService {
+	t.Helper()
+
+	registry := NewProviderRegistry()
+	for _, name := range order {
+		assert.NoError(t, registry.Register(name, generators[name]))
+	}
+	return NewImageGenerationServiceWithRegistry(newQuietLogger(), registry, opts...)
+}
+
+// assertNoLeakedGoroutines ждет, пока количество горутин вернется к исходному
+func assertNoLeakedGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			n := runtime.Stack(buf, true)
+			t.Fatalf("goroutines leaked: have %d, want %d\n%s", runtime.NumGoroutine(), baseline, buf[:n])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestImageGenerationService_FirstWinnerCancelsOthers(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	svc := newTestService(t, map[string]*fakeGenerator{
+		"fast":     {delay: 10 * time.Millisecond, image: []byte("fast")},
+		"slow":     {delay: time.Minute, image: []byte("slow")},
+		"stubborn": {delay: 200 * time.Millisecond, image: []byte("stubborn"), ignoreContext: true},
+	}, []string{"slow", "stubborn", "fast"})
+
+	start := time.Now()
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("fast"), image.Image)
+	assert.Equal(t, "fast", image.Provider)
+	assert.Equal(t, "fake-model", image.Model)
+	assert.Equal(t, "prompt", image.Prompt)
+	assert.Positive(t, image.Latency)
+	assert.Less(t, time.Since(start), time.Second)
+	assertNoLeakedGoroutines(t, baseline)
+}
+
+func TestImageGenerationService_AllProvidersFail(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+	svc := newTestService(t, map[string]*fakeGenerator{
+		"first":  {delay: 5 * time.Millisecond, err: errFirst},
+		"second": {delay: 20 * time.Millisecond, err: errSecond},
+		"third":  {delay: 30 * time.Millisecond, err: errors.New("third failed")},
+	}, []string{"first", "second", "third"})
+
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.Nil(t, image)
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errSecond)
+	assert.Contains(t, err.Error(), "third failed")
+	assertNoLeakedGoroutines(t, baseline)
+}
+
+func TestImageGenerationService_LastResortProvider(t *testing.T) {
+	newService := func(api, template *fakeGenerator) *ImageGenerationService {
+		registry := NewProviderRegistry()
+		assert.NoError(t, registry.Register("template", template, WithProviderLastResort()))
+		assert.NoError(t, registry.Register("api", api))
+		return NewImageGenerationServiceWithRegistry(newQuietLogger(), registry)
+	}
+
+	// Мгновенный запасной провайдер не участвует в гонке
+	template := &fakeGenerator{image: []byte("template")}
+	svc := newService(&fakeGenerator{delay: 30 * time.Millisecond, image: []byte("api")}, template)
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+	assert.Equal(t, "api", image.Provider)
+	assert.Zero(t, template.calls.Load())
+
+	// Запасной провайдер запускается, когда остальные не справились
+	svc = newService(&fakeGenerator{err: errors.New("api failed")}, template)
+	image, err = svc.GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+	assert.Equal(t, "template", image.Provider)
+	assert.Equal(t, int32(1), template.calls.Load())
+
+	// Ошибка содержит причины отказа всех провайдеров
+	svc = newService(&fakeGenerator{err: errors.New("api failed")}, &fakeGenerator{err: errors.New("no templates")})
+	_, err = svc.GenerateImage(context.Background(), "other prompt")
+	assert.ErrorContains(t, err, "api failed")
+	assert.ErrorContains(t, err, "no templates")
+
+	// Явно запрошенный запасной провайдер запускается сразу
+	api := &fakeGenerator{image: []byte("api")}
+	svc = newService(api, &fakeGenerator{image: []byte("template")})
+	ctx := WithImageOptions(context.Background(), ImageOptions{Provider: "template"})
+	image, err = svc.GenerateImage(ctx, "prompt")
+	assert.NoError(t, err)
+	assert.Equal(t, "template", image.Provider)
+	assert.Zero(t, api.calls.Load())
+}
+
+func TestImageGenerationService_ContextTimeout(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	svc := newTestService(t, map[string]*fakeGenerator{
+		"slow":     {delay: time.Minute, image: []byte("slow")},
+		"slower":   {delay: 2 * time.Minute, image: []byte("slower")},
+		"stubborn": {delay: 100 * time.Millisecond, image: []byte("stubborn"), ignoreContext: true},
+	}, []string{"slow", "slower", "stubborn"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	image, err := svc.GenerateImage(ctx, "prompt")
+
+	assert.Nil(t, image)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assertNoLeakedGoroutines(t, baseline)
+}
+
+func TestImageGenerationService_HedgedSkipsBackupWhenPreferredIsFast(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"preferred": {delay: 10 * time.Millisecond, image: []byte("preferred")},
+		"backup":    {delay: 10 * time.Millisecond, image: []byte("backup")},
+	}
+	svc := newTestService(t, generators, []string{"preferred", "backup"},
+		WithStrategy(StrategyHedged),
+		WithHedgeDelay(time.Second),
+	)
+
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("preferred"), image.Image)
+	assert.Equal(t, int32(0), generators["backup"].calls.Load())
+}
+
+func TestImageGenerationService_HedgedLaunchesBackupAfterDelay(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	generators := map[string]*fakeGenerator{
+		"preferred": {delay: time.Minute, image: []byte("preferred")},
+		"backup":    {delay: 10 * time.Millisecond, image: []byte("backup")},
+	}
+	svc := newTestService(t, generators, []string{"preferred", "backup"},
+		WithStrategy(StrategyHedged),
+		WithHedgeDelay(50*time.Millisecond),
+	)
+
+	start := time.Now()
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("backup"), image.Image)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assertNoLeakedGoroutines(t, baseline)
+}
+
+func TestImageGenerationService_HedgedLaunchesBackupOnFailure(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"preferred": {delay: 5 * time.Millisecond, err: errors.New("boom")},
+		"backup":    {delay: 5 * time.Millisecond, image: []byte("backup")},
+	}
+	svc := newTestService(t, generators, []string{"preferred", "backup"},
+		WithStrategy(StrategyHedged),
+		WithHedgeDelay(time.Minute),
+	)
+
+	start := time.Now()
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("backup"), image.Image)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestImageGenerationService_SequentialFallback(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"first":  {delay: 30 * time.Millisecond, err: errors.New("boom")},
+		"second": {delay: 5 * time.Millisecond, image: []byte("second")},
+		"third":  {delay: 5 * time.Millisecond, image: []byte("third")},
+	}
+	svc := newTestService(t, generators, []string{"first", "second", "third"},
+		WithStrategy(StrategySequential),
+	)
+
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second"), image.Image)
+	assert.Equal(t, int32(1), generators["first"].calls.Load())
+	assert.Equal(t, int32(0), generators["third"].calls.Load())
+}
+
+func TestImageGenerationService_SkipsProviderWithOpenBreaker(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"broken":  {delay: time.Millisecond, err: errors.New("down")},
+		"healthy": {delay: 30 * time.Millisecond, image: []byte("healthy")},
+	}
+	svc := newTestService(t, generators, []string{"broken", "healthy"},
+		WithCircuitBreakerConfig(CircuitBreakerConfig{
+			Window:      2,
+			MinRequests: 2,
+			FailureRate: 1,
+			Cooldown:    time.Hour,
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.GenerateImage(context.Background(), "prompt")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, BreakerOpen, svc.ProviderStates()["broken"])
+	assert.True(t, svc.Ready())
+
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("healthy"), image.Image)
+	assert.Equal(t, int32(2), generators["broken"].calls.Load())
+}
+
+func TestImageGenerationService_InvalidImageIsProviderFailure(t *testing.T) {
+	valid := encodeTestImage(t, "png", 32, 32)
+	generators := map[string]*fakeGenerator{
+		"corrupted": {delay: time.Millisecond, image: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00}},
+		"valid":     {delay: 20 * time.Millisecond, image: valid},
+	}
+	svc := newTestService(t, generators, []string{"corrupted", "valid"},
+		WithImageNormalizer(NewImageNormalizer(DefaultImageNormalizerConfig())),
+	)
+
+	image, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "valid", image.Provider)
+	assert.Equal(t, "image/jpeg", image.MIMEType)
+
+	corrupted := svc.ProviderScores()[0]
+	assert.Equal(t, "corrupted", corrupted.Name)
+	assert.Equal(t, 1, corrupted.Calls)
+	assert.Zero(t, corrupted.SuccessRate)
+}
+
+func TestImageGenerationService_WaitsForUncensoredImage(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"censored": {delay: time.Millisecond, image: []byte("placeholder"), censored: true},
+		"blank":    {delay: 5 * time.Millisecond, image: encodePNG(t, image.NewRGBA(image.Rect(0, 0, 32, 32)))},
+		"picture":  {delay: 30 * time.Millisecond, image: encodePNG(t, newPictureImage(64, 64, 1))},
+	}
+	svc := newTestService(t, generators, []string{"censored", "blank", "picture"},
+		WithImageInspector(NewImageInspector(ImageInspectorConfig{})),
+	)
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "picture", result.Provider)
+	assert.False(t, result.Censored)
+}
+
+func TestImageGenerationService_AllImagesCensored(t *testing.T) {
+	svc := newTestService(t, map[string]*fakeGenerator{
+		"censored": {delay: time.Millisecond, image: []byte("placeholder"), censored: true},
+	}, []string{"censored"})
+
+	_, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.ErrorIs(t, err, ErrCensoredImage)
+}
+
+// fakeResumableGenerator дожидается ранее запущенных операций
+type fakeResumableGenerator struct {
+	fakeGenerator
+	operations map[string][]byte
+	resumed    atomic.Int32
+}
+
+func (f *fakeResumableGenerator) ResumeImage(ctx context.Context, operationID string) (*GenerationResult, error) {
+	f.resumed.Add(1)
+	image, ok := f.operations[operationID]
+	if !ok {
+		return nil, errors.New("operation not found")
+	}
+	return &GenerationResult{Image: image}, nil
+}
+
+func TestImageGenerationService_ResumeImage(t *testing.T) {
+	yandex := &fakeResumableGenerator{operations: map[string][]byte{"op-1": []byte("resumed")}}
+	fusion := &fakeResumableGenerator{}
+	registry := NewProviderRegistry()
+	assert.NoError(t, registry.Register("yandex", yandex))
+	assert.NoError(t, registry.Register("fusion", fusion))
+	assert.NoError(t, registry.Register("plain", &fakeGenerator{image: []byte("new")}))
+	svc := NewImageGenerationServiceWithRegistry(newQuietLogger(), registry,
+		WithStrategy(StrategySequential),
+	)
+
+	image, err := svc.ResumeImage(context.Background(), "prompt", map[string]string{
+		"fusion": "lost",
+		"yandex": "op-1",
+		"plain":  "ignored",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("resumed"), image.Image)
+	assert.Equal(t, "yandex", image.Provider)
+	assert.Equal(t, "prompt", image.Prompt)
+	assert.Equal(t, int32(0), yandex.calls.Load(), "generation must not start over")
+
+	_, err = svc.ResumeImage(context.Background(), "prompt", map[string]string{"plain": "op"})
+	assert.ErrorIs(t, err, ErrNothingToResume)
+}
+
+func TestImageGenerationService_CollapsesIdenticalRequests(t *testing.T) {
+	generator := &fakeGenerator{delay: 50 * time.Millisecond, image: []byte("image")}
+	svc := newTestService(t, map[string]*fakeGenerator{"only": generator}, []string{"only"})
+
+	prompts := []string{"Кот в шляпе", "кот  в шляпе", " КОТ В ШЛЯПЕ "}
+	results := make([]*GenerationResult, len(prompts))
+	var wg sync.WaitGroup
+	for i, prompt := range prompts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := svc.GenerateImage(context.Background(), prompt)
+			assert.NoError(t, err)
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), generator.calls.Load())
+	for _, result := range results {
+		if assert.NotNil(t, result) {
+			assert.Equal(t, "only", result.Provider)
+		}
+	}
+	// У каждого вызывающего своя копия результата
+	assert.NotSame(t, results[0], results[1])
+
+	// Разные промпты генерируются независимо
+	_, err := svc.GenerateImage(context.Background(), "собака в шляпе")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), generator.calls.Load())
+}
+
+// trackingGenerator запускает "асинхронную операцию" и ждет разрешения ее завершить
+type trackingGenerator struct {
+	proceed chan struct{}
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g *trackingGenerator) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	<-g.proceed
+	if err := trackOperation(ctx, "op-1"); err != nil {
+		return nil, err
+	}
+	close(g.started)
+	<-g.release
+	return &GenerationResult{Image: []byte("image")}, nil
+}
+
+func TestImageGenerationService_CollapsedRequestsTrackOperations(t *testing.T) {
+	generator := &trackingGenerator{
+		proceed: make(chan struct{}),
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	registry := NewProviderRegistry()
+	assert.NoError(t, registry.Register("only", generator))
+	svc := NewImageGenerationServiceWithRegistry(newQuietLogger(), registry)
+
+	waiters := func() int {
+		svc.flights.mu.Lock()
+		defer svc.flights.mu.Unlock()
+		for _, call := range svc.flights.calls {
+			return call.waiters
+		}
+		return 0
+	}
+	trackers := []*recordingTracker{{}, {}, {}}
+	var wg sync.WaitGroup
+	generate := func(tracker *recordingTracker) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.GenerateImage(WithGenerationTracker(context.Background(), tracker), "prompt")
+			assert.NoError(t, err)
+		}()
+	}
+
+	// Первые два запроса ждут общую генерацию до запуска операции
+	generate(trackers[0])
+	assert.Eventually(t, func() bool { return waiters() == 1 }, time.Second, time.Millisecond)
+	generate(trackers[1])
+	assert.Eventually(t, func() bool { return waiters() == 2 }, time.Second, time.Millisecond)
+	close(generator.proceed)
+	<-generator.started
+
+	// Третий присоединяется, когда операция уже запущена
+	generate(trackers[2])
+	assert.Eventually(t, func() bool { return waiters() == 3 }, time.Second, time.Millisecond)
+	close(generator.release)
+	wg.Wait()
+
+	for _, tracker := range trackers {
+		assert.Equal(t, map[string]string{"only": "op-1"}, tracker.operations)
+	}
+}
+
+func TestImageGenerationService_ServesRepeatedSeededPromptFromCache(t *testing.T) {
+	cache, err := NewImageCache(DefaultImageCacheConfig())
+	assert.NoError(t, err)
+	generator := &fakeGenerator{delay: time.Millisecond, image: []byte("image")}
+	svc := newTestService(t, map[string]*fakeGenerator{"only": generator}, []string{"only"},
+		WithImageCache(cache))
+	seeded := WithImageOptions(context.Background(), ImageOptions{Seed: "42"})
+
+	first, err := svc.GenerateImage(seeded, "Кот в шляпе")
+	assert.NoError(t, err)
+	assert.False(t, first.Cached)
+
+	second, err := svc.GenerateImage(seeded, "кот в шляпе")
+	assert.NoError(t, err)
+	assert.True(t, second.Cached)
+	assert.Equal(t, first.Image, second.Image)
+	assert.Equal(t, "only", second.Provider)
+	assert.Equal(t, int32(1), generator.calls.Load())
+
+	// Другие параметры - другой ключ кэша
+	ctx := WithImageOptions(context.Background(), ImageOptions{Seed: "42", AspectRatio: "16:9"})
+	_, err = svc.GenerateImage(ctx, "кот в шляпе")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), generator.calls.Load())
+
+	// Пользователь попросил не брать результат из кэша
+	ctx = WithImageOptions(context.Background(), ImageOptions{Seed: "42", NoCache: true})
+	bypassed, err := svc.GenerateImage(ctx, "кот в шляпе")
+	assert.NoError(t, err)
+	assert.False(t, bypassed.Cached)
+	assert.Equal(t, int32(3), generator.calls.Load())
+}
+
+func TestImageGenerationService_DoesNotCacheUnseededOrLastResortResults(t *testing.T) {
+	cache, err := NewImageCache(DefaultImageCacheConfig())
+	assert.NoError(t, err)
+	generators := map[string]*fakeGenerator{
+		"broken":   {delay: time.Millisecond, err: errors.New("unavailable")},
+		"template": {delay: time.Millisecond, image: []byte("template")},
+	}
+	registry := NewProviderRegistry()
+	assert.NoError(t, registry.Register("broken", generators["broken"]))
+	assert.NoError(t, registry.Register("template", generators["template"], WithProviderLastResort()))
+	svc := NewImageGenerationServiceWithRegistry(newQuietLogger(), registry, WithImageCache(cache))
+
+	// Без сида каждый запрос получает новую картинку
+	for i := 0; i < 2; i++ {
+		result, err := svc.GenerateImage(context.Background(), "кот в шляпе")
+		assert.NoError(t, err)
+		assert.False(t, result.Cached)
+	}
+	assert.Equal(t, int32(2), generators["template"].calls.Load())
+
+	// Заглушка последнего шанса не заменяет настоящую генерацию и с сидом
+	seeded := WithImageOptions(context.Background(), ImageOptions{Seed: "42"})
+	for i := 0; i < 2; i++ {
+		result, err := svc.GenerateImage(seeded, "кот в шляпе")
+		assert.NoError(t, err)
+		assert.False(t, result.Cached)
+	}
+	assert.Equal(t, int32(4), generators["template"].calls.Load())
+	assert.Equal(t, int32(4), generators["broken"].calls.Load())
+}
+
+func TestParseMemeArgs(t *testing.T) {
+	prompt, opts := ParseMemeArgs("  --no-cache   кот в шляпе")
+	assert.Equal(t, "кот в шляпе", prompt)
+	assert.True(t, opts.NoCache)
+
+	prompt, opts = ParseMemeArgs("--NOCACHE")
+	assert.Empty(t, prompt)
+	assert.True(t, opts.NoCache)
+
+	prompt, opts = ParseMemeArgs("кот --no-cache")
+	assert.Equal(t, "кот --no-cache", prompt)
+	assert.False(t, opts.NoCache)
+
+	prompt, opts = ParseMemeArgs("--- мем про понедельник")
+	assert.Equal(t, "--- мем про понедельник", prompt)
+	assert.False(t, opts.NoCache)
+
+	prompt, opts = ParseMemeArgs("--seed 42 --ar 16:9 кот")
+	assert.Equal(t, "кот", prompt)
+	assert.Equal(t, ImageOptions{Seed: "42", AspectRatio: "16:9"}, opts)
+
+	// Неподдерживаемые значения остаются частью промпта
+	prompt, opts = ParseMemeArgs("--seed 7 --ar 21:9 кот")
+	assert.Equal(t, "--ar 21:9 кот", prompt)
+	assert.Equal(t, ImageOptions{Seed: "7"}, opts)
+
+	prompt, opts = ParseMemeArgs("--seed много котов")
+	assert.Equal(t, "--seed много котов", prompt)
+	assert.Empty(t, opts.Seed)
+
+	prompt, opts = ParseMemeArgs("--caption BOTH --no-cache кот")
+	assert.Equal(t, "кот", prompt)
+	assert.Equal(t, ImageOptions{CaptionMode: CaptionModeBoth, NoCache: true}, opts)
+
+	prompt, opts = ParseMemeArgs("--no-overlay кот")
+	assert.Equal(t, "кот", prompt)
+	assert.Equal(t, CaptionModeTelegram, opts.CaptionMode)
+
+	prompt, opts = ParseMemeArgs("--caption сбоку кот")
+	assert.Equal(t, "--caption сбоку кот", prompt)
+	assert.Empty(t, opts.CaptionMode)
+
+	prompt, opts = ParseMemeArgs("--frames 3 кот")
+	assert.Equal(t, "кот", prompt)
+	assert.Equal(t, 3, opts.Frames)
+
+	prompt, opts = ParseMemeArgs("--frames 10 кот")
+	assert.Equal(t, "--frames 10 кот", prompt)
+	assert.Zero(t, opts.Frames)
+}
+
+func TestParseGenerationStrategy(t *testing.T) {
+	strategy, err := ParseGenerationStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyRace, strategy)
+
+	strategy, err = ParseGenerationStrategy(" Hedged ")
+	assert.NoError(t, err)
+	assert.Equal(t, StrategyHedged, strategy)
+
+	_, err = ParseGenerationStrategy("random")
+	assert.Error(t, err)
+}
+
+func TestImageGenerationService_NoProviders(t *testing.T) {
+	svc := NewImageGenerationServiceWithRegistry(newQuietLogger(), NewProviderRegistry())
+
+	_, err := svc.GenerateImage(context.Background(), "prompt")
+	assert.Error(t, err)
+}
+
+func TestImageGenerationService_AdaptiveSelectionAvoidsLowScoringProvider(t *testing.T) {
+	generators := map[string]*fakeGenerator{
+		"flaky": {delay: time.Millisecond, err: errors.New("unavailable")},
+		"good":  {delay: 10 * time.Millisecond, image: []byte("good")},
+	}
+	// Стратегия по умолчанию (race) с адаптивным выбором заменяется на hedged
+	svc := newTestService(t, generators, []string{"flaky", "good"}, WithAdaptiveSelection(0))
+	assert.Equal(t, StrategyHedged, svc.strategy)
+
+	for i := 0; i < 10; i++ {
+		svc.stats.observe("flaky", time.Second, false)
+		svc.stats.observe("good", time.Second, true)
+	}
+
+	for i := 0; i < 5; i++ {
+		result, err := svc.GenerateImage(context.Background(), "prompt")
+		assert.NoError(t, err)
+		assert.Equal(t, "good", result.Provider)
+	}
+	assert.Equal(t, int32(0), generators["flaky"].calls.Load())
+	assert.Equal(t, int32(5), generators["good"].calls.Load())
+}
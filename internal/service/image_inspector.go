@@ -0,0 +1,182 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultBlankStdDev - стандартное отклонение каналов (0..255), ниже которого
+	// изображение считается однотонным
+	defaultBlankStdDev = 4.0
+	// defaultMaxHashDistance - максимальное расстояние Хэмминга до хэша заглушки
+	defaultMaxHashDistance = 5
+	// inspectionGrid - размер сетки точек, по которым считается однотонность
+	inspectionGrid = 64
+)
+
+var (
+	// ErrCensoredImage is returned when a provider reports that the image was censored
+	ErrCensoredImage = errors.New("censored image")
+	// ErrBlankImage is returned for solid colour and near-uniform images
+	ErrBlankImage = errors.New("blank image")
+	// ErrPlaceholderImage is returned when an image matches a known placeholder
+	ErrPlaceholderImage = errors.New("placeholder image")
+)
+
+// ImageInspectorConfig holds thresholds for degenerate image detection
+type ImageInspectorConfig struct {
+	// BlankStdDev - минимальное стандартное отклонение цветовых каналов
+	BlankStdDev float64
+	// PlaceholderHashes - перцептивные хэши известных заглушек (цензура, "нет изображения")
+	PlaceholderHashes []uint64
+	// MaxHashDistance - максимальное число отличающихся бит, при котором хэши совпадают
+	MaxHashDistance int
+}
+
+// ImageInspector detects images that are technically valid but useless as a meme:
+// solid colour fills and known placeholder pictures
+type ImageInspector struct {
+	cfg ImageInspectorConfig
+}
+
+// NewImageInspector creates an inspector; zero thresholds are replaced with defaults
+func NewImageInspector(cfg ImageInspectorConfig) *ImageInspector {
+	if cfg.BlankStdDev <= 0 {
+		cfg.BlankStdDev = defaultBlankStdDev
+	}
+	if cfg.MaxHashDistance <= 0 {
+		cfg.MaxHashDistance = defaultMaxHashDistance
+	}
+	return &ImageInspector{cfg: cfg}
+}
+
+// Inspect decodes data and checks it with InspectImage
+func (i *ImageInspector) Inspect(data []byte) error {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return i.InspectImage(img)
+}
+
+// InspectImage returns ErrBlankImage or ErrPlaceholderImage for degenerate images
+func (i *ImageInspector) InspectImage(img image.Image) error {
+	if deviation := colorStdDev(img); deviation < i.cfg.BlankStdDev {
+		return fmt.Errorf("%w: colour deviation %.2f is below %.2f", ErrBlankImage, deviation, i.cfg.BlankStdDev)
+	}
+
+	hash := PerceptualHash(img)
+	for _, placeholder := range i.cfg.PlaceholderHashes {
+		if distance := bits.OnesCount64(hash ^ placeholder); distance <= i.cfg.MaxHashDistance {
+			return fmt.Errorf("%w: hash %016x is %d bits away from %016x",
+				ErrPlaceholderImage, hash, distance, placeholder)
+		}
+	}
+	return nil
+}
+
+// colorStdDev returns the largest standard deviation of the R, G and B channels
+// over a sparse grid of sample points
+func colorStdDev(img image.Image) float64 {
+	bounds := img.Bounds()
+	var sum, sumSquares [3]float64
+	var count float64
+	for gy := 0; gy < inspectionGrid; gy++ {
+		y := bounds.Min.Y + gy*bounds.Dy()/inspectionGrid
+		for gx := 0; gx < inspectionGrid; gx++ {
+			x := bounds.Min.X + gx*bounds.Dx()/inspectionGrid
+			r, g, b, _ := img.At(x, y).RGBA()
+			for c, value := range [3]uint32{r, g, b} {
+				v := float64(value >> 8)
+				sum[c] += v
+				sumSquares[c] += v * v
+			}
+			count++
+		}
+	}
+
+	var deviation float64
+	for c := range sum {
+		mean := sum[c] / count
+		deviation = math.Max(deviation, math.Sqrt(math.Max(0, sumSquares[c]/count-mean*mean)))
+	}
+	return deviation
+}
+
+// PerceptualHash computes a 64-bit difference hash (dHash) of img.
+// Similar looking images have hashes that differ in only a few bits,
+// which survives re-encoding and rescaling.
+func PerceptualHash(img image.Image) uint64 {
+	// Уменьшаем изображение до 9x8 в оттенках серого и сравниваем соседние точки
+	const width, height = 9, 8
+	bounds := img.Bounds()
+	var gray [height][width]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gray[y][x] = averageLuma(img, image.Rect(
+				bounds.Min.X+x*bounds.Dx()/width,
+				bounds.Min.Y+y*bounds.Dy()/height,
+				bounds.Min.X+(x+1)*bounds.Dx()/width,
+				bounds.Min.Y+(y+1)*bounds.Dy()/height,
+			))
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// averageLuma returns the mean brightness of the rectangle, sampling at most 8x8 points
+func averageLuma(img image.Image, rect image.Rectangle) float64 {
+	stepX := max(1, rect.Dx()/8)
+	stepY := max(1, rect.Dy()/8)
+	var sum, count float64
+	for y := rect.Min.Y; y < max(rect.Max.Y, rect.Min.Y+1); y += stepY {
+		for x := rect.Min.X; x < max(rect.Max.X, rect.Min.X+1); x += stepX {
+			sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+			count++
+		}
+	}
+	return sum / count
+}
+
+// ParsePerceptualHash parses a hash in the hexadecimal form used in logs
+func ParsePerceptualHash(value string) (uint64, error) {
+	hash, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(value), "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %w", value, err)
+	}
+	return hash, nil
+}
+
+// failureReason classifies a provider error for metrics
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrCensoredImage):
+		return "censored"
+	case errors.Is(err, ErrBlankImage):
+		return "blank"
+	case errors.Is(err, ErrPlaceholderImage):
+		return "placeholder"
+	case errors.Is(err, ErrInvalidImage):
+		return "invalid_image"
+	default:
+		return "failure"
+	}
+}
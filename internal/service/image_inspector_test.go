@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPictureImage создает изображение из случайных цветных блоков, похожее на настоящую картинку
+func newPictureImage(width, height int, seed uint64) *image.RGBA {
+	const block = 16
+	random := rand.New(rand.NewPCG(seed, seed))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for by := 0; by < height; by += block {
+		for bx := 0; bx < width; bx += block {
+			fill := color.RGBA{R: uint8(random.IntN(256)), G: uint8(random.IntN(256)), B: uint8(random.IntN(256)), A: 255}
+			for y := by; y < min(by+block, height); y++ {
+				for x := bx; x < min(bx+block, width); x++ {
+					img.Set(x, y, fill)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// encodePNG кодирует изображение в PNG
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newNearUniformImage создает однотонное изображение с едва заметным шумом
+func newNearUniformImage(width, height int) *image.RGBA {
+	random := rand.New(rand.NewPCG(1, 1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			noise := uint8(random.IntN(3))
+			img.Set(x, y, color.RGBA{R: 200 + noise, G: 30 + noise, B: 30, A: 255})
+		}
+	}
+	return img
+}
+
+func TestImageInspector_AcceptsRegularImage(t *testing.T) {
+	inspector := NewImageInspector(ImageInspectorConfig{})
+
+	assert.NoError(t, inspector.InspectImage(newPictureImage(128, 128, 1)))
+}
+
+func TestImageInspector_RejectsBlankImages(t *testing.T) {
+	inspector := NewImageInspector(ImageInspectorConfig{})
+
+	solid := image.NewUniform(color.RGBA{R: 10, G: 200, B: 10, A: 255})
+	assert.ErrorIs(t, inspector.InspectImage(&boundedImage{solid, image.Rect(0, 0, 64, 64)}), ErrBlankImage)
+	assert.ErrorIs(t, inspector.InspectImage(newNearUniformImage(128, 128)), ErrBlankImage)
+}
+
+func TestImageInspector_RejectsKnownPlaceholder(t *testing.T) {
+	placeholder := newPictureImage(256, 256, 7)
+	inspector := NewImageInspector(ImageInspectorConfig{
+		PlaceholderHashes: []uint64{PerceptualHash(placeholder)},
+	})
+
+	// Заглушка остается заглушкой после перекодирования и масштабирования
+	normalized, err := NewImageNormalizer(ImageNormalizerConfig{MaxSide: 100}).
+		Normalize(encodePNG(t, placeholder))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, inspector.Inspect(normalized.Data), ErrPlaceholderImage)
+
+	assert.NoError(t, inspector.InspectImage(newPictureImage(256, 256, 8)))
+}
+
+func TestParsePerceptualHash(t *testing.T) {
+	hash, err := ParsePerceptualHash(" 0x00ff00ff00ff00ff ")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x00ff00ff00ff00ff), hash)
+
+	_, err = ParsePerceptualHash("not-a-hash")
+	assert.Error(t, err)
+}
+
+// boundedImage ограничивает бесконечное изображение заданными размерами
+type boundedImage struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+func (b *boundedImage) Bounds() image.Rectangle {
+	return b.bounds
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	// Декодеры форматов, которые возвращают провайдеры
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Ограничения Telegram для фотографий (sendPhoto)
+const (
+	// telegramMaxPhotoBytes - максимальный размер фото
+	telegramMaxPhotoBytes = 10 << 20
+	// telegramMaxPhotoDimensionSum - максимальная сумма ширины и высоты
+	telegramMaxPhotoDimensionSum = 10000
+	// telegramMaxPhotoAspectRatio - максимальное соотношение сторон
+	telegramMaxPhotoAspectRatio = 20
+)
+
+const (
+	// defaultMaxImageSide - максимальная сторона изображения; больше Telegram все равно не показывает
+	defaultMaxImageSide = 2560
+	// defaultJPEGQuality - качество JPEG при перекодировании
+	defaultJPEGQuality = 90
+	// minJPEGQuality - качество, ниже которого не опускаемся при подгонке размера файла
+	minJPEGQuality = 60
+	// maxDecodedPixels - защита от "бомб" с огромным заявленным разрешением
+	maxDecodedPixels = 50_000_000
+)
+
+// ErrInvalidImage is returned when provider output cannot be decoded as an image
+var ErrInvalidImage = errors.New("invalid image")
+
+// ImageNormalizerConfig holds limits for normalized images
+type ImageNormalizerConfig struct {
+	// MaxBytes - максимальный размер результата в байтах
+	MaxBytes int
+	// MaxSide - максимальная длина большей стороны в пикселях
+	MaxSide int
+	// JPEGQuality - начальное качество JPEG (1..100)
+	JPEGQuality int
+}
+
+// DefaultImageNormalizerConfig returns limits matching Telegram photo restrictions
+func DefaultImageNormalizerConfig() ImageNormalizerConfig {
+	return ImageNormalizerConfig{
+		MaxBytes:    telegramMaxPhotoBytes,
+		MaxSide:     defaultMaxImageSide,
+		JPEGQuality: defaultJPEGQuality,
+	}
+}
+
+// NormalizedImage is an image prepared for sending to Telegram
+type NormalizedImage struct {
+	Data     []byte
+	MIMEType string
+	// SourceFormat - формат, который вернул провайдер (jpeg, png, gif, webp)
+	SourceFormat string
+	Width        int
+	Height       int
+	// Image - декодированное изображение после масштабирования, для дальнейших проверок
+	Image image.Image
+}
+
+// ImageNormalizer validates provider output and converts it into a JPEG that
+// fits Telegram photo limits. Re-encoding drops any metadata (EXIF, XMP, text chunks).
+type ImageNormalizer struct {
+	cfg ImageNormalizerConfig
+}
+
+// NewImageNormalizer creates a normalizer; zero or invalid limits are replaced with defaults
+func NewImageNormalizer(cfg ImageNormalizerConfig) *ImageNormalizer {
+	defaults := DefaultImageNormalizerConfig()
+	if cfg.MaxBytes <= 0 || cfg.MaxBytes > telegramMaxPhotoBytes {
+		cfg.MaxBytes = defaults.MaxBytes
+	}
+	if cfg.MaxSide <= 0 {
+		cfg.MaxSide = defaults.MaxSide
+	}
+	if cfg.JPEGQuality <= 0 || cfg.JPEGQuality > 100 {
+		cfg.JPEGQuality = defaults.JPEGQuality
+	}
+	return &ImageNormalizer{cfg: cfg}
+}
+
+// Normalize sniffs the real format of data, decodes and validates it, downscales
+// it to the configured limits and re-encodes it as JPEG.
+// Errors wrap ErrInvalidImage when the data is not a usable image.
+func (n *ImageNormalizer) Normalize(data []byte) (*NormalizedImage, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty data", ErrInvalidImage)
+	}
+
+	// Сначала читаем только заголовок, чтобы не декодировать заведомо негодные данные
+	header, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: unsupported or corrupted data (%s): %v",
+			ErrInvalidImage, http.DetectContentType(data), err)
+	}
+	if header.Width <= 0 || header.Height <= 0 {
+		return nil, fmt.Errorf("%w: %s has empty dimensions %dx%d", ErrInvalidImage, format, header.Width, header.Height)
+	}
+	if header.Width*header.Height > maxDecodedPixels {
+		return nil, fmt.Errorf("%w: %s is too large: %dx%d", ErrInvalidImage, format, header.Width, header.Height)
+	}
+	if aspectRatio(header.Width, header.Height) > telegramMaxPhotoAspectRatio {
+		return nil, fmt.Errorf("%w: aspect ratio of %dx%d exceeds Telegram limit", ErrInvalidImage, header.Width, header.Height)
+	}
+
+	// Полное декодирование находит обрезанные и поврежденные файлы
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode %s: %v", ErrInvalidImage, format, err)
+	}
+
+	width, height := fitDimensions(img.Bounds().Dx(), img.Bounds().Dy(), n.cfg.MaxSide)
+	for {
+		canvas := flatten(img, width, height)
+		encoded, err := n.encode(canvas)
+		if err != nil {
+			return nil, err
+		}
+		if encoded != nil {
+			return &NormalizedImage{
+				Data:         encoded,
+				MIMEType:     "image/jpeg",
+				SourceFormat: format,
+				Width:        width,
+				Height:       height,
+				Image:        canvas,
+			}, nil
+		}
+
+		// Даже при минимальном качестве файл не влезает в лимит - уменьшаем изображение
+		width, height = width*3/4, height*3/4
+		if width < 1 || height < 1 {
+			return nil, fmt.Errorf("%w: cannot fit %s into %d bytes", ErrInvalidImage, format, n.cfg.MaxBytes)
+		}
+	}
+}
+
+// flatten scales img to width x height and draws it over a white background,
+// because JPEG does not support transparency
+func flatten(img image.Image, width, height int) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	if width == img.Bounds().Dx() && height == img.Bounds().Dy() {
+		draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Over)
+	} else {
+		draw.CatmullRom.Scale(canvas, canvas.Bounds(), img, img.Bounds(), draw.Over, nil)
+	}
+	return canvas
+}
+
+// encode encodes img as JPEG, lowering the quality until the result fits MaxBytes.
+// It returns nil data when no quality is small enough.
+func (n *ImageNormalizer) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	for quality := n.cfg.JPEGQuality; ; quality -= 10 {
+		if quality < minJPEGQuality {
+			quality = minJPEGQuality
+		}
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode jpeg: %w", err)
+		}
+		if buf.Len() <= n.cfg.MaxBytes {
+			return buf.Bytes(), nil
+		}
+		if quality == minJPEGQuality {
+			return nil, nil
+		}
+	}
+}
+
+// fitDimensions scales width and height down, preserving the aspect ratio, so that
+// the larger side does not exceed maxSide and the sum fits Telegram limits
+func fitDimensions(width, height, maxSide int) (int, int) {
+	scale := 1.0
+	if side := max(width, height); side > maxSide {
+		scale = float64(maxSide) / float64(side)
+	}
+	if sum := float64(width+height) * scale; sum > telegramMaxPhotoDimensionSum {
+		scale *= telegramMaxPhotoDimensionSum / sum
+	}
+	if scale >= 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+// aspectRatio returns the ratio of the larger side to the smaller one
+func aspectRatio(width, height int) float64 {
+	return float64(max(width, height)) / float64(min(width, height))
+}
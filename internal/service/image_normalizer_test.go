@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeTestImage создает изображение заданного размера в формате PNG или JPEG
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: uint8(255 - x%128)})
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageNormalizer_ConvertsToJPEG(t *testing.T) {
+	normalizer := NewImageNormalizer(DefaultImageNormalizerConfig())
+
+	result, err := normalizer.Normalize(encodeTestImage(t, "png", 64, 32))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", result.MIMEType)
+	assert.Equal(t, "png", result.SourceFormat)
+
+	decoded, format, err := image.Decode(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, image.Rect(0, 0, 64, 32), decoded.Bounds())
+}
+
+func TestImageNormalizer_Downscales(t *testing.T) {
+	normalizer := NewImageNormalizer(ImageNormalizerConfig{MaxSide: 100})
+
+	result, err := normalizer.Normalize(encodeTestImage(t, "jpeg", 400, 200))
+
+	assert.NoError(t, err)
+	assert.Equal(t, 100, result.Width)
+	assert.Equal(t, 50, result.Height)
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, 100, config.Width)
+	assert.Equal(t, 50, config.Height)
+}
+
+func TestImageNormalizer_FitsByteLimit(t *testing.T) {
+	original := encodeTestImage(t, "png", 256, 256)
+	normalizer := NewImageNormalizer(ImageNormalizerConfig{MaxBytes: 4096})
+
+	result, err := normalizer.Normalize(original)
+
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, len(result.Data), 4096)
+}
+
+func TestImageNormalizer_RejectsInvalidImages(t *testing.T) {
+	valid := encodeTestImage(t, "jpeg", 64, 64)
+
+	tests := map[string][]byte{
+		"empty":        nil,
+		"garbage":      []byte("definitely not an image"),
+		"truncated":    valid[:len(valid)/2],
+		"jpeg prefix":  {0xFF, 0xD8, 0xFF, 0xE0},
+		"aspect ratio": encodeTestImage(t, "png", 420, 20),
+	}
+
+	normalizer := NewImageNormalizer(DefaultImageNormalizerConfig())
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := normalizer.Normalize(data)
+			assert.ErrorIs(t, err, ErrInvalidImage)
+			assert.Nil(t, result)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SupportedAspectRatios are the aspect ratios accepted by --ar
+var SupportedAspectRatios = []string{"1:1", "16:9", "9:16", "4:3"}
+
+// ImageOptions are per-request image generation settings.
+// Empty fields mean provider defaults.
+type ImageOptions struct {
+	// Provider - провайдер, которым нужно сгенерировать изображение (пусто - любой)
+	Provider string
+	// Model - модель провайдера
+	Model string
+	// Seed - сид генерации
+	Seed string
+	// AspectRatio - соотношение сторон, например "16:9"
+	AspectRatio string
+	// NoCache - не брать готовый результат из кэша (новый результат все равно кэшируется)
+	NoCache bool
+	// CaptionMode - куда поместить подпись (пусто - настройка чата)
+	CaptionMode CaptionMode
+	// Frames - сколько изображений сгенерировать для анимации /gif (0 - одно)
+	Frames int
+}
+
+// imageOptionsKey is the context key of the request generation options
+type imageOptionsKey struct{}
+
+// WithImageOptions returns a context carrying options for image generation
+func WithImageOptions(ctx context.Context, opts ImageOptions) context.Context {
+	return context.WithValue(ctx, imageOptionsKey{}, opts)
+}
+
+// imageOptions returns the options stored in ctx, or zero options
+func imageOptions(ctx context.Context) ImageOptions {
+	opts, _ := ctx.Value(imageOptionsKey{}).(ImageOptions)
+	return opts
+}
+
+// requestSeed returns the seed requested in ctx or a random one
+func requestSeed(ctx context.Context) int64 {
+	if seed, err := strconv.ParseInt(imageOptions(ctx).Seed, 10, 64); err == nil && seed >= 0 {
+		return seed
+	}
+	// Все провайдеры принимают 48-битный сид без потери точности
+	return rand.Int64N(1 << 48)
+}
+
+// aspectRatioParts splits a supported aspect ratio like "16:9" into its sides.
+// Empty and unsupported values yield 1:1.
+func aspectRatioParts(ratio string) (width, height string) {
+	width, height, ok := strings.Cut(ratio, ":")
+	if !ok || !slices.Contains(SupportedAspectRatios, ratio) {
+		return "1", "1"
+	}
+	return width, height
+}
+
+// ParseMemeArgs splits /meme arguments into the prompt and generation options.
+// Options are flags at the beginning of the arguments:
+//
+//	--no-cache     сгенерировать новое изображение, даже если такое уже есть в кэше
+//	--seed N       сгенерировать с заданным сидом, чтобы повторить понравившийся мем
+//	--ar W:H       соотношение сторон, одно из SupportedAspectRatios
+//	--caption M    куда поместить подпись, один из CaptionModes
+//	--overlay      нарисовать подпись на изображении (--caption overlay)
+//	--no-overlay   отправить подпись только текстом (--caption telegram)
+//	--frames N     сколько изображений сгенерировать для /gif, до maxAnimationKeyframes
+func ParseMemeArgs(args string) (string, ImageOptions) {
+	var opts ImageOptions
+	rest := strings.TrimSpace(args)
+	for strings.HasPrefix(rest, "--") {
+		flag, tail := nextArg(rest)
+		switch strings.ToLower(flag) {
+		case "--no-cache", "--nocache":
+			opts.NoCache = true
+		case "--seed":
+			value, valueTail := nextArg(tail)
+			if seed, err := strconv.ParseInt(value, 10, 64); err != nil || seed < 0 {
+				// Некорректное значение - это часть промпта
+				return rest, opts
+			}
+			opts.Seed, tail = value, valueTail
+		case "--ar", "--aspect":
+			value, valueTail := nextArg(tail)
+			if !slices.Contains(SupportedAspectRatios, value) {
+				return rest, opts
+			}
+			opts.AspectRatio, tail = value, valueTail
+		case "--caption":
+			value, valueTail := nextArg(tail)
+			mode, err := ParseCaptionMode(value)
+			if err != nil || value == "" {
+				return rest, opts
+			}
+			opts.CaptionMode, tail = mode, valueTail
+		case "--frames":
+			value, valueTail := nextArg(tail)
+			frames, err := strconv.Atoi(value)
+			if err != nil || frames < 1 || frames > maxAnimationKeyframes {
+				return rest, opts
+			}
+			opts.Frames, tail = frames, valueTail
+		case "--overlay":
+			opts.CaptionMode = CaptionModeOverlay
+		case "--no-overlay":
+			opts.CaptionMode = CaptionModeTelegram
+		default:
+			// Неизвестный флаг - это часть промпта
+			return rest, opts
+		}
+		rest = tail
+	}
+	return rest, opts
+}
+
+// nextArg splits s into the first whitespace-separated word and the trimmed rest
+func nextArg(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], strings.TrimSpace(s[i:])
+	}
+	return s, ""
+}
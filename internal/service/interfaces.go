@@ -15,10 +15,22 @@ type YandexAuthService interface {
 	RefreshIAMToken(ctx context.Context, oauthToken string) (string, error)
 }
 
-// YandexGPTService определяет интерфейс для работы с Yandex GPT
-type YandexGPTService interface {
+// GPTService определяет интерфейс для работы с языковой моделью: промпты,
+// подписи и тексты шаблонных мемов. Сама модель скрыта за LLMClient
+type GPTService interface {
 	// GenerateImagePrompt генерирует промпт и подпись для создания изображения
 	GenerateImagePrompt(ctx context.Context, userPrompt string) (string, string, error)
+	// ChooseMemeTemplate выбирает подходящий шаблон мема и пишет тексты для его слотов
+	ChooseMemeTemplate(ctx context.Context, userPrompt string, templates []MemeTemplate) (*MemeTemplateChoice, error)
+}
+
+// LLMClient определяет интерфейс языковой модели.
+// Реализации: Yandex GPT, OpenAI-совместимые chat completions и локальный Ollama
+type LLMClient interface {
+	// Name возвращает имя бэкенда для логов и метрик
+	Name() string
+	// Complete отправляет диалог модели и возвращает текст ответа
+	Complete(ctx context.Context, request LLMRequest) (string, error)
 }
 
 // ImageGenerator определяет интерфейс для сервисов генерации изображений.
@@ -27,8 +39,26 @@ type ImageGenerator interface {
 	// GenerateImage генерирует изображение на основе текстового промпта
 	// ctx - контекст выполнения
 	// promptText - текстовое описание желаемого изображения
-	// Возвращает сгенерированное изображение в виде []byte и ошибку, если она возникла
-	GenerateImage(ctx context.Context, promptText string) ([]byte, error)
+	// Возвращает сгенерированное изображение вместе с деталями генерации
+	// (модель, сид, количество запросов) и ошибку, если она возникла
+	GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error)
+}
+
+// ResumableGenerator определяет провайдеров с асинхронным API, которые умеют
+// дождаться результата ранее запущенной операции (например, после перезапуска бота)
+type ResumableGenerator interface {
+	ImageGenerator
+	// ResumeImage дожидается завершения операции operationID и возвращает изображение
+	ResumeImage(ctx context.Context, operationID string) (*GenerationResult, error)
+}
+
+// WeightedPromptGenerator определяет провайдеров, которые принимают промпт
+// из нескольких частей с весами (см. ParseWeightedPrompt). Остальным провайдерам
+// достается объединенный промпт без весов.
+type WeightedPromptGenerator interface {
+	ImageGenerator
+	// GenerateWeightedImage генерирует изображение по частям промпта с весами
+	GenerateWeightedImage(ctx context.Context, parts []PromptPart) (*GenerationResult, error)
 }
 
 // BotService определяет интерфейс для работы с телеграм ботом
@@ -36,11 +66,11 @@ type BotService interface {
 	// GetUpdatesChan возвращает канал для получения обновлений от Telegram
 	GetUpdatesChan(config tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel
 	// HandleCommand обрабатывает команды бота
-	HandleCommand(ctx context.Context, command string, args string) ([]byte, error)
+	HandleCommand(ctx context.Context, command string, args string) (*MemeResult, error)
 	// SendMessage отправляет текстовое сообщение
-	SendMessage(ctx context.Context, chatID int64, message string) error
+	SendMessage(ctx context.Context, chatID int64, message string) (tgbotapi.Message, error)
 	// SendPhoto отправляет фото
-	SendPhoto(ctx context.Context, chatID int64, photo []byte) error
+	SendPhoto(ctx context.Context, chatID int64, photo []byte, caption string) error
 	// DeleteMessage удаляет сообщение
 	DeleteMessage(ctx context.Context, chatID int64, messageID int) error
 	// Stop останавливает работу бота
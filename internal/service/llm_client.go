@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/config"
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+)
+
+const (
+	// LLMProviderYandexGPT - Yandex GPT (нужны учетные данные Yandex Cloud)
+	LLMProviderYandexGPT = "yandex_gpt"
+	// LLMProviderOpenAI - OpenAI-совместимый API /v1/chat/completions
+	LLMProviderOpenAI = "openai"
+	// LLMProviderOllama - локальный сервер Ollama
+	LLMProviderOllama = "ollama"
+
+	// LLMRoleSystem, LLMRoleUser и LLMRoleAssistant - роли сообщений диалога
+	LLMRoleSystem    = "system"
+	LLMRoleUser      = "user"
+	LLMRoleAssistant = "assistant"
+
+	// llmDefaultTimeout - таймаут запроса к языковой модели
+	llmDefaultTimeout = 30 * time.Second
+)
+
+// LLMRequest is a single completion request to a language model
+type LLMRequest struct {
+	// Messages - диалог: системная инструкция и сообщения пользователя
+	Messages []LLMMessage
+	// Temperature - степень случайности ответа
+	Temperature float64
+	// MaxTokens - максимальная длина ответа в токенах
+	MaxTokens int
+	// JSONSchema - JSON Schema ответа. Бэкенды со структурированным выводом
+	// (Yandex GPT, Ollama) отвечают строго по схеме, остальные ее игнорируют
+	JSONSchema map[string]interface{}
+}
+
+// LLMMessage is one message of the dialog
+type LLMMessage struct {
+	Role string
+	Text string
+}
+
+// chatMessage is a message in the format of OpenAI and Ollama chat APIs
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatMessages converts the dialog into the chat API format
+func chatMessages(messages []LLMMessage) []chatMessage {
+	result := make([]chatMessage, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, chatMessage{Role: message.Role, Content: message.Text})
+	}
+	return result
+}
+
+// NewLLMClient creates the language model client from LLM_PROVIDERS. The first
+// provider is the primary one; the rest are tried in order when it fails.
+func NewLLMClient(cfg *config.Config, log *logger.Logger, auth YandexAuthService) (LLMClient, error) {
+	names := cfg.LLMProviders
+	if len(names) == 0 {
+		names = []string{LLMProviderYandexGPT}
+	}
+
+	clients := make([]LLMClient, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case LLMProviderYandexGPT:
+			clients = append(clients, NewYandexGPTClient(cfg, log, auth))
+		case LLMProviderOpenAI:
+			clients = append(clients, NewOpenAIChatClient(OpenAIChatConfig{
+				BaseURL: cfg.OpenAIChatBaseURL,
+				APIKey:  cfg.OpenAIChatAPIKey,
+				Model:   cfg.OpenAIChatModel,
+				Timeout: cfg.LLMTimeout,
+			}, log))
+		case LLMProviderOllama:
+			clients = append(clients, NewOllamaClient(OllamaConfig{
+				BaseURL: cfg.OllamaURL,
+				Model:   cfg.OllamaModel,
+				Timeout: cfg.LLMTimeout,
+			}, log))
+		default:
+			return nil, fmt.Errorf("unknown LLM provider: %q", name)
+		}
+	}
+
+	if len(clients) == 1 {
+		return clients[0], nil
+	}
+	return NewFallbackLLMClient(log, clients...), nil
+}
+
+// FallbackLLMClient tries language models in order until one of them answers
+type FallbackLLMClient struct {
+	logger  *logger.Logger
+	clients []LLMClient
+}
+
+// NewFallbackLLMClient creates a fallback chain; clients[0] is the primary model
+func NewFallbackLLMClient(log *logger.Logger, clients ...LLMClient) *FallbackLLMClient {
+	return &FallbackLLMClient{
+		logger:  log,
+		clients: clients,
+	}
+}
+
+// Name returns the name of the primary model
+func (c *FallbackLLMClient) Name() string {
+	if len(c.clients) == 0 {
+		return ""
+	}
+	return c.clients[0].Name()
+}
+
+// Complete returns the answer of the first model that succeeds
+func (c *FallbackLLMClient) Complete(ctx context.Context, request LLMRequest) (string, error) {
+	if len(c.clients) == 0 {
+		return "", fmt.Errorf("no LLM providers configured")
+	}
+
+	var errs []error
+	for i, client := range c.clients {
+		text, err := client.Complete(ctx, request)
+		if err == nil {
+			if i > 0 {
+				metrics.LLMFallbacks.Inc(client.Name())
+				c.logger.Info(ctx, "LLM request served by fallback provider", map[string]interface{}{
+					"llm":     client.Name(),
+					"primary": c.Name(),
+				})
+			}
+			return text, nil
+		}
+
+		metrics.LLMFailures.Inc(client.Name())
+		c.logger.Warn(ctx, "LLM provider failed", map[string]interface{}{
+			"llm":   client.Name(),
+			"error": err.Error(),
+		})
+		errs = append(errs, fmt.Errorf("%s: %w", client.Name(), err))
+		// Отмененный запрос нет смысла отправлять следующей модели
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", fmt.Errorf("all LLM providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedLLM отвечает заранее заданными ответами по очереди
+type scriptedLLM struct {
+	name    string
+	answers []string
+	err     error
+	// requests - запросы, которые получила модель
+	requests []LLMRequest
+}
+
+func (l *scriptedLLM) Name() string { return l.name }
+
+func (l *scriptedLLM) Complete(_ context.Context, request LLMRequest) (string, error) {
+	l.requests = append(l.requests, request)
+	if l.err != nil {
+		return "", l.err
+	}
+	if len(l.answers) == 0 {
+		return "", errors.New("no more answers")
+	}
+	answer := l.answers[0]
+	l.answers = l.answers[1:]
+	return answer, nil
+}
+
+// testLLMRequest - короткий диалог для проверки клиентов
+var testLLMRequest = LLMRequest{
+	Messages: []LLMMessage{
+		{Role: LLMRoleSystem, Text: "Ты автор мемов"},
+		{Role: LLMRoleUser, Text: "кот"},
+	},
+	Temperature: 0.6,
+	MaxTokens:   200,
+}
+
+func TestYandexGPTClient_Complete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer iam-token", r.Header.Get("Authorization"))
+		assert.Equal(t, "folder", r.Header.Get("x-folder-id"))
+
+		var request GPTRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "gpt://folder/yandexgpt", request.ModelUri)
+		assert.Equal(t, "200", request.CompletionOptions.MaxTokens)
+		assert.Equal(t, []GPTMessage{{Role: "system", Text: "Ты автор мемов"}, {Role: "user", Text: "кот"}}, request.Messages)
+		if assert.NotNil(t, request.JSONSchema) {
+			assert.Equal(t, []interface{}{"context", "detail", "caption"}, request.JSONSchema.Schema["required"])
+		}
+
+		w.Write([]byte(`{"result": {"alternatives": [{"message": {"role": "assistant", "text": "ответ"}, "status": "ALTERNATIVE_STATUS_FINAL"}]}}`))
+	}))
+	defer server.Close()
+
+	client := NewYandexGPTClient(&config.Config{YandexArtFolderID: "folder", YandexGPTModel: "yandexgpt"}, newQuietLogger(), staticAuth{})
+	client.url = server.URL
+	request := testLLMRequest
+	request.JSONSchema = gptPromptSchema
+
+	text, err := client.Complete(context.Background(), request)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ответ", text)
+	assert.Equal(t, LLMProviderYandexGPT, client.Name())
+}
+
+func TestOpenAIChatClient_Complete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var request OpenAIChatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "gpt-4o-mini", request.Model)
+		assert.Equal(t, 200, request.MaxTokens)
+		assert.Equal(t, []chatMessage{{Role: "system", Content: "Ты автор мемов"}, {Role: "user", Content: "кот"}}, request.Messages)
+
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "ответ"}, "finish_reason": "stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := NewOpenAIChatClient(OpenAIChatConfig{BaseURL: server.URL + "/v1/", APIKey: "test-key"}, newQuietLogger())
+
+	text, err := client.Complete(context.Background(), testLLMRequest)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ответ", text)
+}
+
+func TestOpenAIChatClient_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "api error", status: http.StatusUnauthorized, body: `{"error": {"message": "Incorrect API key", "code": "invalid_api_key"}}`, wantErr: "Incorrect API key"},
+		{name: "bad gateway", status: http.StatusBadGateway, body: "upstream is down", wantErr: "unexpected status code 502"},
+		{name: "no choices", status: http.StatusOK, body: `{"choices": []}`, wantErr: "empty chat completion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewOpenAIChatClient(OpenAIChatConfig{BaseURL: server.URL}, newQuietLogger())
+			_, err := client.Complete(context.Background(), testLLMRequest)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestOllamaClient_Complete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+
+		var request OllamaChatRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "qwen2.5", request.Model)
+		assert.False(t, request.Stream)
+		assert.Equal(t, OllamaOptions{Temperature: 0.6, NumPredict: 200}, request.Options)
+
+		w.Write([]byte(`{"model": "qwen2.5", "message": {"role": "assistant", "content": "ответ"}, "done": true}`))
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(OllamaConfig{BaseURL: server.URL + "/", Model: "qwen2.5", Timeout: time.Second}, newQuietLogger())
+
+	text, err := client.Complete(context.Background(), testLLMRequest)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ответ", text)
+
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "model \"qwen2.5\" not found, try pulling it first"}`))
+	}))
+	defer missing.Close()
+
+	client = NewOllamaClient(OllamaConfig{BaseURL: missing.URL, Model: "qwen2.5"}, newQuietLogger())
+	_, err = client.Complete(context.Background(), testLLMRequest)
+	assert.ErrorContains(t, err, "try pulling it first")
+}
+
+func TestFallbackLLMClient(t *testing.T) {
+	primary := &scriptedLLM{name: "primary", err: errors.New("quota exceeded")}
+	secondary := &scriptedLLM{name: "secondary", answers: []string{"ответ"}}
+	client := NewFallbackLLMClient(newQuietLogger(), primary, secondary)
+
+	text, err := client.Complete(context.Background(), testLLMRequest)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ответ", text)
+	assert.Len(t, primary.requests, 1)
+	assert.Equal(t, "primary", client.Name())
+
+	_, err = client.Complete(context.Background(), testLLMRequest)
+	assert.ErrorContains(t, err, "primary: quota exceeded")
+	assert.ErrorContains(t, err, "secondary: no more answers")
+
+	// Отмененный запрос не уходит резервной модели
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	secondary.requests = nil
+	_, err = client.Complete(ctx, testLLMRequest)
+	assert.Error(t, err)
+	assert.Empty(t, secondary.requests)
+}
+
+func TestNewLLMClient(t *testing.T) {
+	client, err := NewLLMClient(&config.Config{}, newQuietLogger(), staticAuth{})
+	assert.NoError(t, err)
+	assert.IsType(t, &YandexGPTClient{}, client)
+
+	client, err = NewLLMClient(&config.Config{LLMProviders: []string{LLMProviderOllama, LLMProviderOpenAI}}, newQuietLogger(), staticAuth{})
+	assert.NoError(t, err)
+	fallback, ok := client.(*FallbackLLMClient)
+	assert.True(t, ok)
+	assert.Equal(t, LLMProviderOllama, fallback.Name())
+	assert.Len(t, fallback.clients, 2)
+
+	_, err = NewLLMClient(&config.Config{LLMProviders: []string{"gigachat"}}, newQuietLogger(), staticAuth{})
+	assert.ErrorContains(t, err, `unknown LLM provider: "gigachat"`)
+}
+
+func TestGPTService_GenerateImagePrompt(t *testing.T) {
+	llm := &scriptedLLM{name: "test", answers: []string{
+		"```{\"context\": \"A cat in space\", \"detail\": \"wearing a tiny helmet\", \"caption\": \"Хьюстон, у нас кот\"}```",
+	}}
+	svc := NewGPTService(newQuietLogger(), llm)
+
+	prompt, caption, err := svc.GenerateImagePrompt(context.Background(), "кот в космосе")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "A cat in space.wearing a tiny helmet", prompt)
+	assert.Equal(t, "Хьюстон, у нас кот", caption)
+	assert.Contains(t, llm.requests[0].Messages[1].Text, "кот в космосе")
+
+	// Ошибка модели не мешает генерации: используется исходный промпт
+	prompt, caption, err = svc.GenerateImagePrompt(context.Background(), "кот")
+	assert.NoError(t, err)
+	assert.Equal(t, "кот", prompt)
+	assert.Empty(t, caption)
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	// Декодеры форматов изображений шаблонов
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// memeTemplatesManifest - файл с описанием шаблонов в каталоге шаблонов
+const memeTemplatesManifest = "templates.json"
+
+// embeddedMemeTemplates holds the built-in templates: simple layouts drawn for
+// this project, not the art of well-known memes. MEME_TEMPLATES_DIR replaces
+// them with a directory of the same layout, e.g. with properly licensed classics.
+//
+//go:embed assets/templates
+var embeddedMemeTemplates embed.FS
+
+// MemeTemplate is a meme picture with places for text
+type MemeTemplate struct {
+	// ID - идентификатор шаблона, его выбирает GPT
+	ID string `json:"id"`
+	// Name - название шаблона
+	Name string `json:"name"`
+	// Description - смысл мема, подсказка для GPT
+	Description string `json:"description"`
+	// Image - файл изображения в каталоге шаблонов
+	Image string `json:"image"`
+	// Slots - места для текста
+	Slots []MemeTemplateSlot `json:"slots"`
+
+	// picture - декодированное изображение шаблона
+	picture image.Image
+}
+
+// MemeTemplateSlot is a place for text on a template
+type MemeTemplateSlot struct {
+	// Name - имя слота в ответе GPT
+	Name string `json:"name"`
+	// Description - что писать в слоте, подсказка для GPT
+	Description string `json:"description"`
+	// Box - рамка текста в пикселях: x0, y0, x1, y1
+	Box [4]int `json:"box"`
+	// Color и Outline - цвета текста и обводки в виде #rrggbb; пустая обводка - без обводки
+	Color   string `json:"color"`
+	Outline string `json:"outline,omitempty"`
+	// Align - вертикальное выравнивание: top, middle или bottom
+	Align TextAlign `json:"align,omitempty"`
+	// MaxFont - максимальный размер шрифта в пикселях
+	MaxFont float64 `json:"max_font,omitempty"`
+	// Uppercase - писать заглавными буквами
+	Uppercase bool `json:"uppercase,omitempty"`
+
+	style TextStyle
+}
+
+// rect returns the slot box as a rectangle
+func (s MemeTemplateSlot) rect() image.Rectangle {
+	return image.Rect(s.Box[0], s.Box[1], s.Box[2], s.Box[3])
+}
+
+// MemeTemplateChoice is a template picked for a prompt together with the slot texts
+type MemeTemplateChoice struct {
+	// Template - ID выбранного шаблона
+	Template string `json:"template"`
+	// Slots - тексты по именам слотов
+	Slots map[string]string `json:"slots"`
+}
+
+// LoadMemeTemplates loads templates from dir, or the built-in ones when dir is empty
+func LoadMemeTemplates(dir string) ([]MemeTemplate, error) {
+	var fsys fs.FS
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	} else {
+		sub, err := fs.Sub(embeddedMemeTemplates, "assets/templates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	manifest, err := fs.ReadFile(fsys, memeTemplatesManifest)
+	if err != nil {
+		return nil, fmt.Errorf("reading meme templates: %w", err)
+	}
+	var templates []MemeTemplate
+	if err := json.Unmarshal(manifest, &templates); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", memeTemplatesManifest, err)
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no meme templates in %s", memeTemplatesManifest)
+	}
+
+	seen := make(map[string]bool, len(templates))
+	for i := range templates {
+		template := &templates[i]
+		if template.ID == "" || seen[template.ID] {
+			return nil, fmt.Errorf("meme template %d: empty or duplicate id %q", i, template.ID)
+		}
+		seen[template.ID] = true
+		if err := template.load(fsys); err != nil {
+			return nil, fmt.Errorf("meme template %s: %w", template.ID, err)
+		}
+	}
+	return templates, nil
+}
+
+// load decodes the template image and validates the slots against it
+func (t *MemeTemplate) load(fsys fs.FS) error {
+	data, err := fs.ReadFile(fsys, t.Image)
+	if err != nil {
+		return fmt.Errorf("reading image: %w", err)
+	}
+	t.picture, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decoding image %s: %w", t.Image, err)
+	}
+
+	if len(t.Slots) == 0 {
+		return fmt.Errorf("no text slots")
+	}
+	bounds := t.picture.Bounds()
+	names := make(map[string]bool, len(t.Slots))
+	for i := range t.Slots {
+		slot := &t.Slots[i]
+		if slot.Name == "" || names[slot.Name] {
+			return fmt.Errorf("slot %d: empty or duplicate name %q", i, slot.Name)
+		}
+		names[slot.Name] = true
+
+		box := slot.rect().Add(bounds.Min)
+		if box.Empty() || !box.In(bounds) {
+			return fmt.Errorf("slot %s: box %v is outside of image %v", slot.Name, slot.Box, bounds)
+		}
+		switch slot.Align {
+		case "", TextAlignTop, TextAlignMiddle, TextAlignBottom:
+		default:
+			return fmt.Errorf("slot %s: unknown align %q", slot.Name, slot.Align)
+		}
+
+		slot.style = TextStyle{Align: slot.Align, MaxFontSize: slot.MaxFont, Uppercase: slot.Uppercase}
+		if slot.style.Color, err = parseHexColor(slot.Color); err != nil {
+			return fmt.Errorf("slot %s: %w", slot.Name, err)
+		}
+		if slot.Outline != "" {
+			if slot.style.Outline, err = parseHexColor(slot.Outline); err != nil {
+				return fmt.Errorf("slot %s: %w", slot.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Render draws the slot texts over the template image. Slots missing from
+// texts stay empty; texts for unknown slots are ignored.
+func (t *MemeTemplate) Render(texts map[string]string) (image.Image, error) {
+	bounds := t.picture.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), t.picture, bounds.Min, draw.Src)
+
+	for _, slot := range t.Slots {
+		if err := DrawText(canvas, slot.rect(), texts[slot.Name], slot.style); err != nil {
+			return nil, fmt.Errorf("drawing slot %s: %w", slot.Name, err)
+		}
+	}
+	return canvas, nil
+}
+
+// parseHexColor parses a #rrggbb colour; an empty string is black
+func parseHexColor(value string) (color.Color, error) {
+	if value == "" {
+		return color.Black, nil
+	}
+	hex := strings.TrimPrefix(value, "#")
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("invalid color %q", value)
+	}
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, nil
+}
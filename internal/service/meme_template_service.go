@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MemeTemplateServiceImpl renders meme templates locally: GPT picks
+// a template for the prompt and writes the texts, the image is drawn in Go.
+// It needs no image generation API, so it keeps working when they are down.
+type MemeTemplateServiceImpl struct {
+	logger    *logger.Logger
+	gpt       GPTService
+	templates []MemeTemplate
+}
+
+// NewMemeTemplateService loads templates from dir (built-in ones when dir is empty)
+func NewMemeTemplateService(dir string, gpt GPTService, log *logger.Logger) (*MemeTemplateServiceImpl, error) {
+	templates, err := LoadMemeTemplates(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &MemeTemplateServiceImpl{
+		logger:    log,
+		gpt:       gpt,
+		templates: templates,
+	}, nil
+}
+
+// GenerateImage asks GPT to choose a template for the prompt and fill its
+// slots, then renders the meme as PNG
+func (s *MemeTemplateServiceImpl) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", ProviderMemeTemplate))
+	}()
+
+	choice, err := s.gpt.ChooseMemeTemplate(ctx, promptText, s.templates)
+	if err != nil {
+		return nil, fmt.Errorf("choosing meme template: %w", err)
+	}
+	template := s.template(choice.Template)
+	if template == nil {
+		return nil, fmt.Errorf("unknown meme template %q", choice.Template)
+	}
+
+	texts := make(map[string]string, len(template.Slots))
+	for _, slot := range template.Slots {
+		if text := strings.TrimSpace(choice.Slots[slot.Name]); text != "" {
+			texts[slot.Name] = text
+		}
+	}
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("no texts for meme template %s", template.ID)
+	}
+
+	s.logger.Debug(ctx, "Rendering meme template", map[string]interface{}{
+		"template": template.ID,
+		"slots":    texts,
+	})
+
+	meme, err := template.Render(texts)
+	if err != nil {
+		return nil, fmt.Errorf("rendering meme template %s: %w", template.ID, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, meme); err != nil {
+		return nil, fmt.Errorf("encoding meme: %w", err)
+	}
+
+	return &GenerationResult{
+		Image:    buf.Bytes(),
+		MIMEType: "image/png",
+		Model:    template.ID,
+		Prompt:   promptText,
+		Attempts: 1,
+	}, nil
+}
+
+// template returns the template with the given ID or nil
+func (s *MemeTemplateServiceImpl) template(id string) *MemeTemplate {
+	for i := range s.templates {
+		if strings.EqualFold(s.templates[i].ID, strings.TrimSpace(id)) {
+			return &s.templates[i]
+		}
+	}
+	return nil
+}
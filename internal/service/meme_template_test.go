@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// templateGPT возвращает заранее заданный выбор шаблона
+type templateGPT struct {
+	choice *MemeTemplateChoice
+	err    error
+	// templates - шаблоны, которые получил GPT
+	templates []MemeTemplate
+}
+
+func (g *templateGPT) GenerateImagePrompt(_ context.Context, userPrompt string) (string, string, error) {
+	return userPrompt, "", nil
+}
+
+func (g *templateGPT) ChooseMemeTemplate(_ context.Context, _ string, templates []MemeTemplate) (*MemeTemplateChoice, error) {
+	g.templates = templates
+	return g.choice, g.err
+}
+
+// changedPixels считает пиксели рамки, отличающиеся от исходного изображения
+func changedPixels(before, after image.Image, box image.Rectangle) int {
+	changed := 0
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			r1, g1, b1, _ := before.At(x, y).RGBA()
+			r2, g2, b2, _ := after.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestLoadMemeTemplates_Embedded(t *testing.T) {
+	templates, err := LoadMemeTemplates("")
+
+	assert.NoError(t, err)
+	var ids []string
+	for _, template := range templates {
+		ids = append(ids, template.ID)
+		assert.NotNil(t, template.picture, template.ID)
+		assert.NotEmpty(t, template.Slots, template.ID)
+	}
+	assert.Equal(t, []string{"reject_approve", "three_people", "two_buttons", "sign", "four_levels"}, ids)
+}
+
+func TestLoadMemeTemplates_Invalid(t *testing.T) {
+	var picture bytes.Buffer
+	assert.NoError(t, png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 100, 100))))
+
+	tests := []struct {
+		name     string
+		manifest string
+		wantErr  string
+	}{
+		{
+			name:     "box outside of image",
+			manifest: `[{"id": "a", "image": "a.png", "slots": [{"name": "top", "box": [0, 0, 200, 50]}]}]`,
+			wantErr:  "outside of image",
+		},
+		{
+			name:     "duplicate id",
+			manifest: `[{"id": "a", "image": "a.png", "slots": [{"name": "top", "box": [0, 0, 100, 50]}]}, {"id": "a"}]`,
+			wantErr:  "duplicate id",
+		},
+		{
+			name:     "no slots",
+			manifest: `[{"id": "a", "image": "a.png"}]`,
+			wantErr:  "no text slots",
+		},
+		{
+			name:     "invalid color",
+			manifest: `[{"id": "a", "image": "a.png", "slots": [{"name": "top", "box": [0, 0, 100, 50], "color": "red"}]}]`,
+			wantErr:  "invalid color",
+		},
+		{
+			name:     "missing image",
+			manifest: `[{"id": "a", "image": "b.png", "slots": [{"name": "top", "box": [0, 0, 100, 50]}]}]`,
+			wantErr:  "reading image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates.json"), []byte(tt.manifest), 0o644))
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.png"), picture.Bytes(), 0o644))
+
+			_, err := LoadMemeTemplates(dir)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestMemeTemplate_Render(t *testing.T) {
+	templates, err := LoadMemeTemplates("")
+	assert.NoError(t, err)
+	template := templates[0]
+
+	meme, err := template.Render(map[string]string{"approved": "Писать тесты"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, template.picture.Bounds().Size(), meme.Bounds().Size())
+	assert.Greater(t, changedPixels(template.picture, meme, template.Slots[1].rect()), 100, "text is drawn into its slot")
+	assert.Zero(t, changedPixels(template.picture, meme, template.Slots[0].rect()), "empty slot is left untouched")
+}
+
+func TestDrawText_FitsLongText(t *testing.T) {
+	box := image.Rect(10, 10, 210, 110)
+	canvas := image.NewRGBA(image.Rect(0, 0, 220, 120))
+	text := strings.Repeat("очень длинная подпись ", 8)
+
+	err := DrawText(canvas, box, text, TextStyle{Color: color.White, Outline: color.Black, MaxFontSize: 60})
+
+	assert.NoError(t, err)
+	blank := image.NewRGBA(canvas.Bounds())
+	inside := changedPixels(blank, canvas, box)
+	assert.Greater(t, inside, 0)
+	assert.Equal(t, inside, changedPixels(blank, canvas, canvas.Bounds()), "nothing is drawn outside the box")
+}
+
+func TestMemeTemplateService_GenerateImage(t *testing.T) {
+	tests := []struct {
+		name      string
+		choice    *MemeTemplateChoice
+		gptErr    error
+		wantModel string
+		wantErr   string
+	}{
+		{
+			name: "renders chosen template",
+			choice: &MemeTemplateChoice{Template: "Two_Buttons", Slots: map[string]string{
+				"left": "Спать", "right": "Смотреть сериал", "chooser": "Я в три часа ночи", "unknown": "лишний",
+			}},
+			wantModel: "two_buttons",
+		},
+		{
+			name:    "unknown template",
+			choice:  &MemeTemplateChoice{Template: "grumpy_cat", Slots: map[string]string{"top": "нет"}},
+			wantErr: `unknown meme template "grumpy_cat"`,
+		},
+		{
+			name:    "no texts",
+			choice:  &MemeTemplateChoice{Template: "reject_approve", Slots: map[string]string{"rejected": " "}},
+			wantErr: "no texts for meme template reject_approve",
+		},
+		{
+			name:    "gpt error",
+			gptErr:  errors.New("quota exceeded"),
+			wantErr: "choosing meme template: quota exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gpt := &templateGPT{choice: tt.choice, err: tt.gptErr}
+			svc, err := NewMemeTemplateService("", gpt, newQuietLogger())
+			assert.NoError(t, err)
+
+			result, err := svc.GenerateImage(context.Background(), "выбор перед сном")
+
+			assert.Len(t, gpt.templates, 5)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantModel, result.Model)
+			assert.Equal(t, "image/png", result.MIMEType)
+			assert.Equal(t, "выбор перед сном", result.Prompt)
+
+			meme, err := png.Decode(bytes.NewReader(result.Image))
+			assert.NoError(t, err)
+			assert.Equal(t, image.Pt(600, 800), meme.Bounds().Size())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// ollamaDefaultURL - адрес Ollama по умолчанию
+	ollamaDefaultURL = "http://localhost:11434"
+	// ollamaDefaultModel - модель по умолчанию
+	ollamaDefaultModel = "llama3.1"
+)
+
+// OllamaConfig configures a local Ollama server
+type OllamaConfig struct {
+	// BaseURL - адрес сервера Ollama
+	BaseURL string
+	// Model - имя скачанной модели, например llama3.1
+	Model string
+	// Timeout - таймаут запроса; первая генерация загружает модель в память и может быть долгой
+	Timeout time.Duration
+}
+
+// OllamaClient implements LLMClient through the Ollama /api/chat API
+type OllamaClient struct {
+	logger *logger.Logger
+	cfg    OllamaConfig
+	url    string
+	client *http.Client
+}
+
+// NewOllamaClient creates an Ollama client; empty settings are replaced with defaults
+func NewOllamaClient(cfg OllamaConfig, log *logger.Logger) *OllamaClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = ollamaDefaultURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = ollamaDefaultModel
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = llmDefaultTimeout
+	}
+	return &OllamaClient{
+		logger: log,
+		cfg:    cfg,
+		url:    strings.TrimRight(cfg.BaseURL, "/") + "/api/chat",
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// OllamaChatRequest is the body of POST /api/chat
+type OllamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  OllamaOptions `json:"options"`
+	// Format - JSON Schema ответа для структурированного вывода
+	Format map[string]interface{} `json:"format,omitempty"`
+}
+
+// OllamaOptions holds the generation parameters of Ollama
+type OllamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+// OllamaChatResponse is the response of /api/chat without streaming
+type OllamaChatResponse struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Name returns the backend name
+func (c *OllamaClient) Name() string {
+	return LLMProviderOllama
+}
+
+// Complete sends the dialog to Ollama and waits for the whole answer
+func (c *OllamaClient) Complete(ctx context.Context, request LLMRequest) (string, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", LLMProviderOllama))
+	}()
+
+	requestBody, err := json.Marshal(OllamaChatRequest{
+		Model:    c.cfg.Model,
+		Messages: chatMessages(request.Messages),
+		Format:   request.JSONSchema,
+		Options: OllamaOptions{
+			Temperature: request.Temperature,
+			NumPredict:  request.MaxTokens,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshalling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c.logger.Debug(ctx, "Sending Ollama chat request", map[string]interface{}{
+		"url":   c.url,
+		"model": c.cfg.Model,
+	})
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, llmMaxResponseBytes))
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+
+	var response OllamaChatResponse
+	decodeErr := json.Unmarshal(body, &response)
+	if response.Error != "" {
+		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, response.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateText(string(body), 200))
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("decoding response: %w", decodeErr)
+	}
+	if strings.TrimSpace(response.Message.Content) == "" {
+		return "", fmt.Errorf("empty chat response")
+	}
+	return response.Message.Content, nil
+}
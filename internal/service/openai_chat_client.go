@@ -0,0 +1,146 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// openAIDefaultChatModel - модель chat completions по умолчанию
+	openAIDefaultChatModel = "gpt-4o-mini"
+	// llmMaxResponseBytes - ограничение размера ответа языковой модели
+	llmMaxResponseBytes = 1 << 20
+)
+
+// OpenAIChatConfig configures an OpenAI-compatible chat completions API
+type OpenAIChatConfig struct {
+	// BaseURL - адрес API, с /v1 или без
+	BaseURL string
+	// APIKey - ключ, передается в заголовке Authorization: Bearer
+	APIKey string
+	// Model - модель, например gpt-4o-mini
+	Model string
+	// Timeout - таймаут запроса
+	Timeout time.Duration
+}
+
+// OpenAIChatClient implements LLMClient through the OpenAI-style
+// /v1/chat/completions API, which vLLM, LM Studio, OpenRouter and others expose
+type OpenAIChatClient struct {
+	logger *logger.Logger
+	cfg    OpenAIChatConfig
+	url    string
+	client *http.Client
+}
+
+// NewOpenAIChatClient creates a client of an OpenAI-compatible chat API;
+// empty settings are replaced with defaults
+func NewOpenAIChatClient(cfg OpenAIChatConfig, log *logger.Logger) *OpenAIChatClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = openAIDefaultBaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = openAIDefaultChatModel
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = llmDefaultTimeout
+	}
+	return &OpenAIChatClient{
+		logger: log,
+		cfg:    cfg,
+		url:    openAIURL(cfg.BaseURL, "/chat/completions"),
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// OpenAIChatRequest is the body of POST /v1/chat/completions
+type OpenAIChatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+}
+
+// OpenAIChatResponse is the response of /v1/chat/completions
+type OpenAIChatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Error *OpenAIError `json:"error,omitempty"`
+}
+
+// Name returns the backend name
+func (c *OpenAIChatClient) Name() string {
+	return LLMProviderOpenAI
+}
+
+// Complete sends the dialog to the chat completions API
+func (c *OpenAIChatClient) Complete(ctx context.Context, request LLMRequest) (string, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", "openai_chat"))
+	}()
+
+	requestBody, err := json.Marshal(OpenAIChatRequest{
+		Model:       c.cfg.Model,
+		Messages:    chatMessages(request.Messages),
+		Temperature: request.Temperature,
+		MaxTokens:   request.MaxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshalling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.APIKey)
+	}
+
+	c.logger.Debug(ctx, "Sending OpenAI chat completion request", map[string]interface{}{
+		"url":   c.url,
+		"model": c.cfg.Model,
+	})
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, llmMaxResponseBytes))
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+
+	var response OpenAIChatResponse
+	decodeErr := json.Unmarshal(body, &response)
+	if response.Error != nil {
+		return "", fmt.Errorf("API error (status %d, %s): %s", resp.StatusCode, response.Error.Code, response.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateText(string(body), 200))
+	}
+	if decodeErr != nil {
+		return "", fmt.Errorf("decoding response: %w", decodeErr)
+	}
+	if len(response.Choices) == 0 || strings.TrimSpace(response.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("empty chat completion")
+	}
+	return response.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// openAIDefaultBaseURL - API OpenAI; совместимые шлюзы задают свой адрес
+	openAIDefaultBaseURL = "https://api.openai.com"
+	// openAIDefaultModel - модель по умолчанию
+	openAIDefaultModel = "dall-e-3"
+	// openAIDefaultTimeout - генерация одного изображения занимает до минуты
+	openAIDefaultTimeout = 2 * time.Minute
+	// openAIMaxResponseBytes - ограничение размера ответа (base64 или скачанного изображения)
+	openAIMaxResponseBytes = 64 << 20
+
+	// openAIResponseFormatB64 - изображение приходит в ответе в base64
+	openAIResponseFormatB64 = "b64_json"
+	// openAIResponseFormatURL - в ответе приходит ссылка на изображение
+	openAIResponseFormatURL = "url"
+)
+
+// OpenAIImageConfig configures an OpenAI-compatible image generation API
+type OpenAIImageConfig struct {
+	// BaseURL - адрес API, с /v1 или без
+	BaseURL string
+	// APIKey - ключ, передается в заголовке Authorization: Bearer
+	APIKey string
+	// Model - модель генерации, например dall-e-3
+	Model string
+	// Size - размер изображения, например 1024x1024; пустое значение - размер по умолчанию API
+	Size string
+	// ResponseFormat - b64_json или url; пустое значение - параметр не передается
+	ResponseFormat string
+	// Timeout - таймаут запросов к API
+	Timeout time.Duration
+}
+
+// OpenAIImageServiceImpl implements image generation through the OpenAI-style
+// /v1/images/generations API, which many vendors and self-hosted gateways expose
+type OpenAIImageServiceImpl struct {
+	logger *logger.Logger
+	cfg    OpenAIImageConfig
+	url    string
+	client *http.Client
+}
+
+// NewOpenAIImageService creates a client of an OpenAI-compatible API;
+// empty settings are replaced with defaults
+func NewOpenAIImageService(cfg OpenAIImageConfig, log *logger.Logger) *OpenAIImageServiceImpl {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = openAIDefaultBaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = openAIDefaultModel
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = openAIDefaultTimeout
+	}
+	switch cfg.ResponseFormat {
+	case "", openAIResponseFormatB64, openAIResponseFormatURL:
+	default:
+		log.Warn(context.Background(), "Unknown OpenAI response format, using b64_json", map[string]interface{}{
+			"response_format": cfg.ResponseFormat,
+		})
+		cfg.ResponseFormat = openAIResponseFormatB64
+	}
+
+	return &OpenAIImageServiceImpl{
+		logger: log,
+		cfg:    cfg,
+		url:    openAIURL(cfg.BaseURL, "/images/generations"),
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// openAIURL builds the URL of an endpoint such as /images/generations;
+// the base URL may already end with /v1
+func openAIURL(baseURL, endpoint string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if strings.HasSuffix(baseURL, "/v1") {
+		return baseURL + endpoint
+	}
+	return baseURL + "/v1" + endpoint
+}
+
+// OpenAIImageRequest is the body of POST /v1/images/generations
+type OpenAIImageRequest struct {
+	Model          string `json:"model,omitempty"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// OpenAIImageResponse is the response of /v1/images/generations
+type OpenAIImageResponse struct {
+	Created int64             `json:"created"`
+	Data    []OpenAIImageData `json:"data"`
+	Error   *OpenAIError      `json:"error,omitempty"`
+}
+
+// OpenAIImageData holds a single generated image
+type OpenAIImageData struct {
+	B64JSON       string `json:"b64_json,omitempty"`
+	URL           string `json:"url,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+// OpenAIError is the error object returned by OpenAI-compatible APIs
+type OpenAIError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+}
+
+// censored reports whether the API refused the prompt by its content policy
+func (e *OpenAIError) censored() bool {
+	return e.Code == "content_policy_violation" || strings.Contains(e.Message, "safety system")
+}
+
+// GenerateImage generates an image with a single synchronous request
+func (s *OpenAIImageServiceImpl) GenerateImage(ctx context.Context, prompt string) (*GenerationResult, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", ProviderOpenAI))
+	}()
+
+	requestBody, err := json.Marshal(OpenAIImageRequest{
+		Model:          s.cfg.Model,
+		Prompt:         prompt,
+		N:              1,
+		Size:           s.cfg.Size,
+		ResponseFormat: s.cfg.ResponseFormat,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	}
+
+	s.logger.Debug(ctx, "Sending OpenAI image generation request", map[string]interface{}{
+		"url":             s.url,
+		"model":           s.cfg.Model,
+		"size":            s.cfg.Size,
+		"response_format": s.cfg.ResponseFormat,
+	})
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, openAIMaxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var response OpenAIImageResponse
+	decodeErr := json.Unmarshal(body, &response)
+	if response.Error != nil {
+		if response.Error.censored() {
+			return nil, fmt.Errorf("%w: %s", ErrCensoredImage, response.Error.Message)
+		}
+		return nil, fmt.Errorf("API error (status %d, %s): %s", resp.StatusCode, response.Error.Code, response.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateText(string(body), 200))
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("decoding response: %w", decodeErr)
+	}
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("response contains no images")
+	}
+
+	data := response.Data[0]
+	attempts := 1
+	var imageData []byte
+	switch {
+	case data.B64JSON != "":
+		if imageData, err = base64.StdEncoding.DecodeString(data.B64JSON); err != nil {
+			return nil, fmt.Errorf("decoding base64 image: %w", err)
+		}
+	case data.URL != "":
+		attempts++
+		if imageData, err = s.download(ctx, data.URL); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("response contains neither b64_json nor url")
+	}
+
+	result := &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Model:    s.cfg.Model,
+		Prompt:   prompt,
+		Attempts: attempts,
+	}
+	// DALL-E 3 переписывает промпт - сохраняем то, что реально нарисовано
+	if data.RevisedPrompt != "" {
+		result.Prompt = data.RevisedPrompt
+	}
+	return result, nil
+}
+
+// download fetches an image returned by URL
+func (s *OpenAIImageServiceImpl) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating image download request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d while downloading image", resp.StatusCode)
+	}
+	imageData, err := io.ReadAll(io.LimitReader(resp.Body, openAIMaxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading downloaded image: %w", err)
+	}
+	return imageData, nil
+}
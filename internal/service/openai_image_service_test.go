@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newOpenAIStub запускает сервер, отвечающий как /v1/images/generations
+func newOpenAIStub(t *testing.T, handler func(w http.ResponseWriter, request OpenAIImageRequest)) *httptest.Server {
+	t.Helper()
+
+	return newStubServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/files/image.png" {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPhoto(t, 64, 64))
+			return
+		}
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/images/generations", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var request OpenAIImageRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, request)
+	}))
+}
+
+func newTestOpenAIService(baseURL, responseFormat string) *OpenAIImageServiceImpl {
+	return NewOpenAIImageService(OpenAIImageConfig{
+		BaseURL:        baseURL,
+		APIKey:         "test-key",
+		Model:          "test-model",
+		Size:           "512x512",
+		ResponseFormat: responseFormat,
+	}, newQuietLogger())
+}
+
+func TestOpenAIImageService_B64JSON(t *testing.T) {
+	image := testPhoto(t, 64, 64)
+	server := newOpenAIStub(t, func(w http.ResponseWriter, request OpenAIImageRequest) {
+		assert.Equal(t, "test-model", request.Model)
+		assert.Equal(t, "кот в шляпе", request.Prompt)
+		assert.Equal(t, 1, request.N)
+		assert.Equal(t, "512x512", request.Size)
+		assert.Equal(t, "b64_json", request.ResponseFormat)
+
+		json.NewEncoder(w).Encode(OpenAIImageResponse{
+			Created: 1,
+			Data: []OpenAIImageData{{
+				B64JSON:       base64.StdEncoding.EncodeToString(image),
+				RevisedPrompt: "рыжий кот в цилиндре",
+			}},
+		})
+	})
+
+	result, err := newTestOpenAIService(server.URL, "b64_json").GenerateImage(context.Background(), "кот в шляпе")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, "image/png", result.MIMEType)
+	assert.Equal(t, "test-model", result.Model)
+	assert.Equal(t, "рыжий кот в цилиндре", result.Prompt)
+	assert.Equal(t, 1, result.Attempts)
+}
+
+func TestOpenAIImageService_URL(t *testing.T) {
+	var server *httptest.Server
+	server = newOpenAIStub(t, func(w http.ResponseWriter, request OpenAIImageRequest) {
+		assert.Equal(t, "url", request.ResponseFormat)
+		json.NewEncoder(w).Encode(OpenAIImageResponse{
+			Data: []OpenAIImageData{{URL: server.URL + "/files/image.png"}},
+		})
+	})
+
+	// Базовый URL может уже содержать /v1
+	result, err := newTestOpenAIService(server.URL+"/v1/", "url").GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", result.MIMEType)
+	assert.NotEmpty(t, result.Image)
+	assert.Equal(t, "prompt", result.Prompt)
+	assert.Equal(t, 2, result.Attempts)
+}
+
+func TestOpenAIImageService_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		censored bool
+		contains string
+	}{
+		{
+			name:     "content policy",
+			status:   http.StatusBadRequest,
+			body:     `{"error":{"message":"Your request was rejected as a result of our safety system.","type":"invalid_request_error","code":"content_policy_violation"}}`,
+			censored: true,
+		},
+		{
+			name:     "api error",
+			status:   http.StatusUnauthorized,
+			body:     `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`,
+			contains: "Incorrect API key provided",
+		},
+		{
+			name:     "gateway error",
+			status:   http.StatusBadGateway,
+			body:     `upstream unavailable`,
+			contains: "unexpected status code 502",
+		},
+		{
+			name:     "no images",
+			status:   http.StatusOK,
+			body:     `{"created":1,"data":[]}`,
+			contains: "no images",
+		},
+		{
+			name:     "broken base64",
+			status:   http.StatusOK,
+			body:     `{"data":[{"b64_json":"not base64!"}]}`,
+			contains: "decoding base64 image",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newOpenAIStub(t, func(w http.ResponseWriter, _ OpenAIImageRequest) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			result, err := newTestOpenAIService(server.URL, "b64_json").GenerateImage(context.Background(), "prompt")
+
+			assert.Nil(t, result)
+			if tt.censored {
+				assert.ErrorIs(t, err, ErrCensoredImage)
+				return
+			}
+			assert.ErrorContains(t, err, tt.contains)
+			assert.NotErrorIs(t, err, ErrCensoredImage)
+		})
+	}
+}
+
+func TestOpenAIImageService_OmitsEmptyResponseFormat(t *testing.T) {
+	image := testPhoto(t, 64, 64)
+	server := newOpenAIStub(t, func(w http.ResponseWriter, request OpenAIImageRequest) {
+		assert.Empty(t, request.ResponseFormat)
+		json.NewEncoder(w).Encode(OpenAIImageResponse{
+			Data: []OpenAIImageData{{B64JSON: base64.StdEncoding.EncodeToString(image)}},
+		})
+	})
+
+	_, err := newTestOpenAIService(server.URL, "").GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+}
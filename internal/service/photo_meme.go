@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// ProviderUserPhoto - значение Provider у мемов по фотографии пользователя
+	ProviderUserPhoto = "user_photo"
+	// telegramMaxDownloadBytes - Bot API отдает ботам файлы размером до 20 МБ
+	telegramMaxDownloadBytes = 20 << 20
+	// fileDownloadTimeout - таймаут скачивания файла из Telegram
+	fileDownloadTimeout = time.Minute
+)
+
+// DownloadFile downloads a file sent to the bot: getFile resolves the file
+// path, then the file itself is fetched from the Bot API file endpoint
+func (s *BotServiceImpl) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	response, err := s.Bot.Request(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, fmt.Errorf("getting file: %w", err)
+	}
+	var file tgbotapi.File
+	if err := json.Unmarshal(response.Result, &file); err != nil {
+		return nil, fmt.Errorf("decoding file: %w", err)
+	}
+	if file.FilePath == "" {
+		return nil, fmt.Errorf("file %s has no path", fileID)
+	}
+	if file.FileSize > telegramMaxDownloadBytes {
+		return nil, fmt.Errorf("file is too large: %d bytes", file.FileSize)
+	}
+
+	link := fmt.Sprintf(s.fileEndpoint, s.config.TelegramToken, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// URL содержит токен бота, поэтому в ошибку попадает только причина
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("downloading file %s: %w", file.FilePath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, telegramMaxDownloadBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	if len(data) > telegramMaxDownloadBytes {
+		return nil, fmt.Errorf("file is too large: more than %d bytes", telegramMaxDownloadBytes)
+	}
+	return data, nil
+}
+
+// CaptionPhoto turns the user's own photo into a meme: GPT writes a caption
+// for the text and the caption is drawn onto the photo. No image provider is
+// involved. The caption is always drawn; the chat caption mode only decides
+// whether it is repeated as the Telegram caption.
+func (s *BotServiceImpl) CaptionPhoto(ctx context.Context, photo []byte, args string) (*MemeResult, error) {
+	metrics.CommandFrequency.Inc("meme_photo")
+
+	args, opts := ParseMemeArgs(args)
+	if args == "" {
+		return nil, fmt.Errorf("empty caption text")
+	}
+
+	normalized, err := NewImageNormalizer(DefaultImageNormalizerConfig()).Normalize(photo)
+	if err != nil {
+		return nil, err
+	}
+
+	enhanceStart := time.Now()
+	_, caption, err := s.promptEnhancer.EnhancePrompt(ctx, PlainPrompt(args))
+	enhanceDuration := time.Since(enhanceStart)
+	if err != nil || caption == "" {
+		s.logger.Warn(ctx, "Failed to write caption for photo, using the text as is", map[string]interface{}{
+			"error": fmt.Sprint(err),
+			"args":  args,
+		})
+		caption = PlainPrompt(args)
+	}
+
+	mode := s.resolveCaptionMode(ctx, opts)
+	if !mode.Overlay() {
+		mode = CaptionModeOverlay
+	}
+
+	drawStart := time.Now()
+	data, err := OverlayCaption(normalized.Data, caption)
+	if err != nil {
+		return nil, fmt.Errorf("drawing caption: %w", err)
+	}
+
+	return &MemeResult{
+		GenerationResult: &GenerationResult{
+			Image:    data,
+			MIMEType: "image/jpeg",
+			Provider: ProviderUserPhoto,
+			Latency:  time.Since(drawStart),
+			Attempts: 1,
+		},
+		Caption:            caption,
+		UserPrompt:         args,
+		CaptionMode:        mode,
+		EnhanceDuration:    enhanceDuration,
+		GenerationDuration: time.Since(drawStart),
+	}, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/azalio/meme-bot/internal/config"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fileBotAPI отвечает на getFile заранее заданным файлом
+type fileBotAPI struct {
+	file tgbotapi.File
+	err  error
+	// requested - ID файлов, запрошенных через getFile
+	requested []string
+}
+
+func (b *fileBotAPI) Send(tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return tgbotapi.Message{}, nil
+}
+
+func (b *fileBotAPI) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.requested = append(b.requested, c.(tgbotapi.FileConfig).FileID)
+	result, err := json.Marshal(b.file)
+	if err != nil {
+		return nil, err
+	}
+	return &tgbotapi.APIResponse{Ok: true, Result: result}, nil
+}
+
+func (b *fileBotAPI) StopReceivingUpdates() {}
+
+func (b *fileBotAPI) GetUpdatesChan(tgbotapi.UpdateConfig) tgbotapi.UpdatesChannel {
+	return nil
+}
+
+// newPhotoBotService создает сервис, скачивающий файлы с тестового сервера
+func newPhotoBotService(t *testing.T, bot BotAPI, files http.Handler) *BotServiceImpl {
+	t.Helper()
+	server := httptest.NewServer(files)
+	t.Cleanup(server.Close)
+
+	return &BotServiceImpl{
+		config:         &config.Config{TelegramToken: "token"},
+		logger:         newQuietLogger(),
+		Bot:            bot,
+		promptEnhancer: NewPromptEnhancer(newQuietLogger(), &templateGPT{}),
+		captionMode:    CaptionModeTelegram,
+		httpClient:     server.Client(),
+		fileEndpoint:   server.URL + "/file/bot%s/%s",
+	}
+}
+
+func TestBotService_DownloadFile(t *testing.T) {
+	photo := testPhoto(t, 64, 64)
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file/bottoken/photos/file_1.png" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(photo)
+	})
+
+	t.Run("downloads", func(t *testing.T) {
+		bot := &fileBotAPI{file: tgbotapi.File{FileID: "photo-id", FilePath: "photos/file_1.png", FileSize: len(photo)}}
+		svc := newPhotoBotService(t, bot, files)
+
+		data, err := svc.DownloadFile(context.Background(), "photo-id")
+
+		assert.NoError(t, err)
+		assert.Equal(t, photo, data)
+		assert.Equal(t, []string{"photo-id"}, bot.requested)
+	})
+
+	tests := []struct {
+		name    string
+		bot     *fileBotAPI
+		wantErr string
+	}{
+		{
+			name:    "getFile fails",
+			bot:     &fileBotAPI{err: errors.New("Bad Request: invalid file_id")},
+			wantErr: "getting file: Bad Request: invalid file_id",
+		},
+		{
+			name:    "too large",
+			bot:     &fileBotAPI{file: tgbotapi.File{FilePath: "photos/file_1.png", FileSize: 25 << 20}},
+			wantErr: "file is too large",
+		},
+		{
+			name:    "not found",
+			bot:     &fileBotAPI{file: tgbotapi.File{FilePath: "photos/missing.png"}},
+			wantErr: "unexpected status code: 404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newPhotoBotService(t, tt.bot, files)
+
+			_, err := svc.DownloadFile(context.Background(), "photo-id")
+
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.NotContains(t, err.Error(), "token")
+		})
+	}
+}
+
+func TestBotService_CaptionPhoto(t *testing.T) {
+	svc := newPhotoBotService(t, &fileBotAPI{}, http.NotFoundHandler())
+	photo := testPhoto(t, 320, 240)
+
+	meme, err := svc.CaptionPhoto(context.Background(), photo, "--caption both когда пятница")
+
+	assert.NoError(t, err)
+	assert.Equal(t, ProviderUserPhoto, meme.Provider)
+	assert.Equal(t, "когда пятница", meme.Caption, "GPT fake returns no caption, so the text is used")
+	assert.Equal(t, CaptionModeBoth, meme.CaptionMode)
+	assert.Equal(t, "image/jpeg", meme.MIMEType)
+	decoded, err := jpeg.Decode(bytes.NewReader(meme.Image))
+	assert.NoError(t, err)
+	assert.Equal(t, 320, decoded.Bounds().Dx())
+
+	// Режим telegram не отменяет подпись на фото: в этом весь смысл команды
+	meme, err = svc.CaptionPhoto(context.Background(), photo, "кот")
+	assert.NoError(t, err)
+	assert.Equal(t, CaptionModeOverlay, meme.CaptionMode)
+
+	_, err = svc.CaptionPhoto(context.Background(), photo, "--no-cache")
+	assert.ErrorContains(t, err, "empty caption text")
+
+	_, err = svc.CaptionPhoto(context.Background(), []byte("not an image"), "кот")
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// PollOutcome classifies the result of a single status check
+type PollOutcome int
+
+const (
+	// PollPending - операция еще выполняется, нужно проверить позже
+	PollPending PollOutcome = iota
+	// PollDone - операция завершилась успешно, результат готов
+	PollDone
+	// PollRetryable - проверка не удалась (сеть, 5xx, битый ответ), но ее можно повторить
+	PollRetryable
+	// PollTerminal - операция завершилась ошибкой, повторять бессмысленно
+	PollTerminal
+)
+
+// String returns the outcome name for logs
+func (o PollOutcome) String() string {
+	switch o {
+	case PollPending:
+		return "pending"
+	case PollDone:
+		return "done"
+	case PollRetryable:
+		return "retryable"
+	case PollTerminal:
+		return "terminal"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrPollTimeout is returned when the operation does not finish before the deadline
+var ErrPollTimeout = errors.New("polling deadline exceeded")
+
+// PollConfig configures how an asynchronous operation is polled
+type PollConfig struct {
+	// InitialDelay - пауза перед первой проверкой (операция заведомо не готова сразу)
+	InitialDelay time.Duration
+	// Interval - пауза после первой проверки, дальше растет экспоненциально
+	Interval time.Duration
+	// MaxInterval - верхняя граница паузы между проверками
+	MaxInterval time.Duration
+	// Multiplier - во сколько раз растет пауза после каждой проверки
+	Multiplier float64
+	// Jitter - доля случайного отклонения паузы (0..1), чтобы запросы не шли синхронно
+	Jitter float64
+	// Timeout - общее время ожидания операции
+	Timeout time.Duration
+}
+
+// PollCheck performs one status check. The returned error describes why the
+// check was retryable or terminal and is ignored for pending outcomes.
+type PollCheck[T any] func(ctx context.Context, attempt int) (T, PollOutcome, error)
+
+// Poller waits for asynchronous provider operations using exponential backoff with jitter
+type Poller struct {
+	cfg       PollConfig
+	randFloat func() float64
+}
+
+// NewPoller creates a poller; zero values in cfg are replaced with sane defaults
+func NewPoller(cfg PollConfig) *Poller {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MaxInterval < cfg.Interval {
+		cfg.MaxInterval = cfg.Interval
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 1
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		cfg.Jitter = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	return &Poller{cfg: cfg, randFloat: rand.Float64}
+}
+
+// Poll calls check until it reports PollDone or PollTerminal, the deadline
+// passes or ctx is cancelled. It returns the result and the number of checks made.
+func Poll[T any](ctx context.Context, p *Poller, check PollCheck[T]) (T, int, error) {
+	var zero T
+	ctx, cancel := context.WithTimeoutCause(ctx, p.cfg.Timeout, ErrPollTimeout)
+	defer cancel()
+
+	timer := time.NewTimer(p.jittered(p.cfg.InitialDelay))
+	defer timer.Stop()
+
+	interval := p.cfg.Interval
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return zero, attempt - 1, p.deadlineError(ctx, attempt-1, lastErr)
+		case <-timer.C:
+		}
+
+		result, outcome, err := check(ctx, attempt)
+		switch outcome {
+		case PollDone:
+			return result, attempt, nil
+		case PollTerminal:
+			if err == nil {
+				err = errors.New("operation failed")
+			}
+			return zero, attempt, err
+		case PollRetryable:
+			lastErr = err
+			// Ошибка проверки из-за отмены контекста - это не повод ждать дальше
+			if ctx.Err() != nil {
+				return zero, attempt, p.deadlineError(ctx, attempt, lastErr)
+			}
+		}
+
+		timer.Reset(p.jittered(interval))
+		interval = min(time.Duration(float64(interval)*p.cfg.Multiplier), p.cfg.MaxInterval)
+	}
+}
+
+// jittered randomly shifts delay by up to ±Jitter of its value
+func (p *Poller) jittered(delay time.Duration) time.Duration {
+	if delay <= 0 || p.cfg.Jitter == 0 {
+		return max(delay, 0)
+	}
+	factor := 1 + p.cfg.Jitter*(2*p.randFloat()-1)
+	return time.Duration(float64(delay) * factor)
+}
+
+// deadlineError explains why polling stopped before the operation finished
+func (p *Poller) deadlineError(ctx context.Context, attempts int, lastErr error) error {
+	if errors.Is(context.Cause(ctx), ErrPollTimeout) {
+		if lastErr != nil {
+			return fmt.Errorf("%w after %d checks (%s), last error: %w", ErrPollTimeout, attempts, p.cfg.Timeout, lastErr)
+		}
+		return fmt.Errorf("%w after %d checks (%s)", ErrPollTimeout, attempts, p.cfg.Timeout)
+	}
+	return fmt.Errorf("polling cancelled after %d checks: %w", attempts, ctx.Err())
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFastPoller(timeout time.Duration) *Poller {
+	return NewPoller(PollConfig{
+		InitialDelay: time.Millisecond,
+		Interval:     time.Millisecond,
+		MaxInterval:  4 * time.Millisecond,
+		Multiplier:   2,
+		Jitter:       0.5,
+		Timeout:      timeout,
+	})
+}
+
+func TestPoll_RetriesUntilDone(t *testing.T) {
+	outcomes := []PollOutcome{PollPending, PollRetryable, PollPending, PollDone}
+
+	result, attempts, err := Poll(context.Background(), newFastPoller(time.Second),
+		func(ctx context.Context, attempt int) (string, PollOutcome, error) {
+			outcome := outcomes[attempt-1]
+			if outcome == PollDone {
+				return "image", outcome, nil
+			}
+			return "", outcome, errors.New("temporary")
+		})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "image", result)
+	assert.Equal(t, 4, attempts)
+}
+
+func TestPoll_StopsOnTerminalOutcome(t *testing.T) {
+	failure := errors.New("generation failed")
+
+	_, attempts, err := Poll(context.Background(), newFastPoller(time.Second),
+		func(ctx context.Context, attempt int) (string, PollOutcome, error) {
+			if attempt == 2 {
+				return "", PollTerminal, failure
+			}
+			return "", PollPending, nil
+		})
+
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestPoll_Deadline(t *testing.T) {
+	lastErr := errors.New("503")
+
+	_, attempts, err := Poll(context.Background(), newFastPoller(30*time.Millisecond),
+		func(ctx context.Context, attempt int) (string, PollOutcome, error) {
+			return "", PollRetryable, lastErr
+		})
+
+	assert.ErrorIs(t, err, ErrPollTimeout)
+	assert.ErrorIs(t, err, lastErr, "the last check error is kept for diagnostics")
+	assert.Greater(t, attempts, 1)
+}
+
+func TestPoll_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, attempts, err := Poll(ctx, newFastPoller(time.Minute),
+		func(ctx context.Context, attempt int) (string, PollOutcome, error) {
+			t.Fatal("check must not be called after cancellation")
+			return "", PollPending, nil
+		})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, ErrPollTimeout)
+	assert.Zero(t, attempts)
+}
+
+func TestPoll_InitialDelay(t *testing.T) {
+	poller := NewPoller(PollConfig{
+		InitialDelay: 50 * time.Millisecond,
+		Interval:     time.Millisecond,
+		Timeout:      time.Second,
+	})
+
+	start := time.Now()
+	_, _, err := Poll(context.Background(), poller,
+		func(ctx context.Context, attempt int) (int, PollOutcome, error) {
+			return attempt, PollDone, nil
+		})
+
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
@@ -12,19 +12,48 @@ import (
 // PromptEnhancer предоставляет функциональность для улучшения промптов
 type PromptEnhancer struct {
 	logger     *logger.Logger
-	gptService YandexGPTService
+	gptService GPTService
+	// flights объединяет одновременные запросы с одинаковым промптом
+	flights *flightGroup[enhancedPrompt]
+}
+
+// enhancedPrompt is the result of a prompt enhancement shared between identical requests
+type enhancedPrompt struct {
+	prompt  string
+	caption string
 }
 
 // NewPromptEnhancer создает новый экземпляр PromptEnhancer
-func NewPromptEnhancer(log *logger.Logger, gpt YandexGPTService) *PromptEnhancer {
+func NewPromptEnhancer(log *logger.Logger, gpt GPTService) *PromptEnhancer {
 	return &PromptEnhancer{
 		logger:     log,
 		gptService: gpt,
+		flights:    newFlightGroup[enhancedPrompt](),
 	}
 }
 
-// EnhancePrompt улучшает исходный промпт с помощью GPT
+// EnhancePrompt улучшает исходный промпт с помощью GPT.
+// Одновременные запросы с одинаковым (с точностью до регистра и пробелов)
+// промптом выполняются один раз, результат получают все.
 func (p *PromptEnhancer) EnhancePrompt(ctx context.Context, originalPrompt string) (string, string, error) {
+	result, shared, err := p.flights.Do(ctx, normalizePrompt(originalPrompt), func(ctx context.Context) (enhancedPrompt, error) {
+		prompt, caption, err := p.enhance(ctx, originalPrompt)
+		return enhancedPrompt{prompt: prompt, caption: caption}, err
+	})
+	if shared {
+		p.logger.Debug(ctx, "Prompt enhancement collapsed into an in-flight request", map[string]interface{}{
+			"original_prompt": originalPrompt,
+		})
+		metrics.RequestsCollapsed.Inc("enhance_prompt")
+	}
+	if err != nil {
+		return originalPrompt, "", err
+	}
+	return result.prompt, result.caption, nil
+}
+
+// enhance calls GPT for a single prompt
+func (p *PromptEnhancer) enhance(ctx context.Context, originalPrompt string) (string, string, error) {
 	startTime := time.Now()
 	defer func() {
 		metrics.PromptGenerationTime.Observe(time.Since(startTime).Seconds())
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/azalio/meme-bot/internal/config"
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+)
+
+// Имена встроенных провайдеров генерации изображений.
+// Совпадают со значением атрибута "service" в метрике APIResponseTime.
+const (
+	ProviderFusionBrain     = "fusion_brain"
+	ProviderYandexArt       = "yandex_art"
+	ProviderCloudflareAI    = "cloudflare_ai"
+	ProviderOpenAI          = "openai"
+	ProviderStableDiffusion = "stable_diffusion"
+	ProviderMemeTemplate    = "meme_template"
+)
+
+// ImageProvider describes a registered image generator together with its metadata.
+type ImageProvider struct {
+	Name      string
+	Generator ImageGenerator
+	Enabled   bool
+	// LastResort - провайдер запускается, только когда все остальные не справились
+	LastResort bool
+
+	successCounter *metrics.Counter
+	failureCounter *metrics.Counter
+}
+
+// ProviderOption configures a provider during registration.
+type ProviderOption func(*ImageProvider)
+
+// WithProviderCounters attaches provider-specific success/failure counters
+// that are incremented by the orchestration layer.
+func WithProviderCounters(success, failure *metrics.Counter) ProviderOption {
+	return func(p *ImageProvider) {
+		p.successCounter = success
+		p.failureCounter = failure
+	}
+}
+
+// WithProviderDisabled registers the provider in the disabled state.
+func WithProviderDisabled() ProviderOption {
+	return func(p *ImageProvider) {
+		p.Enabled = false
+	}
+}
+
+// WithProviderLastResort marks the provider as a last resort: it is never
+// launched together with the other providers, only after all of them have failed.
+func WithProviderLastResort() ProviderOption {
+	return func(p *ImageProvider) {
+		p.LastResort = true
+	}
+}
+
+// ProviderRegistry keeps the set of image providers available to ImageGenerationService.
+// Providers are stored in the order they should be tried; the order and the enabled
+// flag can be changed at runtime, e.g. from configuration.
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]*ImageProvider
+	order     []string
+}
+
+// NewProviderRegistry creates an empty provider registry
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: make(map[string]*ImageProvider),
+	}
+}
+
+// Register adds a generator under the given name. Registration order defines
+// the default provider order.
+func (r *ProviderRegistry) Register(name string, generator ImageGenerator, opts ...ProviderOption) error {
+	if name == "" {
+		return fmt.Errorf("provider name is empty")
+	}
+	if generator == nil {
+		return fmt.Errorf("provider %s: nil generator", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.providers[name]; exists {
+		return fmt.Errorf("provider %s already registered", name)
+	}
+
+	provider := &ImageProvider{
+		Name:      name,
+		Generator: generator,
+		Enabled:   true,
+	}
+	for _, opt := range opts {
+		opt(provider)
+	}
+
+	r.providers[name] = provider
+	r.order = append(r.order, name)
+	return nil
+}
+
+// SetEnabled enables or disables a registered provider
+func (r *ProviderRegistry) SetEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	provider, ok := r.providers[name]
+	if !ok {
+		return fmt.Errorf("provider %s not registered", name)
+	}
+	provider.Enabled = enabled
+	return nil
+}
+
+// Configure enables exactly the listed providers in the listed order and
+// disables all others. Unknown names are reported as an error, but the known
+// ones are still applied. An empty list leaves the registry untouched.
+func (r *ProviderRegistry) Configure(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unknown []string
+	seen := make(map[string]bool, len(names))
+	order := make([]string, 0, len(r.order))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, ok := r.providers[name]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		order = append(order, name)
+	}
+
+	// Не перечисленные в конфигурации провайдеры остаются зарегистрированными,
+	// но выключенными и уходят в конец списка
+	for _, name := range r.order {
+		r.providers[name].Enabled = seen[name]
+		if !seen[name] {
+			order = append(order, name)
+		}
+	}
+	r.order = order
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown providers in configuration: %v", unknown)
+	}
+	return nil
+}
+
+// Providers returns a snapshot of enabled providers in configured order
+func (r *ProviderRegistry) Providers() []ImageProvider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]ImageProvider, 0, len(r.order))
+	for _, name := range r.order {
+		if provider := r.providers[name]; provider.Enabled {
+			result = append(result, *provider)
+		}
+	}
+	return result
+}
+
+// Names returns names of all registered providers in configured order
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string(nil), r.order...)
+}
+
+// registerDefaultProviders registers the built-in providers. Providers that failed
+// to initialize (e.g. missing credentials) are skipped.
+func registerDefaultProviders(
+	registry *ProviderRegistry,
+	cfg *config.Config,
+	log *logger.Logger,
+	auth YandexAuthService,
+	gpt GPTService,
+) {
+	register := func(name string, generator ImageGenerator, opts ...ProviderOption) {
+		if err := registry.Register(name, generator, opts...); err != nil {
+			log.Error(context.Background(), "Failed to register image provider", map[string]interface{}{
+				"provider": name,
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	fusionBrain, err := NewFusionBrainService(FusionBrainConfig{
+		API:            cfg.FusionBrainAPI,
+		APIKey:         cfg.FusionBrainAPIKey,
+		SecretKey:      cfg.FusionBrainSecretKey,
+		Model:          cfg.FusionBrainModel,
+		Style:          cfg.FusionBrainStyle,
+		NegativePrompt: cfg.FusionBrainNegativePrompt,
+		Width:          cfg.FusionBrainWidth,
+		Height:         cfg.FusionBrainHeight,
+		ModelRefresh:   cfg.FusionBrainModelRefresh,
+	}, log)
+	if err != nil {
+		log.Error(context.Background(), "Failed to initialize FusionBrain provider", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		register(ProviderFusionBrain, fusionBrain,
+			WithProviderCounters(metrics.FusionBrainSuccessCounter, metrics.FusionBrainFailureCounter))
+	}
+
+	// Без учетных данных Yandex Cloud провайдер не регистрируется: конфигурация
+	// требует их, только если yandex_art явно указан в IMAGE_PROVIDERS
+	if cfg.YandexOAuthToken != "" && cfg.YandexArtFolderID != "" {
+		register(ProviderYandexArt, NewYandexArtService(cfg, log, auth, gpt),
+			WithProviderCounters(metrics.YandexArtSuccessCounter, metrics.YandexArtFailureCounter))
+	}
+
+	// Cloudflare Workers AI работает через свой Worker или напрямую через REST API аккаунта
+	if cfg.CloudflareWorkerURL != "" || (cfg.CloudflareAccountID != "" && cfg.CloudflareAPIToken != "") {
+		cloudflareAI, err := NewCloudflareAIService(CloudflareAIConfig{
+			WorkerURL:    cfg.CloudflareWorkerURL,
+			WorkerSecret: cfg.CloudflareWorkerSecret,
+			AccountID:    cfg.CloudflareAccountID,
+			APIToken:     cfg.CloudflareAPIToken,
+			Model:        cfg.CloudflareAIModel,
+			Steps:        cfg.CloudflareAISteps,
+			Timeout:      cfg.CloudflareAITimeout,
+		}, log)
+		if err != nil {
+			log.Error(context.Background(), "Failed to initialize Cloudflare AI provider", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			register(ProviderCloudflareAI, cloudflareAI,
+				WithProviderCounters(metrics.CloudflareAISuccessCounter, metrics.CloudflareAIFailureCounter))
+		}
+	}
+
+	// OpenAI-совместимый API нужен не всем, поэтому включается явной настройкой
+	if cfg.OpenAIImageBaseURL != "" || cfg.OpenAIImageAPIKey != "" {
+		register(ProviderOpenAI, NewOpenAIImageService(OpenAIImageConfig{
+			BaseURL:        cfg.OpenAIImageBaseURL,
+			APIKey:         cfg.OpenAIImageAPIKey,
+			Model:          cfg.OpenAIImageModel,
+			Size:           cfg.OpenAIImageSize,
+			ResponseFormat: cfg.OpenAIImageResponseFormat,
+			Timeout:        cfg.OpenAIImageTimeout,
+		}, log),
+			WithProviderCounters(metrics.OpenAISuccessCounter, metrics.OpenAIFailureCounter))
+	}
+
+	if cfg.StableDiffusionURL != "" {
+		stableDiffusion, err := NewStableDiffusionService(StableDiffusionConfig{
+			BaseURL:        cfg.StableDiffusionURL,
+			Backend:        cfg.StableDiffusionBackend,
+			Sampler:        cfg.StableDiffusionSampler,
+			Steps:          cfg.StableDiffusionSteps,
+			CFGScale:       cfg.StableDiffusionCFGScale,
+			NegativePrompt: cfg.StableDiffusionNegativePrompt,
+			Width:          cfg.StableDiffusionWidth,
+			Height:         cfg.StableDiffusionHeight,
+			Checkpoint:     cfg.StableDiffusionCheckpoint,
+			Workflow:       cfg.StableDiffusionWorkflow,
+			Timeout:        cfg.StableDiffusionTimeout,
+		}, log)
+		if err != nil {
+			log.Error(context.Background(), "Failed to initialize Stable Diffusion provider", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			register(ProviderStableDiffusion, stableDiffusion,
+				WithProviderCounters(metrics.StableDiffusionSuccessCounter, metrics.StableDiffusionFailureCounter))
+		}
+	}
+
+	// Шаблонные мемы рисуются локально и не зависят от API генерации изображений,
+	// поэтому это запасной вариант на случай, когда не справились все остальные
+	memeTemplates, err := NewMemeTemplateService(cfg.MemeTemplatesDir, gpt, log)
+	if err != nil {
+		log.Error(context.Background(), "Failed to initialize meme template provider", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		register(ProviderMemeTemplate, memeTemplates,
+			WithProviderCounters(metrics.MemeTemplateSuccessCounter, metrics.MemeTemplateFailureCounter),
+			WithProviderLastResort())
+	}
+}
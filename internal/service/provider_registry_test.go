@@ -0,0 +1,62 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderRegistry_Register(t *testing.T) {
+	registry := NewProviderRegistry()
+	for _, name := range []string{"b", "a", "c"} {
+		assert.NoError(t, registry.Register(name, &fakeGenerator{}))
+	}
+
+	assert.Equal(t, []string{"b", "a", "c"}, providerNames(registry.Providers()), "registration order is the default order")
+	assert.Equal(t, []string{"b", "a", "c"}, registry.Names())
+
+	assert.ErrorContains(t, registry.Register("a", &fakeGenerator{}), "already registered")
+	assert.ErrorContains(t, registry.Register("", &fakeGenerator{}), "name is empty")
+	assert.ErrorContains(t, registry.Register("d", nil), "nil generator")
+	assert.Equal(t, []string{"b", "a", "c"}, registry.Names())
+}
+
+func TestProviderRegistry_DisabledProviders(t *testing.T) {
+	registry := NewProviderRegistry()
+	assert.NoError(t, registry.Register("a", &fakeGenerator{}))
+	assert.NoError(t, registry.Register("b", &fakeGenerator{}, WithProviderDisabled()))
+	assert.NoError(t, registry.Register("c", &fakeGenerator{}))
+
+	assert.Equal(t, []string{"a", "c"}, providerNames(registry.Providers()))
+	assert.Equal(t, []string{"a", "b", "c"}, registry.Names(), "disabled providers stay registered")
+
+	assert.NoError(t, registry.SetEnabled("b", true))
+	assert.NoError(t, registry.SetEnabled("a", false))
+	assert.Equal(t, []string{"b", "c"}, providerNames(registry.Providers()))
+
+	assert.Error(t, registry.SetEnabled("unknown", true))
+}
+
+func TestProviderRegistry_Configure(t *testing.T) {
+	registry := NewProviderRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, registry.Register(name, &fakeGenerator{}))
+	}
+
+	// Пустой список не меняет реестр
+	assert.NoError(t, registry.Configure(nil))
+	assert.Equal(t, []string{"a", "b", "c"}, providerNames(registry.Providers()))
+
+	// Неизвестные имена - ошибка, но известные все равно применяются
+	err := registry.Configure([]string{"c", "a", "unknown", "c"})
+	assert.ErrorContains(t, err, "unknown")
+	assert.Equal(t, []string{"c", "a"}, providerNames(registry.Providers()))
+	assert.Equal(t, []string{"c", "a", "b"}, registry.Names(), "unlisted providers move to the end")
+
+	// Провайдер, выключенный при регистрации, включается конфигурацией
+	registry = NewProviderRegistry()
+	assert.NoError(t, registry.Register("a", &fakeGenerator{}))
+	assert.NoError(t, registry.Register("b", &fakeGenerator{}, WithProviderDisabled()))
+	assert.NoError(t, registry.Configure([]string{"b"}))
+	assert.Equal(t, []string{"b"}, providerNames(registry.Providers()))
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SelectionMode defines how providers are ordered for a request
+type SelectionMode string
+
+const (
+	// SelectionStatic использует порядок провайдеров из конфигурации
+	SelectionStatic SelectionMode = "static"
+	// SelectionAdaptive упорядочивает провайдеры по наблюдаемой успешности и скорости
+	// (epsilon-greedy: с вероятностью epsilon порядок выбирается случайно)
+	SelectionAdaptive SelectionMode = "adaptive"
+)
+
+const (
+	// defaultAdaptiveEpsilon - доля запросов, на которых исследуются не лучшие провайдеры
+	defaultAdaptiveEpsilon = 0.1
+	// adaptiveLatencyScale - задержка, при которой оценка провайдера снижается вдвое
+	adaptiveLatencyScale = 30 * time.Second
+)
+
+// ParseSelectionMode converts a configuration value into a SelectionMode.
+// An empty value selects SelectionStatic.
+func ParseSelectionMode(value string) (SelectionMode, error) {
+	switch mode := SelectionMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return SelectionStatic, nil
+	case SelectionStatic, SelectionAdaptive:
+		return mode, nil
+	default:
+		return SelectionStatic, fmt.Errorf("unknown provider selection mode: %q", value)
+	}
+}
+
+// ProviderScore is a snapshot of what the service has learned about a provider
+type ProviderScore struct {
+	Name         string  `json:"name"`
+	Calls        int     `json:"calls"`
+	SuccessRate  float64 `json:"success_rate"`
+	LatencyP50   float64 `json:"latency_p50_seconds"`
+	Score        float64 `json:"score"`
+	BreakerState string  `json:"breaker_state"`
+}
+
+// adaptiveSelector orders providers with an epsilon-greedy bandit over the
+// rolling statistics collected by the orchestration layer
+type adaptiveSelector struct {
+	stats     *providerStats
+	epsilon   float64
+	randFloat func() float64
+	shuffle   func(n int, swap func(i, j int))
+}
+
+// newAdaptiveSelector creates a selector on top of the given statistics
+func newAdaptiveSelector(stats *providerStats, epsilon float64) *adaptiveSelector {
+	if epsilon < 0 || epsilon > 1 {
+		epsilon = defaultAdaptiveEpsilon
+	}
+	return &adaptiveSelector{
+		stats:     stats,
+		epsilon:   epsilon,
+		randFloat: rand.Float64,
+		shuffle:   rand.Shuffle,
+	}
+}
+
+// score estimates the provider quality in the range (0..1].
+// Success rate is smoothed with a uniform prior, so a single failure does not
+// bury a provider; slow providers are penalized proportionally to their p50 latency.
+// Providers without data get the maximum score and are therefore tried first.
+func (a *adaptiveSelector) score(provider string) float64 {
+	summary := a.stats.summary(provider)
+	if summary.calls == 0 {
+		return 1
+	}
+
+	successRate := float64(summary.successes+1) / float64(summary.calls+2)
+	latencyFactor := 1.0
+	if len(summary.latencies) > 0 {
+		p50 := percentile(summary.latencies, 0.5)
+		latencyFactor = float64(adaptiveLatencyScale) / float64(adaptiveLatencyScale+p50)
+	}
+	return successRate * latencyFactor
+}
+
+// order returns providers sorted by score. With probability epsilon the order
+// is random instead, so that currently worse providers keep being re-evaluated.
+// The second value reports whether this was an exploration round.
+func (a *adaptiveSelector) order(providers []ImageProvider) ([]ImageProvider, bool) {
+	ordered := append([]ImageProvider(nil), providers...)
+	if len(ordered) < 2 {
+		return ordered, false
+	}
+
+	if a.randFloat() < a.epsilon {
+		a.shuffle(len(ordered), func(i, j int) { ordered[i], ordered[j] = ordered[j], ordered[i] })
+		return ordered, true
+	}
+	return a.rank(ordered), false
+}
+
+// rank returns providers sorted by score, best first
+func (a *adaptiveSelector) rank(providers []ImageProvider) []ImageProvider {
+	ranked := append([]ImageProvider(nil), providers...)
+	scores := make(map[string]float64, len(ranked))
+	for _, provider := range ranked {
+		scores[provider.Name] = a.score(provider.Name)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i].Name] > scores[ranked[j].Name]
+	})
+	return ranked
+}
+
+// snapshot returns the current statistics and score of a provider
+func (a *adaptiveSelector) snapshot(provider string) ProviderScore {
+	summary := a.stats.summary(provider)
+	result := ProviderScore{
+		Name:  provider,
+		Calls: summary.calls,
+		Score: a.score(provider),
+	}
+	if summary.calls > 0 {
+		result.SuccessRate = float64(summary.successes) / float64(summary.calls)
+	}
+	if len(summary.latencies) > 0 {
+		result.LatencyP50 = percentile(summary.latencies, 0.5).Seconds()
+	}
+	return result
+}
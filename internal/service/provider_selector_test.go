@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdaptiveSelector_RanksBySuccessAndLatency(t *testing.T) {
+	stats := newProviderStats(defaultStatsWindow)
+	for i := 0; i < 10; i++ {
+		stats.observe("fast", 3*time.Second, true)
+		stats.observe("slow", 90*time.Second, true)
+		stats.observe("flaky", 3*time.Second, i%2 == 0)
+	}
+
+	selector := newAdaptiveSelector(stats, 0)
+	ordered, exploring := selector.order([]ImageProvider{
+		{Name: "slow"}, {Name: "flaky"}, {Name: "new"}, {Name: "fast"},
+	})
+
+	assert.False(t, exploring)
+	// Провайдер без статистики пробуется первым, затем лучшие по оценке
+	assert.Equal(t, []string{"new", "fast", "flaky", "slow"}, providerNames(ordered))
+}
+
+func TestAdaptiveSelector_Explores(t *testing.T) {
+	selector := newAdaptiveSelector(newProviderStats(defaultStatsWindow), 0.2)
+	selector.randFloat = func() float64 { return 0.1 }
+	selector.shuffle = func(n int, swap func(i, j int)) { swap(0, n-1) }
+
+	ordered, exploring := selector.order([]ImageProvider{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+
+	assert.True(t, exploring)
+	assert.Equal(t, []string{"c", "b", "a"}, providerNames(ordered))
+}
+
+func TestAdaptiveSelector_Snapshot(t *testing.T) {
+	stats := newProviderStats(defaultStatsWindow)
+	stats.observe("a", time.Second, true)
+	stats.observe("a", 3*time.Second, true)
+	stats.observe("a", 2*time.Second, false)
+
+	score := newAdaptiveSelector(stats, 0).snapshot("a")
+
+	assert.Equal(t, 3, score.Calls)
+	assert.InDelta(t, 2.0/3.0, score.SuccessRate, 1e-9)
+	assert.Equal(t, 1.0, score.LatencyP50)
+	assert.Greater(t, score.Score, 0.0)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultStatsWindow - количество последних вызовов провайдера, по которым считается статистика
+	defaultStatsWindow = 50
+	// minLatencySamples - минимальное число успешных вызовов для расчета перцентилей
+	minLatencySamples = 5
+)
+
+// providerSample is the outcome of a single provider call
+type providerSample struct {
+	latency time.Duration
+	success bool
+}
+
+// providerStats keeps a rolling window of recent call outcomes for every provider.
+// It is used by the orchestration layer to derive hedging delays from observed latencies.
+type providerStats struct {
+	mu      sync.Mutex
+	window  int
+	samples map[string][]providerSample
+}
+
+// newProviderStats creates statistics storage with the given window size
+func newProviderStats(window int) *providerStats {
+	if window <= 0 {
+		window = defaultStatsWindow
+	}
+	return &providerStats{
+		window:  window,
+		samples: make(map[string][]providerSample),
+	}
+}
+
+// observe records the outcome of a provider call
+func (s *providerStats) observe(provider string, latency time.Duration, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	samples := append(s.samples[provider], providerSample{latency: latency, success: success})
+	if len(samples) > s.window {
+		samples = samples[len(samples)-s.window:]
+	}
+	s.samples[provider] = samples
+}
+
+// latencyPercentile returns the p-th percentile (0..1) of successful call latencies.
+// The second value is false when there is not enough data yet.
+func (s *providerStats) latencyPercentile(provider string, p float64) (time.Duration, bool) {
+	summary := s.summary(provider)
+	if len(summary.latencies) < minLatencySamples {
+		return 0, false
+	}
+	return percentile(summary.latencies, p), true
+}
+
+// statsSummary is an aggregated view of the window of a single provider
+type statsSummary struct {
+	calls     int
+	successes int
+	latencies []time.Duration // задержки успешных вызовов, по возрастанию
+}
+
+// summary aggregates the current window of the provider
+func (s *providerStats) summary(provider string) statsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result statsSummary
+	for _, sample := range s.samples[provider] {
+		result.calls++
+		if sample.success {
+			result.successes++
+			result.latencies = append(result.latencies, sample.latency)
+		}
+	}
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	return result
+}
+
+// percentile returns the p-th percentile (0..1) of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// flightCall is an in-flight call shared by every caller with the same key
+type flightCall[T any] struct {
+	done    chan struct{}
+	result  T
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+	// trackers получает прогресс общего вызова и передает его трекерам всех ожидающих
+	trackers *trackerFanout
+}
+
+// flightGroup collapses concurrent calls with the same key into one.
+// Unlike a plain single-flight, the shared call does not depend on the context
+// of the caller that started it: it keeps running while at least one caller is
+// still waiting and is cancelled when all of them have given up.
+type flightGroup[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+// newFlightGroup creates an empty group
+func newFlightGroup[T any]() *flightGroup[T] {
+	return &flightGroup[T]{calls: make(map[string]*flightCall[T])}
+}
+
+// Do runs fn once for all concurrent callers with the same key and returns its
+// result to each of them. The second value reports whether the caller joined
+// a call started by someone else. Operations started by the shared call are
+// reported to the generation trackers of all callers.
+func (g *flightGroup[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, bool, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		untrack := call.trackers.add(generationTracker(ctx))
+		g.mu.Unlock()
+		defer untrack()
+		return g.wait(ctx, key, call, true)
+	}
+
+	// Значения контекста первого вызывающего сохраняются, а отмена - нет.
+	// Трекер заменяется общим, чтобы операции запомнили все ожидающие задачи
+	trackers := newTrackerFanout()
+	callCtx, cancel := context.WithCancel(WithGenerationTracker(context.WithoutCancel(ctx), trackers))
+	call := &flightCall[T]{
+		done:     make(chan struct{}),
+		waiters:  1,
+		cancel:   cancel,
+		trackers: trackers,
+	}
+	untrack := trackers.add(generationTracker(ctx))
+	g.calls[key] = call
+	g.mu.Unlock()
+	defer untrack()
+
+	go func() {
+		defer cancel()
+		call.result, call.err = fn(callCtx)
+
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	return g.wait(ctx, key, call, false)
+}
+
+// wait blocks until the call finishes or the caller gives up
+func (g *flightGroup[T]) wait(ctx context.Context, key string, call *flightCall[T], shared bool) (T, bool, error) {
+	select {
+	case <-call.done:
+		return call.result, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// Результат больше никому не нужен
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+
+		var zero T
+		return zero, shared, ctx.Err()
+	}
+}
+
+// normalizePrompt builds a deduplication key: case and extra whitespace do not matter
+func normalizePrompt(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlightGroup_CollapsesConcurrentCalls(t *testing.T) {
+	group := newFlightGroup[string]()
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	const callers = 5
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int32
+	results := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, shared, err := group.Do(context.Background(), "key", func(ctx context.Context) (string, error) {
+				calls.Add(1)
+				<-release
+				return "result", nil
+			})
+			assert.NoError(t, err)
+			if shared {
+				sharedCount.Add(1)
+			}
+			results[i] = result
+		}()
+	}
+
+	// Ждем, пока все вызывающие присоединятся к первому вызову
+	assert.Eventually(t, func() bool {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+		call, ok := group.calls["key"]
+		return ok && call.waiters == callers
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(callers-1), sharedCount.Load())
+	for _, result := range results {
+		assert.Equal(t, "result", result)
+	}
+}
+
+func TestFlightGroup_CancelledWaiterDoesNotCancelOthers(t *testing.T) {
+	group := newFlightGroup[string]()
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, _, err := group.Do(firstCtx, "key", fn)
+		firstDone <- err
+	}()
+	assert.Eventually(t, func() bool {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+		_, ok := group.calls["key"]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	secondDone := make(chan string, 1)
+	go func() {
+		result, shared, err := group.Do(context.Background(), "key", fn)
+		assert.NoError(t, err)
+		assert.True(t, shared)
+		secondDone <- result
+	}()
+	assert.Eventually(t, func() bool {
+		group.mu.Lock()
+		defer group.mu.Unlock()
+		return group.calls["key"].waiters == 2
+	}, time.Second, time.Millisecond)
+
+	// Первый вызывающий сдается, но общий вызов продолжается ради второго
+	cancelFirst()
+	assert.ErrorIs(t, <-firstDone, context.Canceled)
+	close(release)
+	assert.Equal(t, "result", <-secondDone)
+}
+
+func TestFlightGroup_CancelsCallWhenEveryoneGivesUp(t *testing.T) {
+	group := newFlightGroup[string]()
+	cancelled := make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _, err := group.Do(ctx, "key", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("shared call was not cancelled")
+	}
+
+	// Следующий запрос с тем же ключом запускает новый вызов
+	result, shared, err := group.Do(context.Background(), "key", func(ctx context.Context) (string, error) {
+		return "fresh", nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, shared)
+	assert.Equal(t, "fresh", result)
+}
+
+func TestNormalizePrompt(t *testing.T) {
+	assert.Equal(t, "кот в шляпе", normalizePrompt("  Кот   в\tШляпе \n"))
+	assert.Equal(t, "", normalizePrompt("   "))
+}
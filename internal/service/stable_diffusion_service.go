@@ -0,0 +1,491 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/azalio/meme-bot/internal/otel/metrics"
+	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Бэкенды Stable Diffusion
+const (
+	// StableDiffusionAutomatic1111 - синхронный API AUTOMATIC1111 (/sdapi/v1/txt2img)
+	StableDiffusionAutomatic1111 = "automatic1111"
+	// StableDiffusionComfyUI - очередь ComfyUI (/prompt, /history, /view)
+	StableDiffusionComfyUI = "comfyui"
+)
+
+const (
+	// stableDiffusionDefaultTimeout - время на одну генерацию, включая очередь
+	stableDiffusionDefaultTimeout = 5 * time.Minute
+	// stableDiffusionMaxResponseBytes - ограничение размера ответа API
+	stableDiffusionMaxResponseBytes = 64 << 20
+)
+
+// comfyUIPollConfig configures history polling: a local GPU renders an image
+// in seconds, but the queue may be busy
+var comfyUIPollConfig = PollConfig{
+	InitialDelay: time.Second,
+	Interval:     time.Second,
+	MaxInterval:  5 * time.Second,
+	Multiplier:   1.5,
+	Jitter:       0.2,
+	Timeout:      stableDiffusionDefaultTimeout,
+}
+
+// comfyUIDefaultWorkflow is a minimal txt2img workflow in the ComfyUI API format.
+// String values equal to a placeholder ("$prompt", "$seed", ...) are replaced
+// with request parameters.
+const comfyUIDefaultWorkflow = `{
+  "3": {"class_type": "KSampler", "inputs": {
+    "seed": "$seed", "steps": "$steps", "cfg": "$cfg", "sampler_name": "$sampler",
+    "scheduler": "normal", "denoise": 1,
+    "model": ["4", 0], "positive": ["6", 0], "negative": ["7", 0], "latent_image": ["5", 0]}},
+  "4": {"class_type": "CheckpointLoaderSimple", "inputs": {"ckpt_name": "$checkpoint"}},
+  "5": {"class_type": "EmptyLatentImage", "inputs": {"width": "$width", "height": "$height", "batch_size": 1}},
+  "6": {"class_type": "CLIPTextEncode", "inputs": {"text": "$prompt", "clip": ["4", 1]}},
+  "7": {"class_type": "CLIPTextEncode", "inputs": {"text": "$negative_prompt", "clip": ["4", 1]}},
+  "8": {"class_type": "VAEDecode", "inputs": {"samples": ["3", 0], "vae": ["4", 2]}},
+  "9": {"class_type": "SaveImage", "inputs": {"filename_prefix": "meme-bot", "images": ["8", 0]}}
+}`
+
+// StableDiffusionConfig configures a self-hosted Stable Diffusion server
+type StableDiffusionConfig struct {
+	// BaseURL - адрес сервера, например http://localhost:7860
+	BaseURL string
+	// Backend - automatic1111 или comfyui
+	Backend string
+	// Sampler - имя сэмплера в терминах бэкенда ("Euler a" у AUTOMATIC1111, "euler_ancestral" у ComfyUI)
+	Sampler string
+	// Steps - число шагов
+	Steps int
+	// CFGScale - сила следования промпту
+	CFGScale float64
+	// NegativePrompt - то, чего не должно быть на изображении
+	NegativePrompt string
+	// Width и Height - размер изображения
+	Width  int
+	Height int
+	// Checkpoint - файл модели для встроенного workflow ComfyUI
+	Checkpoint string
+	// Workflow - путь к собственному workflow ComfyUI в API-формате
+	Workflow string
+	// Timeout - время на одну генерацию
+	Timeout time.Duration
+}
+
+// StableDiffusionServiceImpl implements image generation on a self-hosted
+// Stable Diffusion server through the AUTOMATIC1111 or ComfyUI API
+type StableDiffusionServiceImpl struct {
+	logger   *logger.Logger
+	cfg      StableDiffusionConfig
+	baseURL  string
+	workflow string
+	client   *http.Client
+	poller   *Poller
+}
+
+// NewStableDiffusionService creates a Stable Diffusion client.
+// It returns an error for an unknown backend or an unreadable workflow file.
+func NewStableDiffusionService(cfg StableDiffusionConfig, log *logger.Logger) (*StableDiffusionServiceImpl, error) {
+	cfg.Backend = strings.ToLower(strings.TrimSpace(cfg.Backend))
+	if cfg.Backend == "" {
+		cfg.Backend = StableDiffusionAutomatic1111
+	}
+	if cfg.Sampler == "" {
+		cfg.Sampler = "Euler a"
+		if cfg.Backend == StableDiffusionComfyUI {
+			cfg.Sampler = "euler_ancestral"
+		}
+	}
+	if cfg.Steps <= 0 {
+		cfg.Steps = 25
+	}
+	if cfg.CFGScale <= 0 {
+		cfg.CFGScale = 7
+	}
+	if cfg.Width <= 0 {
+		cfg.Width = 1024
+	}
+	if cfg.Height <= 0 {
+		cfg.Height = 1024
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = stableDiffusionDefaultTimeout
+	}
+
+	s := &StableDiffusionServiceImpl{
+		logger:   log,
+		cfg:      cfg,
+		baseURL:  strings.TrimRight(cfg.BaseURL, "/"),
+		workflow: comfyUIDefaultWorkflow,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}
+
+	switch cfg.Backend {
+	case StableDiffusionAutomatic1111:
+	case StableDiffusionComfyUI:
+		pollConfig := comfyUIPollConfig
+		pollConfig.Timeout = cfg.Timeout
+		s.poller = NewPoller(pollConfig)
+		// Запросы к /history короткие, таймаут клиента ограничивает только их
+		s.client.Timeout = 30 * time.Second
+
+		if cfg.Workflow != "" {
+			workflow, err := os.ReadFile(cfg.Workflow)
+			if err != nil {
+				return nil, fmt.Errorf("reading ComfyUI workflow: %w", err)
+			}
+			if !json.Valid(workflow) {
+				return nil, fmt.Errorf("ComfyUI workflow %s is not valid JSON", cfg.Workflow)
+			}
+			s.workflow = string(workflow)
+		} else if cfg.Checkpoint == "" {
+			return nil, fmt.Errorf("ComfyUI checkpoint is required for the built-in workflow")
+		}
+	default:
+		return nil, fmt.Errorf("unknown Stable Diffusion backend: %q", cfg.Backend)
+	}
+	return s, nil
+}
+
+// GenerateImage generates an image with the configured backend
+func (s *StableDiffusionServiceImpl) GenerateImage(ctx context.Context, prompt string) (*GenerationResult, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", ProviderStableDiffusion))
+	}()
+
+	s.logger.Info(ctx, "Starting Stable Diffusion image generation", map[string]interface{}{
+		"backend": s.cfg.Backend,
+		"sampler": s.cfg.Sampler,
+		"steps":   s.cfg.Steps,
+		"width":   s.cfg.Width,
+		"height":  s.cfg.Height,
+	})
+
+	if s.cfg.Backend == StableDiffusionComfyUI {
+		return s.generateComfyUI(ctx, prompt)
+	}
+	return s.generateAutomatic1111(ctx, prompt)
+}
+
+// ResumeImage waits for a ComfyUI prompt queued before a restart.
+// AUTOMATIC1111 generates synchronously and has nothing to resume.
+func (s *StableDiffusionServiceImpl) ResumeImage(ctx context.Context, promptID string) (*GenerationResult, error) {
+	if s.cfg.Backend != StableDiffusionComfyUI {
+		return nil, fmt.Errorf("%s backend cannot resume generations", s.cfg.Backend)
+	}
+
+	s.logger.Info(ctx, "Resuming ComfyUI generation", map[string]interface{}{
+		"prompt_id": promptID,
+	})
+	result, err := s.waitForComfyUIImage(ctx, promptID)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for image: %w", err)
+	}
+	result.Model = s.cfg.Checkpoint
+	return result, nil
+}
+
+// Automatic1111Request is the body of POST /sdapi/v1/txt2img
+type Automatic1111Request struct {
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	SamplerName    string  `json:"sampler_name"`
+	Steps          int     `json:"steps"`
+	CFGScale       float64 `json:"cfg_scale"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	Seed           int64   `json:"seed"`
+	BatchSize      int     `json:"batch_size"`
+}
+
+// Automatic1111Response is the response of /sdapi/v1/txt2img
+type Automatic1111Response struct {
+	Images []string `json:"images"`
+	// Info - JSON-строка с параметрами генерации
+	Info string `json:"info"`
+}
+
+// automatic1111Info holds the fields of Automatic1111Response.Info we use
+type automatic1111Info struct {
+	Seed        int64  `json:"seed"`
+	SDModelName string `json:"sd_model_name"`
+}
+
+// generateAutomatic1111 generates an image with a single synchronous txt2img request
+func (s *StableDiffusionServiceImpl) generateAutomatic1111(ctx context.Context, prompt string) (*GenerationResult, error) {
+	seed := requestSeed(ctx)
+	var response Automatic1111Response
+	err := s.doJSON(ctx, http.MethodPost, "/sdapi/v1/txt2img", Automatic1111Request{
+		Prompt:         prompt,
+		NegativePrompt: s.cfg.NegativePrompt,
+		SamplerName:    s.cfg.Sampler,
+		Steps:          s.cfg.Steps,
+		CFGScale:       s.cfg.CFGScale,
+		Width:          s.cfg.Width,
+		Height:         s.cfg.Height,
+		Seed:           seed,
+		BatchSize:      1,
+	}, &response)
+	if err != nil {
+		return nil, fmt.Errorf("txt2img request: %w", err)
+	}
+	if len(response.Images) == 0 {
+		return nil, fmt.Errorf("txt2img response contains no images")
+	}
+
+	imageData, err := base64.StdEncoding.DecodeString(response.Images[0])
+	if err != nil {
+		return nil, fmt.Errorf("decoding base64 image: %w", err)
+	}
+
+	result := &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Seed:     strconv.FormatInt(seed, 10),
+		Prompt:   prompt,
+		Attempts: 1,
+	}
+	// В info - фактический сид и модель, загруженная в AUTOMATIC1111
+	var info automatic1111Info
+	if err := json.Unmarshal([]byte(response.Info), &info); err == nil {
+		result.Model = info.SDModelName
+		if info.Seed > 0 {
+			result.Seed = strconv.FormatInt(info.Seed, 10)
+		}
+	}
+	return result, nil
+}
+
+// ComfyUIPromptRequest is the body of POST /prompt
+type ComfyUIPromptRequest struct {
+	Prompt   json.RawMessage `json:"prompt"`
+	ClientID string          `json:"client_id,omitempty"`
+}
+
+// ComfyUIPromptResponse is the response of POST /prompt
+type ComfyUIPromptResponse struct {
+	PromptID   string          `json:"prompt_id"`
+	Number     int             `json:"number"`
+	NodeErrors json.RawMessage `json:"node_errors,omitempty"`
+}
+
+// ComfyUIHistoryEntry is the history of a single prompt (GET /history/{prompt_id})
+type ComfyUIHistoryEntry struct {
+	Outputs map[string]struct {
+		Images []ComfyUIImage `json:"images"`
+	} `json:"outputs"`
+	Status struct {
+		StatusStr string `json:"status_str"`
+		Completed bool   `json:"completed"`
+	} `json:"status"`
+}
+
+// ComfyUIImage references an output image for GET /view
+type ComfyUIImage struct {
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"`
+}
+
+// generateComfyUI queues the workflow, waits for it in history and fetches the image
+func (s *StableDiffusionServiceImpl) generateComfyUI(ctx context.Context, prompt string) (*GenerationResult, error) {
+	seed := requestSeed(ctx)
+	workflow, err := s.buildWorkflow(prompt, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	var queued ComfyUIPromptResponse
+	if err := s.doJSON(ctx, http.MethodPost, "/prompt", ComfyUIPromptRequest{Prompt: workflow}, &queued); err != nil {
+		return nil, fmt.Errorf("queueing prompt: %w", err)
+	}
+	if queued.PromptID == "" {
+		return nil, fmt.Errorf("ComfyUI rejected the workflow: %s", string(queued.NodeErrors))
+	}
+
+	// Запоминаем prompt_id, чтобы после перезапуска дождаться результата
+	if err := trackOperation(ctx, queued.PromptID); err != nil {
+		s.logger.Warn(ctx, "Failed to track operation", map[string]interface{}{
+			"error":     err.Error(),
+			"prompt_id": queued.PromptID,
+		})
+	}
+
+	result, err := s.waitForComfyUIImage(ctx, queued.PromptID)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for image: %w", err)
+	}
+	result.Model = s.cfg.Checkpoint
+	result.Seed = strconv.FormatInt(seed, 10)
+	result.Prompt = prompt
+	result.Attempts++ // запрос на постановку в очередь
+	return result, nil
+}
+
+// buildWorkflow substitutes request parameters into the workflow placeholders
+func (s *StableDiffusionServiceImpl) buildWorkflow(prompt string, seed int64) (json.RawMessage, error) {
+	var workflow interface{}
+	if err := json.Unmarshal([]byte(s.workflow), &workflow); err != nil {
+		return nil, fmt.Errorf("decoding ComfyUI workflow: %w", err)
+	}
+
+	values := map[string]interface{}{
+		"$prompt":          prompt,
+		"$negative_prompt": s.cfg.NegativePrompt,
+		"$seed":            seed,
+		"$steps":           s.cfg.Steps,
+		"$cfg":             s.cfg.CFGScale,
+		"$sampler":         s.cfg.Sampler,
+		"$width":           s.cfg.Width,
+		"$height":          s.cfg.Height,
+		"$checkpoint":      s.cfg.Checkpoint,
+	}
+	data, err := json.Marshal(substitutePlaceholders(workflow, values))
+	if err != nil {
+		return nil, fmt.Errorf("encoding ComfyUI workflow: %w", err)
+	}
+	return data, nil
+}
+
+// substitutePlaceholders replaces string values that equal a placeholder, recursively
+func substitutePlaceholders(value interface{}, values map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = substitutePlaceholders(item, values)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = substitutePlaceholders(item, values)
+		}
+	case string:
+		if replacement, ok := values[v]; ok {
+			return replacement
+		}
+	}
+	return value
+}
+
+// waitForComfyUIImage polls the prompt history and downloads the first output image
+func (s *StableDiffusionServiceImpl) waitForComfyUIImage(ctx context.Context, promptID string) (*GenerationResult, error) {
+	image, attempts, err := Poll(ctx, s.poller, func(ctx context.Context, attempt int) (ComfyUIImage, PollOutcome, error) {
+		return s.checkHistory(ctx, promptID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("filename", image.Filename)
+	query.Set("subfolder", image.Subfolder)
+	query.Set("type", image.Type)
+	imageData, err := s.get(ctx, "/view?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("fetching image: %w", err)
+	}
+
+	return &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Attempts: attempts + 1, // опросы истории и скачивание
+	}, nil
+}
+
+// checkHistory performs one history check
+func (s *StableDiffusionServiceImpl) checkHistory(ctx context.Context, promptID string) (ComfyUIImage, PollOutcome, error) {
+	body, err := s.get(ctx, "/history/"+url.PathEscape(promptID))
+	if err != nil {
+		return ComfyUIImage{}, PollRetryable, err
+	}
+
+	// Пока prompt в очереди или выполняется, история пустая
+	var history map[string]ComfyUIHistoryEntry
+	if err := json.Unmarshal(body, &history); err != nil {
+		return ComfyUIImage{}, PollRetryable, fmt.Errorf("decoding history: %w", err)
+	}
+	entry, ok := history[promptID]
+	if !ok {
+		return ComfyUIImage{}, PollPending, nil
+	}
+
+	if entry.Status.StatusStr == "error" {
+		return ComfyUIImage{}, PollTerminal, fmt.Errorf("ComfyUI failed to execute prompt %s", promptID)
+	}
+	for _, output := range entry.Outputs {
+		for _, image := range output.Images {
+			if image.Type == "output" {
+				return image, PollDone, nil
+			}
+		}
+	}
+	if entry.Status.Completed {
+		return ComfyUIImage{}, PollTerminal, fmt.Errorf("prompt %s completed without output images", promptID)
+	}
+	return ComfyUIImage{}, PollPending, nil
+}
+
+// doJSON sends a JSON request and decodes the JSON response
+func (s *StableDiffusionServiceImpl) doJSON(ctx context.Context, method, path string, request, response interface{}) error {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("marshalling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bytes.NewReader(requestBody))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	body, err := s.send(req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// get performs a GET request and returns the response body
+func (s *StableDiffusionServiceImpl) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	return s.send(req)
+}
+
+// send executes the request and reads the body of a successful response
+func (s *StableDiffusionServiceImpl) send(req *http.Request) ([]byte, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, stableDiffusionMaxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, truncateText(string(body), 200))
+	}
+	return body, nil
+}
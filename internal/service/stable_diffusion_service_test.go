@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStableDiffusionService(t *testing.T, cfg StableDiffusionConfig, handler http.Handler) *StableDiffusionServiceImpl {
+	t.Helper()
+
+	server := newStubServer(t, handler)
+
+	cfg.BaseURL = server.URL + "/"
+	svc, err := NewStableDiffusionService(cfg, newQuietLogger())
+	assert.NoError(t, err)
+	if svc.poller != nil {
+		svc.poller = NewPoller(testPollConfig)
+	}
+	return svc
+}
+
+func TestStableDiffusionService_Automatic1111(t *testing.T) {
+	image := []byte("generated image")
+	svc := newTestStableDiffusionService(t, StableDiffusionConfig{
+		Sampler:        "DPM++ 2M",
+		Steps:          30,
+		CFGScale:       6.5,
+		NegativePrompt: "blurry",
+		Width:          768,
+		Height:         512,
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/sdapi/v1/txt2img", r.URL.Path)
+
+		var request Automatic1111Request
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "кот в шляпе", request.Prompt)
+		assert.Equal(t, "blurry", request.NegativePrompt)
+		assert.Equal(t, "DPM++ 2M", request.SamplerName)
+		assert.Equal(t, 30, request.Steps)
+		assert.Equal(t, 6.5, request.CFGScale)
+		assert.Equal(t, 768, request.Width)
+		assert.Equal(t, 512, request.Height)
+		assert.Equal(t, int64(123), request.Seed)
+		assert.Equal(t, 1, request.BatchSize)
+
+		json.NewEncoder(w).Encode(Automatic1111Response{
+			Images: []string{base64.StdEncoding.EncodeToString(image)},
+			Info:   `{"seed": 123, "sd_model_name": "sd_xl_base_1.0"}`,
+		})
+	}))
+
+	ctx := WithImageOptions(context.Background(), ImageOptions{Seed: "123"})
+	result, err := svc.GenerateImage(ctx, "кот в шляпе")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, "sd_xl_base_1.0", result.Model)
+	assert.Equal(t, "123", result.Seed)
+	assert.Equal(t, "кот в шляпе", result.Prompt)
+	assert.Equal(t, 1, result.Attempts)
+}
+
+func TestStableDiffusionService_Automatic1111Error(t *testing.T) {
+	svc := newTestStableDiffusionService(t, StableDiffusionConfig{},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error": "OutOfMemoryError"}`, http.StatusInternalServerError)
+		}))
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "unexpected status code 500")
+	assert.ErrorContains(t, err, "OutOfMemoryError")
+}
+
+// comfyUIHandler имитирует ComfyUI: история пустая, пока prompt не выполнится за pendingPolls опросов
+func comfyUIHandler(t *testing.T, image []byte, pendingPolls int32, check func(workflow map[string]interface{})) http.Handler {
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var request struct {
+			Prompt map[string]interface{} `json:"prompt"`
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		check(request.Prompt)
+		json.NewEncoder(w).Encode(ComfyUIPromptResponse{PromptID: "prompt-1", Number: 1})
+	})
+	mux.HandleFunc("/history/prompt-1", func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) <= pendingPolls {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"prompt-1": {
+			"outputs": {"9": {"images": [{"filename": "meme-bot_00001_.png", "subfolder": "", "type": "output"}]}},
+			"status": {"status_str": "success", "completed": true}}}`))
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "meme-bot_00001_.png", r.URL.Query().Get("filename"))
+		assert.Equal(t, "output", r.URL.Query().Get("type"))
+		w.Write(image)
+	})
+	return mux
+}
+
+func TestStableDiffusionService_ComfyUI(t *testing.T) {
+	image := []byte("generated image")
+	svc := newTestStableDiffusionService(t, StableDiffusionConfig{
+		Backend:        "ComfyUI",
+		Checkpoint:     "model.safetensors",
+		NegativePrompt: "text",
+		Steps:          20,
+		Width:          512,
+		Height:         768,
+	}, comfyUIHandler(t, image, 2, func(workflow map[string]interface{}) {
+		inputs := func(node string) map[string]interface{} {
+			return workflow[node].(map[string]interface{})["inputs"].(map[string]interface{})
+		}
+		assert.Equal(t, "кот в шляпе", inputs("6")["text"])
+		assert.Equal(t, "text", inputs("7")["text"])
+		assert.Equal(t, "model.safetensors", inputs("4")["ckpt_name"])
+		assert.Equal(t, float64(42), inputs("3")["seed"])
+		assert.Equal(t, float64(20), inputs("3")["steps"])
+		assert.Equal(t, "euler_ancestral", inputs("3")["sampler_name"])
+		assert.Equal(t, float64(512), inputs("5")["width"])
+		assert.Equal(t, float64(768), inputs("5")["height"])
+	}))
+
+	tracker := &recordingTracker{}
+	ctx := WithGenerationTracker(context.Background(), tracker)
+	ctx = withProviderName(ctx, ProviderStableDiffusion)
+	ctx = WithImageOptions(ctx, ImageOptions{Seed: "42"})
+	result, err := svc.GenerateImage(ctx, "кот в шляпе")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, "model.safetensors", result.Model)
+	assert.Equal(t, "42", result.Seed)
+	// Постановка в очередь, три опроса истории и скачивание
+	assert.Equal(t, 5, result.Attempts)
+	assert.Equal(t, map[string]string{ProviderStableDiffusion: "prompt-1"}, tracker.operations)
+
+	resumed, err := svc.ResumeImage(context.Background(), "prompt-1")
+	assert.NoError(t, err)
+	assert.Equal(t, image, resumed.Image)
+}
+
+func TestStableDiffusionService_ComfyUIExecutionError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"prompt_id": "prompt-1", "number": 1}`))
+	})
+	mux.HandleFunc("/history/prompt-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"prompt-1": {"outputs": {}, "status": {"status_str": "error", "completed": false}}}`))
+	})
+	svc := newTestStableDiffusionService(t, StableDiffusionConfig{Backend: StableDiffusionComfyUI, Checkpoint: "model"}, mux)
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.Nil(t, result)
+	assert.ErrorContains(t, err, "failed to execute prompt")
+}
+
+func TestStableDiffusionService_ComfyUICustomWorkflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workflow.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"1": {"class_type": "FluxSampler", "inputs": {"prompt": "$prompt", "noise_seed": "$seed", "fixed": "$unknown"}}
+	}`), 0o644))
+
+	svc := newTestStableDiffusionService(t, StableDiffusionConfig{Backend: StableDiffusionComfyUI, Workflow: path},
+		comfyUIHandler(t, []byte("image"), 0, func(workflow map[string]interface{}) {
+			inputs := workflow["1"].(map[string]interface{})["inputs"].(map[string]interface{})
+			assert.Equal(t, "prompt", inputs["prompt"])
+			assert.IsType(t, float64(0), inputs["noise_seed"])
+			assert.Equal(t, "$unknown", inputs["fixed"])
+		}))
+
+	result, err := svc.GenerateImage(context.Background(), "prompt")
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Seed)
+}
+
+func TestNewStableDiffusionService_InvalidConfig(t *testing.T) {
+	_, err := NewStableDiffusionService(StableDiffusionConfig{Backend: "invokeai"}, newQuietLogger())
+	assert.ErrorContains(t, err, "unknown Stable Diffusion backend")
+
+	_, err = NewStableDiffusionService(StableDiffusionConfig{Backend: StableDiffusionComfyUI}, newQuietLogger())
+	assert.ErrorContains(t, err, "checkpoint is required")
+
+	_, err = NewStableDiffusionService(StableDiffusionConfig{
+		Backend:  StableDiffusionComfyUI,
+		Workflow: filepath.Join(t.TempDir(), "missing.json"),
+	}, newQuietLogger())
+	assert.ErrorContains(t, err, "reading ComfyUI workflow")
+}
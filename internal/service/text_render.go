@@ -0,0 +1,227 @@
+package service
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// memeFontTTF is the font for meme text: Go Bold covers Latin and Cyrillic
+//
+//go:embed assets/fonts/Go-Bold.ttf
+var memeFontTTF []byte
+
+// memeFont parses the embedded font once
+var memeFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(memeFontTTF)
+})
+
+const (
+	// textLineSpacing - межстрочный интервал в долях размера шрифта
+	textLineSpacing = 1.15
+	// textMinFontSize - минимальный размер шрифта при подгонке текста
+	textMinFontSize = 12
+)
+
+// TextAlign is the vertical position of text inside its box
+type TextAlign string
+
+const (
+	// TextAlignTop - текст прижат к верхнему краю
+	TextAlignTop TextAlign = "top"
+	// TextAlignMiddle - текст по центру
+	TextAlignMiddle TextAlign = "middle"
+	// TextAlignBottom - текст прижат к нижнему краю
+	TextAlignBottom TextAlign = "bottom"
+)
+
+// TextStyle describes how text is drawn into a box
+type TextStyle struct {
+	// Color - цвет букв
+	Color color.Color
+	// Outline - цвет обводки; nil - без обводки
+	Outline color.Color
+	// Align - вертикальное выравнивание, по умолчанию по центру
+	Align TextAlign
+	// MaxFontSize - размер шрифта, с которого начинается подгонка текста под рамку
+	MaxFontSize float64
+	// Uppercase - писать заглавными буквами
+	Uppercase bool
+	// Visible - сколько первых символов текста показать, 0 - весь текст.
+	// Раскладка строк не зависит от Visible, поэтому текст не прыгает при «печати»
+	Visible int
+}
+
+// DrawText wraps text to the box width and draws it centered horizontally,
+// shrinking the font until all lines fit into the box. When the text does
+// not fit even at the minimal size, the overflowing lines are dropped.
+func DrawText(dst draw.Image, box image.Rectangle, text string, style TextStyle) error {
+	text = strings.Join(strings.Fields(text), " ")
+	if style.Uppercase {
+		text = strings.ToUpper(text)
+	}
+	if text == "" || box.Empty() {
+		return nil
+	}
+
+	face, lines, err := fitText(text, box, style.MaxFontSize)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	lineHeight := textLineHeight(face)
+	textHeight := textBlockHeight(face, len(lines))
+
+	// Базовая линия первой строки
+	y := fixed.I(box.Min.Y) + metrics.Ascent
+	switch style.Align {
+	case TextAlignTop:
+	case TextAlignBottom:
+		y += fixed.I(box.Dy()) - textHeight
+	default:
+		y += (fixed.I(box.Dy()) - textHeight) / 2
+	}
+
+	textColor := style.Color
+	if textColor == nil {
+		textColor = color.Black
+	}
+	drawer := &font.Drawer{Dst: dst, Face: face}
+	outline := outlineOffsets(face)
+	remaining := style.Visible
+	for _, line := range lines {
+		x := fixed.I(box.Min.X) + (fixed.I(box.Dx())-drawer.MeasureString(line))/2
+		if style.Visible > 0 {
+			if remaining <= 0 {
+				break
+			}
+			runes := []rune(line)
+			line = string(runes[:min(len(runes), remaining)])
+			remaining -= len(runes)
+		}
+		if style.Outline != nil {
+			drawer.Src = image.NewUniform(style.Outline)
+			for _, offset := range outline {
+				drawer.Dot = fixed.Point26_6{X: x + offset.X, Y: y + offset.Y}
+				drawer.DrawString(line)
+			}
+		}
+		drawer.Src = image.NewUniform(textColor)
+		drawer.Dot = fixed.Point26_6{X: x, Y: y}
+		drawer.DrawString(line)
+		y += lineHeight
+	}
+	return nil
+}
+
+// fitText picks the largest font size not above maxSize at which the wrapped
+// text fits into the box
+func fitText(text string, box image.Rectangle, maxSize float64) (font.Face, []string, error) {
+	if maxSize <= 0 {
+		maxSize = float64(box.Dy())
+	}
+	maxSize = max(maxSize, textMinFontSize)
+
+	for size := maxSize; ; size *= 0.9 {
+		size = max(size, textMinFontSize)
+		face, err := newFontFace(size)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines := wrapText(face, text, box.Dx())
+		fits := textBlockHeight(face, len(lines)) <= fixed.I(box.Dy())
+		if fits && widestLine(face, lines) <= fixed.I(box.Dx()) {
+			return face, lines, nil
+		}
+		if size == textMinFontSize {
+			// Даже минимальный шрифт не помещается: оставляем строки, которые влезают по высоте
+			visible := len(lines)
+			for visible > 1 && textBlockHeight(face, visible) > fixed.I(box.Dy()) {
+				visible--
+			}
+			return face, lines[:visible], nil
+		}
+		face.Close()
+	}
+}
+
+// newFontFace creates a face of the embedded font of the given size in pixels
+func newFontFace(size float64) (font.Face, error) {
+	f, err := memeFont()
+	if err != nil {
+		return nil, fmt.Errorf("parsing font: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("creating font face: %w", err)
+	}
+	return face, nil
+}
+
+// wrapText splits text into lines not wider than maxWidth. A word wider than
+// maxWidth takes a line of its own; fitText then shrinks the font.
+func wrapText(face font.Face, text string, maxWidth int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && font.MeasureString(face, candidate) > fixed.I(maxWidth) {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// textLineHeight returns the distance between baselines of adjacent lines
+func textLineHeight(face font.Face) fixed.Int26_6 {
+	return fixed.Int26_6(float64(face.Metrics().Height) * textLineSpacing)
+}
+
+// textBlockHeight returns the height of n lines from the top of the first
+// line to the bottom of the last one
+func textBlockHeight(face font.Face, n int) fixed.Int26_6 {
+	metrics := face.Metrics()
+	return textLineHeight(face)*fixed.Int26_6(n-1) + metrics.Ascent + metrics.Descent
+}
+
+// widestLine returns the width of the widest line
+func widestLine(face font.Face, lines []string) fixed.Int26_6 {
+	var widest fixed.Int26_6
+	for _, line := range lines {
+		widest = max(widest, font.MeasureString(face, line))
+	}
+	return widest
+}
+
+// outlineOffsets returns offsets at which the outline color is drawn under
+// the text: a ring whose thickness grows with the font size
+func outlineOffsets(face font.Face) []fixed.Point26_6 {
+	radius := max(1, face.Metrics().Height.Round()/14)
+	var offsets []fixed.Point26_6
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy <= radius*radius {
+				offsets = append(offsets, fixed.Point26_6{X: fixed.I(dx), Y: fixed.I(dy)})
+			}
+		}
+	}
+	return offsets
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// promptPartSeparator separates the parts of a weighted prompt
+	promptPartSeparator = "|"
+	// promptWeightSeparator separates a part from its weight
+	promptWeightSeparator = "::"
+	// maxPromptWeight - максимальный вес части промпта
+	maxPromptWeight = 100
+)
+
+// PromptPart is a part of a weighted prompt
+type PromptPart struct {
+	// Text - текст части промпта
+	Text string
+	// Weight - вес части, по умолчанию 1
+	Weight float64
+}
+
+// ParseWeightedPrompt parses the weighted prompt syntax:
+//
+//	cat in space::2 | vaporwave::0.5
+//
+// Parts are separated by "|", a weight follows "::" and defaults to 1.
+// The prompt counts as weighted only when at least one part has an explicit
+// weight and every weight is a positive number; otherwise ok is false and the
+// prompt should be used as is.
+func ParseWeightedPrompt(prompt string) (parts []PromptPart, ok bool) {
+	if !strings.Contains(prompt, promptWeightSeparator) {
+		return nil, false
+	}
+
+	weighted := false
+	for _, segment := range strings.Split(prompt, promptPartSeparator) {
+		text, weight := strings.TrimSpace(segment), 1.0
+		if i := strings.LastIndex(text, promptWeightSeparator); i >= 0 {
+			value, err := strconv.ParseFloat(strings.TrimSpace(text[i+len(promptWeightSeparator):]), 64)
+			if err != nil || !(value > 0 && value <= maxPromptWeight) {
+				return nil, false
+			}
+			text, weight, weighted = strings.TrimSpace(text[:i]), value, true
+		}
+		if text == "" {
+			continue
+		}
+		parts = append(parts, PromptPart{Text: text, Weight: weight})
+	}
+	if !weighted || len(parts) == 0 {
+		return nil, false
+	}
+	return parts, true
+}
+
+// PlainPrompt merges a weighted prompt into plain text for providers without
+// weight support. Heavier parts go first, since models pay more attention to
+// the beginning of the prompt. Prompts without weights are returned unchanged.
+func PlainPrompt(prompt string) string {
+	parts, ok := ParseWeightedPrompt(prompt)
+	if !ok {
+		return prompt
+	}
+
+	slices.SortStableFunc(parts, func(a, b PromptPart) int {
+		return cmp.Compare(b.Weight, a.Weight)
+	})
+	texts := make([]string, len(parts))
+	for i, part := range parts {
+		texts[i] = part.Text
+	}
+	return strings.Join(texts, ", ")
+}
+
+// formatWeightedPrompt renders parts back into the weighted prompt syntax
+func formatWeightedPrompt(parts []PromptPart) string {
+	formatted := make([]string, len(parts))
+	for i, part := range parts {
+		formatted[i] = part.Text + promptWeightSeparator + strconv.FormatFloat(part.Weight, 'f', -1, 64)
+	}
+	return strings.Join(formatted, " "+promptPartSeparator+" ")
+}
+
+// generateWithPrompt sends a weighted prompt to generators that support weights
+// and its plain version to the rest
+func generateWithPrompt(ctx context.Context, generator ImageGenerator, promptText string) (*GenerationResult, error) {
+	parts, ok := ParseWeightedPrompt(promptText)
+	if !ok {
+		return generator.GenerateImage(ctx, promptText)
+	}
+	if weighted, ok := generator.(WeightedPromptGenerator); ok {
+		return weighted.GenerateWeightedImage(ctx, parts)
+	}
+	return generator.GenerateImage(ctx, PlainPrompt(promptText))
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWeightedPrompt(t *testing.T) {
+	tests := []struct {
+		prompt string
+		parts  []PromptPart
+		ok     bool
+	}{
+		{"cat in space::2 | vaporwave::0.5", []PromptPart{{Text: "cat in space", Weight: 2}, {Text: "vaporwave", Weight: 0.5}}, true},
+		{"кот | космос::3 | ", []PromptPart{{Text: "кот", Weight: 1}, {Text: "космос", Weight: 3}}, true},
+		{"кот в космосе", nil, false},
+		{"кот | космос", nil, false},
+		{"C++::Java", nil, false},
+		{"кот::0 | космос", nil, false},
+		{"кот::-1", nil, false},
+		{"::2", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			parts, ok := ParseWeightedPrompt(tt.prompt)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.parts, parts)
+		})
+	}
+}
+
+func TestPlainPrompt(t *testing.T) {
+	assert.Equal(t, "cat in space, vaporwave", PlainPrompt("vaporwave::0.5 | cat in space::2"))
+	assert.Equal(t, "кот | космос", PlainPrompt("кот | космос"))
+}
+
+// promptRecorder запоминает промпты, которые получил провайдер
+type promptRecorder struct {
+	mu      sync.Mutex
+	prompts []string
+	parts   [][]PromptPart
+}
+
+func (r *promptRecorder) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prompts = append(r.prompts, promptText)
+	return &GenerationResult{Image: []byte("image")}, nil
+}
+
+// weightedRecorder дополнительно поддерживает промпты с весами
+type weightedRecorder struct {
+	promptRecorder
+}
+
+func (r *weightedRecorder) GenerateWeightedImage(ctx context.Context, parts []PromptPart) (*GenerationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parts = append(r.parts, parts)
+	return &GenerationResult{Image: []byte("image")}, nil
+}
+
+func TestImageGenerationService_WeightedPrompt(t *testing.T) {
+	plain := &promptRecorder{}
+	weighted := &weightedRecorder{}
+	registry := NewProviderRegistry()
+	assert.NoError(t, registry.Register("plain", plain))
+	assert.NoError(t, registry.Register("weighted", weighted))
+	svc := NewImageGenerationServiceWithRegistry(newQuietLogger(), registry,
+		WithStrategy(StrategySequential))
+
+	for _, provider := range []string{"plain", "weighted"} {
+		ctx := WithImageOptions(context.Background(), ImageOptions{Provider: provider})
+		_, err := svc.GenerateImage(ctx, "vaporwave::0.5 | cat in space::2")
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"cat in space, vaporwave"}, plain.prompts)
+	assert.Empty(t, weighted.prompts)
+	assert.Equal(t, [][]PromptPart{{{Text: "vaporwave", Weight: 0.5}, {Text: "cat in space", Weight: 2}}}, weighted.parts)
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/azalio/meme-bot/internal/config"
@@ -19,14 +20,30 @@ import (
 const (
 	imageGenerationURL = "https://llm.api.cloud.yandex.net/foundationModels/v1/imageGenerationAsync"
 	operationURLBase   = "https://llm.api.cloud.yandex.net:443/operations/"
+	yandexArtModel     = "yandex-art/latest"
 )
 
+// yandexArtPollConfig задает опрос операций Yandex Art: генерация обычно занимает
+// 10-30 секунд, поэтому первая проверка - через 5 секунд
+var yandexArtPollConfig = PollConfig{
+	InitialDelay: 5 * time.Second,
+	Interval:     2 * time.Second,
+	MaxInterval:  10 * time.Second,
+	Multiplier:   1.5,
+	Jitter:       0.2,
+	Timeout:      5 * time.Minute,
+}
+
 // YandexArtServiceImpl реализует интерфейс YandexArtService
 type YandexArtServiceImpl struct {
 	config         *config.Config
 	logger         *logger.Logger
 	authService    YandexAuthService
 	promptEnhancer *PromptEnhancer
+	client         *http.Client
+	poller         *Poller
+	generationURL  string
+	operationURL   string
 }
 
 // NewYandexArtService создает новый экземпляр сервиса генерации изображений
@@ -34,7 +51,7 @@ func NewYandexArtService(
 	cfg *config.Config,
 	log *logger.Logger,
 	auth YandexAuthService,
-	gpt YandexGPTService,
+	gpt GPTService,
 ) *YandexArtServiceImpl {
 	promptEnhancer := NewPromptEnhancer(log, gpt)
 	return &YandexArtServiceImpl{
@@ -42,13 +59,36 @@ func NewYandexArtService(
 		logger:         log,
 		authService:    auth,
 		promptEnhancer: promptEnhancer,
+		client:         &http.Client{Timeout: 30 * time.Second},
+		poller:         NewPoller(yandexArtPollConfig),
+		generationURL:  imageGenerationURL,
+		operationURL:   operationURLBase,
 	}
 }
 
 // GenerateImage генерирует изображение по промпту
-func (s *YandexArtServiceImpl) GenerateImage(ctx context.Context, promptText string) ([]byte, error) {
+func (s *YandexArtServiceImpl) GenerateImage(ctx context.Context, promptText string) (*GenerationResult, error) {
+	return s.generate(ctx, promptText, []Message{{Weight: "1", Text: promptText}})
+}
+
+// GenerateWeightedImage генерирует изображение по частям промпта с весами:
+// Yandex Art принимает их как отдельные сообщения
+func (s *YandexArtServiceImpl) GenerateWeightedImage(ctx context.Context, parts []PromptPart) (*GenerationResult, error) {
+	messages := make([]Message, len(parts))
+	for i, part := range parts {
+		messages[i] = Message{
+			Weight: strconv.FormatFloat(part.Weight, 'f', -1, 64),
+			Text:   part.Text,
+		}
+	}
+	return s.generate(ctx, formatWeightedPrompt(parts), messages)
+}
+
+// generate запускает генерацию по сообщениям и дожидается изображения
+func (s *YandexArtServiceImpl) generate(ctx context.Context, promptText string, messages []Message) (*GenerationResult, error) {
 	s.logger.Info(ctx, "Starting Yandex Art image generation", map[string]interface{}{
 		"prompt_length": len(promptText),
+		"messages":      len(messages),
 	})
 	// Получаем IAM токен
 	s.logger.Debug(ctx, "Requesting IAM token", nil)
@@ -60,8 +100,9 @@ func (s *YandexArtServiceImpl) GenerateImage(ctx context.Context, promptText str
 		return nil, fmt.Errorf("getting IAM token: %w", err)
 	}
 
-	// Создаем запрос на генерацию
-	operationID, err := s.startImageGeneration(ctx, promptText, iamToken)
+	// Создаем запрос на генерацию: сид случайный, если пользователь не задал его явно
+	seed := strconv.FormatInt(requestSeed(ctx), 10)
+	operationID, err := s.startImageGeneration(ctx, messages, seed, imageOptions(ctx).AspectRatio, iamToken)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to start image generation", map[string]interface{}{
 			"error":           err.Error(),
@@ -75,8 +116,16 @@ func (s *YandexArtServiceImpl) GenerateImage(ctx context.Context, promptText str
 		"prompt":       promptText,
 	})
 
+	// Запоминаем операцию, чтобы после перезапуска бота дождаться ее, а не начинать заново
+	if err := trackOperation(ctx, operationID); err != nil {
+		s.logger.Warn(ctx, "Failed to track operation", map[string]interface{}{
+			"error":        err.Error(),
+			"operation_id": operationID,
+		})
+	}
+
 	// Ожидаем завершения и получаем результат
-	imageData, err := s.waitForImageAndGet(ctx, operationID, iamToken)
+	imageData, polls, err := s.waitForImageAndGet(ctx, operationID, iamToken)
 	if err != nil {
 		s.logger.Error(ctx, "Failed to get generated image", map[string]interface{}{
 			"error":        err.Error(),
@@ -88,26 +137,62 @@ func (s *YandexArtServiceImpl) GenerateImage(ctx context.Context, promptText str
 	s.logger.Info(ctx, "Successfully generated image", map[string]interface{}{
 		"operation_id": operationID,
 		"image_size":   len(imageData),
+		"seed":         seed,
+	})
+
+	return &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Model:    yandexArtModel,
+		Seed:     seed,
+		Prompt:   promptText,
+		Attempts: 1 + polls,
+	}, nil
+}
+
+// ResumeImage дожидается результата ранее запущенной операции генерации.
+// Сид операции API не возвращает, поэтому он остается пустым.
+func (s *YandexArtServiceImpl) ResumeImage(ctx context.Context, operationID string) (*GenerationResult, error) {
+	s.logger.Info(ctx, "Resuming Yandex Art operation", map[string]interface{}{
+		"operation_id": operationID,
 	})
+	iamToken, err := s.authService.GetIAMToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting IAM token: %w", err)
+	}
 
-	return imageData, nil
+	imageData, polls, err := s.waitForImageAndGet(ctx, operationID, iamToken)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for image: %w", err)
+	}
+
+	return &GenerationResult{
+		Image:    imageData,
+		MIMEType: detectMIMEType(imageData),
+		Model:    yandexArtModel,
+		Attempts: polls,
+	}, nil
 }
 
 // startImageGeneration инициирует асинхронный процесс генерации изображения в Yandex Art API
 // Параметры:
 // - ctx: контекст для отмены операции
-// - prompt: текстовое описание желаемого изображения
+// - messages: текстовое описание желаемого изображения, возможно из нескольких частей с весами
+// - seed: сид генерации
+// - aspectRatio: соотношение сторон вида "16:9" (пусто - 1:1)
 // - iamToken: токен для аутентификации в API
 // Возвращает:
 // - string: ID операции для отслеживания прогресса
 // - error: ошибку в случае проблем с запуском генерации
-func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, prompt string, iamToken string) (string, error) {
+func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, messages []Message, seed, aspectRatio, iamToken string) (string, error) {
 	startTime := time.Now()
 	defer func() {
 		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(), attribute.String("service", "yandex_art"))
 	}()
 	s.logger.Info(ctx, "Initiating image generation request", map[string]interface{}{
-		"prompt_length": len(prompt),
+		"messages":     len(messages),
+		"seed":         seed,
+		"aspect_ratio": aspectRatio,
 	})
 
 	folderID := os.Getenv("YANDEX_ART_FOLDER_ID")
@@ -118,21 +203,17 @@ func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, prompt
 		return "", fmt.Errorf("YANDEX_ART_FOLDER_ID not set")
 	}
 
+	widthRatio, heightRatio := aspectRatioParts(aspectRatio)
 	request := YandexARTRequest{
-		ModelUri: fmt.Sprintf("art://%s/yandex-art/latest", folderID),
+		ModelUri: fmt.Sprintf("art://%s/%s", folderID, yandexArtModel),
 		GenerationOptions: GenerationOptions{
-			Seed: "1863",
+			Seed: seed,
 			AspectRatio: AspectRatio{
-				WidthRatio:  "1",
-				HeightRatio: "1",
-			},
-		},
-		Messages: []Message{
-			{
-				Weight: "1",
-				Text:   prompt,
+				WidthRatio:  widthRatio,
+				HeightRatio: heightRatio,
 			},
 		},
+		Messages: messages,
 	}
 
 	requestBody, err := json.Marshal(request)
@@ -143,11 +224,11 @@ func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, prompt
 		return "", fmt.Errorf("marshalling request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", imageGenerationURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.generationURL, bytes.NewBuffer(requestBody))
 	if err != nil {
 		s.logger.Error(ctx, "Failed to create HTTP request", map[string]interface{}{
 			"error": err.Error(),
-			"url":   imageGenerationURL,
+			"url":   s.generationURL,
 		})
 		return "", fmt.Errorf("creating request: %w", err)
 	}
@@ -155,12 +236,11 @@ func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, prompt
 	req.Header.Set("Authorization", "Bearer "+iamToken)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		s.logger.Error(ctx, "HTTP request failed", map[string]interface{}{
 			"error": err.Error(),
-			"url":   imageGenerationURL,
+			"url":   s.generationURL,
 		})
 		return "", fmt.Errorf("making request: %w", err)
 	}
@@ -202,122 +282,104 @@ func (s *YandexArtServiceImpl) startImageGeneration(ctx context.Context, prompt
 	return operation.ID, nil
 }
 
-// waitForImageAndGet выполняет поллинг статуса операции генерации изображения
-// и возвращает результат после завершения
+// waitForImageAndGet дожидается завершения операции генерации изображения
+// и возвращает результат
 // Параметры:
 // - ctx: контекст для отмены операции
 // - operationID: идентификатор операции генерации
 // - iamToken: токен для аутентификации в API
 // Возвращает:
-// - []byte: сгенерированное изображение в формате PNG
+// - []byte: сгенерированное изображение
+// - int: количество выполненных запросов статуса
 // - error: ошибку в случае проблем с получением результата
-// Метод будет повторять запросы каждые 5 секунд в течение 5 минут
-func (s *YandexArtServiceImpl) waitForImageAndGet(ctx context.Context, operationID string, iamToken string) ([]byte, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	maxAttempts := 60 // 5 minutes with 5-second intervals
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
+// Статус опрашивается с экспоненциальной задержкой (см. yandexArtPollConfig)
+func (s *YandexArtServiceImpl) waitForImageAndGet(ctx context.Context, operationID string, iamToken string) ([]byte, int, error) {
 	s.logger.Info(ctx, "Starting to wait for image generation", map[string]interface{}{
 		"operation_id": operationID,
-		"max_attempts": maxAttempts,
-		"interval":     "5s",
 	})
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		select {
-		case <-ctx.Done():
-			s.logger.Error(ctx, "Operation cancelled", map[string]interface{}{
-				"error":        ctx.Err().Error(),
-				"operation_id": operationID,
-				"attempt":      attempt + 1,
-			})
-			return nil, fmt.Errorf("operation cancelled: %w", ctx.Err())
-		case <-ticker.C:
-			s.logger.Debug(ctx, "Checking operation status", map[string]interface{}{
-				"attempt":      attempt + 1,
-				"max_attempts": maxAttempts,
-				"operation_id": operationID,
-			})
+	imageData, polls, err := Poll(ctx, s.poller, func(ctx context.Context, attempt int) ([]byte, PollOutcome, error) {
+		return s.checkOperation(ctx, operationID, iamToken, attempt)
+	})
+	if err != nil {
+		s.logger.Error(ctx, "Failed to wait for generation operation", map[string]interface{}{
+			"error":        err.Error(),
+			"operation_id": operationID,
+			"attempts":     polls,
+		})
+		return nil, polls, err
+	}
 
-			req, err := http.NewRequestWithContext(ctx, "GET", operationURLBase+operationID, nil)
-			if err != nil {
-				s.logger.Error(ctx, "Failed to create status request", map[string]interface{}{
-					"error":        err.Error(),
-					"operation_id": operationID,
-					"url":          operationURLBase + operationID,
-				})
-				return nil, fmt.Errorf("creating status request: %w", err)
-			}
-
-			req.Header.Set("Authorization", "Bearer "+iamToken)
-
-			resp, err := client.Do(req)
-			if err != nil {
-				s.logger.Error(ctx, "Status request failed", map[string]interface{}{
-					"error":        err.Error(),
-					"operation_id": operationID,
-					"attempt":      attempt + 1,
-				})
-				if ctx.Err() != nil {
-					return nil, fmt.Errorf("operation cancelled during request: %w", ctx.Err())
-				}
-				continue
-			}
-			defer resp.Body.Close()
-
-			var operation YandexARTOperation
-			err = json.NewDecoder(resp.Body).Decode(&operation)
-			if err != nil {
-				s.logger.Error(ctx, "Failed to decode operation status", map[string]interface{}{
-					"error":        err.Error(),
-					"operation_id": operationID,
-					"attempt":      attempt + 1,
-				})
-				if ctx.Err() != nil {
-					return nil, fmt.Errorf("operation cancelled during response reading: %w", ctx.Err())
-				}
-				continue
-			}
-
-			s.logger.Debug(ctx, "Received operation status", map[string]interface{}{
-				"operation_id": operationID,
-				"done":         operation.Done,
-				"attempt":      attempt + 1,
-			})
-			if operation.Done {
-				if operation.Response.Image == "" {
-					s.logger.Error(ctx, "Operation completed without image data", map[string]interface{}{
-						"operation_id": operationID,
-					})
-					return nil, fmt.Errorf("operation completed but no image data received")
-				}
-
-				imageData, err := base64.StdEncoding.DecodeString(operation.Response.Image)
-				if err != nil {
-					s.logger.Error(ctx, "Failed to decode image data", map[string]interface{}{
-						"error":        err.Error(),
-						"operation_id": operationID,
-					})
-					return nil, fmt.Errorf("decoding base64 image: %w", err)
-				}
-
-				s.logger.Info(ctx, "Successfully retrieved generated image", map[string]interface{}{
-					"operation_id": operationID,
-					"image_size":   len(imageData),
-					"attempts":     attempt + 1,
-				})
-				return imageData, nil
-			}
+	s.logger.Info(ctx, "Successfully retrieved generated image", map[string]interface{}{
+		"operation_id": operationID,
+		"image_size":   len(imageData),
+		"attempts":     polls,
+	})
+	return imageData, polls, nil
+}
+
+// checkOperation выполняет один запрос статуса операции
+func (s *YandexArtServiceImpl) checkOperation(ctx context.Context, operationID, iamToken string, attempt int) ([]byte, PollOutcome, error) {
+	s.logger.Debug(ctx, "Checking operation status", map[string]interface{}{
+		"attempt":      attempt,
+		"operation_id": operationID,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.operationURL+operationID, nil)
+	if err != nil {
+		return nil, PollTerminal, fmt.Errorf("creating status request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+iamToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.logger.Warn(ctx, "Status request failed", map[string]interface{}{
+			"error":        err.Error(),
+			"operation_id": operationID,
+			"attempt":      attempt,
+		})
+		return nil, PollRetryable, fmt.Errorf("status request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			return nil, PollRetryable, err
 		}
+		return nil, PollTerminal, err
 	}
 
-	s.logger.Error(ctx, "Generation operation timed out", map[string]interface{}{
+	var operation YandexARTOperation
+	if err := json.NewDecoder(resp.Body).Decode(&operation); err != nil {
+		s.logger.Warn(ctx, "Failed to decode operation status", map[string]interface{}{
+			"error":        err.Error(),
+			"operation_id": operationID,
+			"attempt":      attempt,
+		})
+		return nil, PollRetryable, fmt.Errorf("decoding operation status: %w", err)
+	}
+
+	s.logger.Debug(ctx, "Received operation status", map[string]interface{}{
 		"operation_id": operationID,
-		"max_attempts": maxAttempts,
-		"total_time":   fmt.Sprintf("%ds", maxAttempts*5),
+		"done":         operation.Done,
+		"attempt":      attempt,
 	})
-	return nil, fmt.Errorf("operation timed out after %d attempts", maxAttempts)
+	if !operation.Done {
+		return nil, PollPending, nil
+	}
+	if operation.Error != nil {
+		return nil, PollTerminal, fmt.Errorf("generation failed: %s (code %d)", operation.Error.Message, operation.Error.Code)
+	}
+	if operation.Response.Image == "" {
+		return nil, PollTerminal, fmt.Errorf("operation completed but no image data received")
+	}
+
+	imageData, err := base64.StdEncoding.DecodeString(operation.Response.Image)
+	if err != nil {
+		return nil, PollTerminal, fmt.Errorf("decoding base64 image: %w", err)
+	}
+	return imageData, PollDone, nil
 }
 
 // YandexARTRequest представляет структуру запроса к API генерации изображений
@@ -354,4 +416,8 @@ type YandexARTOperation struct {
 	Response    struct {
 		Image string `json:"image"`
 	} `json:"response,omitempty"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
 }
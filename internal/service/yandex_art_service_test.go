@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/azalio/meme-bot/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingTracker запоминает операции, о которых сообщили провайдеры
+type recordingTracker struct {
+	mu         sync.Mutex
+	operations map[string]string
+}
+
+func (r *recordingTracker) PromptEnhanced(prompt, caption string) error { return nil }
+
+func (r *recordingTracker) OperationStarted(provider, operationID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.operations == nil {
+		r.operations = make(map[string]string)
+	}
+	r.operations[provider] = operationID
+	return nil
+}
+
+func newTestYandexArtService(t *testing.T, handler http.Handler) *YandexArtServiceImpl {
+	t.Helper()
+	t.Setenv("YANDEX_ART_FOLDER_ID", "folder")
+
+	server := newStubServer(t, handler)
+	svc := NewYandexArtService(&config.Config{YandexArtFolderID: "folder"}, newQuietLogger(), staticAuth{}, nil)
+	svc.client = server.Client()
+	svc.poller = NewPoller(testPollConfig)
+	svc.generationURL = server.URL + "/generate"
+	svc.operationURL = server.URL + "/operations/"
+	return svc
+}
+
+func TestYandexArtService_PollsUntilDone(t *testing.T) {
+	image := []byte("generated image")
+	var polls atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /generate", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer iam-token", r.Header.Get("Authorization"))
+
+		var request YandexARTRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, "art://folder/yandex-art/latest", request.ModelUri)
+		assert.Equal(t, "prompt", request.Messages[0].Text)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "op-1"})
+	})
+	mux.HandleFunc("GET /operations/op-1", func(w http.ResponseWriter, r *http.Request) {
+		switch polls.Add(1) {
+		case 1:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "op-1", "done": false})
+		case 2:
+			// Временная ошибка API не прерывает ожидание
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":       "op-1",
+				"done":     true,
+				"response": map[string]string{"image": base64.StdEncoding.EncodeToString(image)},
+			})
+		}
+	})
+	svc := newTestYandexArtService(t, mux)
+
+	tracker := &recordingTracker{}
+	ctx := withProviderName(WithGenerationTracker(context.Background(), tracker), ProviderYandexArt)
+	result, err := svc.GenerateImage(ctx, "prompt")
+
+	assert.NoError(t, err)
+	assert.Equal(t, image, result.Image)
+	assert.Equal(t, yandexArtModel, result.Model)
+	assert.Equal(t, 4, result.Attempts, "one start request and three status checks")
+	assert.Equal(t, map[string]string{ProviderYandexArt: "op-1"}, tracker.operations)
+}
+
+func TestYandexArtService_SeedAndAspectRatio(t *testing.T) {
+	var seeds []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /generate", func(w http.ResponseWriter, r *http.Request) {
+		var request YandexARTRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		seeds = append(seeds, request.GenerationOptions.Seed)
+		if request.GenerationOptions.Seed == "1863" {
+			assert.Equal(t, AspectRatio{WidthRatio: "16", HeightRatio: "9"}, request.GenerationOptions.AspectRatio)
+		} else {
+			assert.Equal(t, AspectRatio{WidthRatio: "1", HeightRatio: "1"}, request.GenerationOptions.AspectRatio)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "op-1"})
+	})
+	mux.HandleFunc("GET /operations/op-1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":       "op-1",
+			"done":     true,
+			"response": map[string]string{"image": base64.StdEncoding.EncodeToString([]byte("image"))},
+		})
+	})
+	svc := newTestYandexArtService(t, mux)
+
+	ctx := WithImageOptions(context.Background(), ImageOptions{Seed: "1863", AspectRatio: "16:9"})
+	result, err := svc.GenerateImage(ctx, "prompt")
+	assert.NoError(t, err)
+	assert.Equal(t, "1863", result.Seed)
+
+	// Без явного сида каждая генерация получает новый случайный сид
+	first, err := svc.GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+	second, err := svc.GenerateImage(context.Background(), "prompt")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Seed, second.Seed)
+	assert.Equal(t, []string{"1863", first.Seed, second.Seed}, seeds)
+}
+
+func TestYandexArtService_WeightedMessages(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /generate", func(w http.ResponseWriter, r *http.Request) {
+		var request YandexARTRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.Equal(t, []Message{
+			{Weight: "2", Text: "cat in space"},
+			{Weight: "0.5", Text: "vaporwave"},
+		}, request.Messages)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": "op-1"})
+	})
+	mux.HandleFunc("GET /operations/op-1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":       "op-1",
+			"done":     true,
+			"response": map[string]string{"image": base64.StdEncoding.EncodeToString([]byte("image"))},
+		})
+	})
+	svc := newTestYandexArtService(t, mux)
+
+	result, err := svc.GenerateWeightedImage(context.Background(), []PromptPart{
+		{Text: "cat in space", Weight: 2},
+		{Text: "vaporwave", Weight: 0.5},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cat in space::2 | vaporwave::0.5", result.Prompt)
+}
+
+func TestYandexArtService_TerminalOperationError(t *testing.T) {
+	var polls atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /operations/op-1", func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":    "op-1",
+			"done":  true,
+			"error": map[string]interface{}{"code": 3, "message": "it is not possible to generate an image from this request"},
+		})
+	})
+	svc := newTestYandexArtService(t, mux)
+
+	_, err := svc.ResumeImage(context.Background(), "op-1")
+
+	assert.ErrorContains(t, err, "it is not possible to generate an image")
+	assert.Equal(t, int32(1), polls.Load())
+}
+
+func TestYandexArtService_UnknownOperation(t *testing.T) {
+	svc := newTestYandexArtService(t, http.NotFoundHandler())
+
+	_, err := svc.ResumeImage(context.Background(), "missing")
+
+	assert.ErrorContains(t, err, "unexpected status code: 404")
+}
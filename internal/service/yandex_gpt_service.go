@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/azalio/meme-bot/internal/config"
+	"github.com/azalio/meme-bot/internal/otel/metrics"
 	"github.com/azalio/meme-bot/pkg/logger"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -17,167 +20,135 @@ const (
 	modelName        = "yandexgpt-lite"
 )
 
-// YandexGPTServiceImpl реализует сервис для работы с Yandex GPT API
-type YandexGPTServiceImpl struct {
+// YandexGPTClient реализует LLMClient для Yandex GPT API
+type YandexGPTClient struct {
 	config      *config.Config
 	logger      *logger.Logger
 	authService YandexAuthService
+	model       string
+	url         string
+	client      *http.Client
 }
 
-// NewYandexGPTService создает новый экземпляр GPT сервиса
-func NewYandexGPTService(cfg *config.Config, log *logger.Logger, auth YandexAuthService) *YandexGPTServiceImpl {
-	return &YandexGPTServiceImpl{
+// NewYandexGPTClient создает клиент Yandex GPT; модель берется из YANDEX_GPT_MODEL
+func NewYandexGPTClient(cfg *config.Config, log *logger.Logger, auth YandexAuthService) *YandexGPTClient {
+	model := cfg.YandexGPTModel
+	if model == "" {
+		model = modelName
+	}
+	timeout := cfg.LLMTimeout
+	if timeout <= 0 {
+		timeout = llmDefaultTimeout
+	}
+	return &YandexGPTClient{
 		config:      cfg,
 		logger:      log,
 		authService: auth,
+		model:       model,
+		url:         gptCompletionURL,
+		client:      &http.Client{Timeout: timeout},
 	}
 }
 
-// GenerateImagePrompt генерирует промпт и подпись для создания изображения
-func (s *YandexGPTServiceImpl) GenerateImagePrompt(ctx context.Context, userPrompt string) (string, string, error) {
-	s.logger.Debug(ctx, "Requesting IAM token from auth service", nil)
-	iamToken, err := s.authService.GetIAMToken(ctx)
+// Name returns the backend name
+func (c *YandexGPTClient) Name() string {
+	return LLMProviderYandexGPT
+}
+
+// Complete sends the dialog to Yandex GPT and returns the first alternative
+func (c *YandexGPTClient) Complete(ctx context.Context, request LLMRequest) (string, error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.APIResponseTime.Observe(time.Since(startTime).Seconds(),
+			attribute.String("service", LLMProviderYandexGPT))
+	}()
+
+	c.logger.Debug(ctx, "Requesting IAM token from auth service", nil)
+	iamToken, err := c.authService.GetIAMToken(ctx)
 	if err != nil {
-		return "", "", fmt.Errorf("getting IAM token: %w", err)
+		return "", fmt.Errorf("getting IAM token: %w", err)
 	}
 
-	// Создаем запрос к Yandex GPT API
-	request := GPTRequest{
-		ModelUri: fmt.Sprintf("gpt://%s/%s", s.config.YandexArtFolderID, modelName),
+	gptRequest := GPTRequest{
+		ModelUri: fmt.Sprintf("gpt://%s/%s", c.config.YandexArtFolderID, c.model),
 		CompletionOptions: CompletionOptions{
 			Stream:      false,
-			Temperature: 0.6,
-			MaxTokens:   "200",
-		},
-		Messages: []GPTMessage{
-			{
-				Role: "system",
-				Text: `
-				Ты выступаешь в роли креативного мем-редактора и стендапера в одном лице. Твоя задача — преобразовать короткое описание мема так, чтобы получилась злободневная, ироничная и запоминающаяся шутка, содержащая:
-				1. Небольшую завязку (контекст или ситуацию), которая намекает на современную поп-культуру, тренд или повседневную проблему.
-				2. Юмористический поворот с использованием абсурда, гиперболы или контраста.
-				3. Эмоциональные слова и лёгкий сленг, которые усилят комичность.
-				4. Отсылку к чему-то неожиданному (исторический факт, известная личность, бытовая мелочь), чтобы вызвать «эффект сюрприза».
-				5. Финальную формулировку для подписи на изображении (короткую, не более 1–2 строк).
-
-				Ответ должен быть в формате JSON:
-				{
-					"context": "Контекст/ситуация на английском языке",
-					"detail": "Остроумная деталь на английском языке",
-					"caption": "Итоговая подпись для картинки на русском языке"
-				}
-				`,
-			},
-			{
-				Role: "user",
-				Text: fmt.Sprintf(`Создай краткое описание мема на тему: %s. Опиши основные элементы, цвета и настроение.`, userPrompt),
-			},
+			Temperature: request.Temperature,
+			MaxTokens:   strconv.Itoa(request.MaxTokens),
 		},
 	}
+	if request.JSONSchema != nil {
+		gptRequest.JSONSchema = &GPTJSONSchema{Schema: request.JSONSchema}
+	}
+	for _, message := range request.Messages {
+		gptRequest.Messages = append(gptRequest.Messages, GPTMessage{Role: message.Role, Text: message.Text})
+	}
 
-	// Отправляем запрос
-	s.logger.Debug(ctx, "Initiating GPT request", map[string]interface{}{
-		"prompt_length": len(userPrompt),
-	})
-
-	response, err := s.sendGPTRequest(ctx, iamToken, request)
+	response, err := c.sendGPTRequest(ctx, iamToken, gptRequest)
 	if err != nil {
-		s.logger.Error(ctx, "Failed to generate enhanced prompt, falling back to original", map[string]interface{}{
-			"error":           err.Error(),
-			"original_prompt": userPrompt,
-		})
-		return userPrompt, "", nil
+		return "", err
 	}
-
-	// Проверяем наличие ответа
 	if len(response.Result.Alternatives) == 0 {
-		s.logger.Error(ctx, "Empty GPT response, falling back to original prompt", map[string]interface{}{
-			"original_prompt": userPrompt,
-		})
-		return userPrompt, "", nil
+		return "", fmt.Errorf("empty GPT response")
 	}
-
-	// Удаляем обратные кавычки из ответа
-	responseText := strings.Trim(response.Result.Alternatives[0].Message.Text, "`")
-
-	// Пытаемся распарсить JSON-ответ
-	var promptResponse GPTPromptResponse
-	if err := json.Unmarshal([]byte(responseText), &promptResponse); err != nil {
-		s.logger.Error(ctx, "Failed to parse GPT JSON response, using original text", map[string]interface{}{
-			"error": err.Error(),
-			"text":  responseText,
-		})
-		return userPrompt, "", nil
-	}
-
-	// Формируем итоговый промпт из context и detail
-	enhancedPrompt := promptResponse.Context + "." + promptResponse.Detail
-
-	s.logger.Debug(ctx, "Successfully parsed GPT response", map[string]interface{}{
-		"context": promptResponse.Context,
-		"detail":  promptResponse.Detail,
-		"caption": promptResponse.Caption,
-	})
-
-	return enhancedPrompt, promptResponse.Caption, nil
+	return response.Result.Alternatives[0].Message.Text, nil
 }
 
 // sendGPTRequest отправляет запрос к Yandex GPT API и обрабатывает ответ
-func (s *YandexGPTServiceImpl) sendGPTRequest(ctx context.Context, iamToken string, request GPTRequest) (*GPTResponse, error) {
+func (c *YandexGPTClient) sendGPTRequest(ctx context.Context, iamToken string, request GPTRequest) (*GPTResponse, error) {
 	requestBody, err := json.Marshal(request)
 	if err != nil {
-		s.logger.Error(ctx, "Failed to marshal GPT request", map[string]interface{}{
+		c.logger.Error(ctx, "Failed to marshal GPT request", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return nil, fmt.Errorf("marshalling request: %w", err)
 	}
 
-	s.logger.Debug(ctx, "Preparing GPT service request", map[string]interface{}{
-		"url":    gptCompletionURL,
+	c.logger.Debug(ctx, "Preparing GPT service request", map[string]interface{}{
+		"url":    c.url,
 		"method": "POST",
 	})
-	req, err := http.NewRequestWithContext(ctx, "POST", gptCompletionURL, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url, bytes.NewBuffer(requestBody))
 	if err != nil {
-		s.logger.Error(ctx, "Failed to create GPT request", map[string]interface{}{
+		c.logger.Error(ctx, "Failed to create GPT request", map[string]interface{}{
 			"error": err.Error(),
-			"url":   gptCompletionURL,
+			"url":   c.url,
 		})
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+iamToken)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-folder-id", s.config.YandexArtFolderID)
+	req.Header.Set("x-folder-id", c.config.YandexArtFolderID)
 
-	s.logger.Debug(ctx, "Sending GPT request", map[string]interface{}{
-		"folder_id": s.config.YandexArtFolderID,
-		"headers":   req.Header,
+	c.logger.Debug(ctx, "Sending GPT request", map[string]interface{}{
+		"folder_id": c.config.YandexArtFolderID,
+		"model":     c.model,
 	})
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		s.logger.Error(ctx, "Failed to execute GPT request", map[string]interface{}{
+		c.logger.Error(ctx, "Failed to execute GPT request", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return nil, fmt.Errorf("making request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	s.logger.Debug(ctx, "Received GPT response", map[string]interface{}{
+	c.logger.Debug(ctx, "Received GPT response", map[string]interface{}{
 		"status_code": resp.StatusCode,
 	})
 	if resp.StatusCode != http.StatusOK {
 		// Пытаемся прочитать тело ошибки
 		var errResponse GPTErrorResponse
 		if err := json.NewDecoder(resp.Body).Decode(&errResponse); err == nil {
-			s.logger.Error(ctx, "GPT service returned error", map[string]interface{}{
+			c.logger.Error(ctx, "GPT service returned error", map[string]interface{}{
 				"status_code": resp.StatusCode,
 				"error":       errResponse,
 			})
 			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 		}
-		s.logger.Error(ctx, "GPT service returned error with undecodable body", map[string]interface{}{
+		c.logger.Error(ctx, "GPT service returned error with undecodable body", map[string]interface{}{
 			"status_code": resp.StatusCode,
 		})
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
@@ -185,13 +156,13 @@ func (s *YandexGPTServiceImpl) sendGPTRequest(ctx context.Context, iamToken stri
 
 	var response GPTResponse
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		s.logger.Error(ctx, "Failed to decode GPT response", map[string]interface{}{
+		c.logger.Error(ctx, "Failed to decode GPT response", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return nil, fmt.Errorf("decoding response: %w", err)
 	}
 
-	s.logger.Debug(ctx, "Successfully processed GPT response", map[string]interface{}{
+	c.logger.Debug(ctx, "Successfully processed GPT response", map[string]interface{}{
 		"alternatives_count": len(response.Result.Alternatives),
 	})
 
@@ -205,6 +176,13 @@ type GPTRequest struct {
 	ModelUri          string            `json:"modelUri"`
 	CompletionOptions CompletionOptions `json:"completionOptions"`
 	Messages          []GPTMessage      `json:"messages"`
+	// JSONSchema включает структурированный вывод: ответ соответствует схеме
+	JSONSchema *GPTJSONSchema `json:"jsonSchema,omitempty"`
+}
+
+// GPTJSONSchema описывает схему ответа в режиме структурированного вывода
+type GPTJSONSchema struct {
+	Schema map[string]interface{} `json:"schema"`
 }
 
 type CompletionOptions struct {
@@ -236,13 +214,6 @@ type GPTResponse struct {
 	} `json:"result"`
 }
 
-// GPTPromptResponse представляет структурированный ответ от GPT
-type GPTPromptResponse struct {
-	Context string `json:"context"`
-	Detail  string `json:"detail"`
-	Caption string `json:"caption"`
-}
-
 // GPTErrorResponse описывает структуру ошибки от API
 type GPTErrorResponse struct {
 	Error struct {
@@ -253,17 +224,3 @@ type GPTErrorResponse struct {
 		Details    []string `json:"details"`
 	} `json:"error"`
 }
-
-// truncateText обрезает текст до указанной длины, сохраняя целые предложения
-func truncateText(text string, maxLength int) string {
-	if len(text) <= maxLength {
-		return text
-	}
-
-	lastDot := strings.LastIndex(text[:maxLength], ".")
-	if lastDot == -1 {
-		return text[:maxLength]
-	}
-
-	return text[:lastDot+1]
-}